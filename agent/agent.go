@@ -13,9 +13,11 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictorLowther/jsonpatch2/utils"
+	"github.com/digitalrebar/provision"
 	"github.com/digitalrebar/provision/api"
 	"github.com/digitalrebar/provision/models"
 	"github.com/shirou/gopsutil/host"
@@ -35,6 +37,25 @@ const (
 	AGENT_KEXEC
 )
 
+var stateNames = map[state]string{
+	AGENT_INIT:                  "INIT",
+	AGENT_WAIT_FOR_RUNNABLE:     "WAIT_FOR_RUNNABLE",
+	AGENT_RUN_TASK:              "RUN_TASK",
+	AGENT_WAIT_FOR_CHANGE_STAGE: "WAIT_FOR_CHANGE_STAGE",
+	AGENT_CHANGE_STAGE:          "CHANGE_STAGE",
+	AGENT_EXIT:                  "EXIT",
+	AGENT_REBOOT:                "REBOOT",
+	AGENT_POWEROFF:              "POWEROFF",
+	AGENT_KEXEC:                 "KEXEC",
+}
+
+func (s state) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", int(s))
+}
+
 type si struct {
 	BootTime uint64
 	Machine  *models.Machine
@@ -71,6 +92,16 @@ type Agent struct {
 	logger                                    io.Writer
 	bootTime                                  uint64
 	err                                       error
+	actionKey                                 *[32]byte
+	requireSigned                             bool
+	spool                                     *spool
+	failGrace                                 time.Duration
+	heartbeatInterval                         time.Duration
+	started                                   time.Time
+	// The state the Agent is in, for the heartbeat to report.
+	reportedState             int32
+	selfUpdate, updateChecked bool
+	inventoryChecked          bool
 }
 
 func (a *Agent) saveState() error {
@@ -112,6 +143,9 @@ func New(c *api.Client, m *models.Machine,
 		exitOnNotRunnable: exitOnNotRunnable,
 		logger:            logger,
 		waitTimeout:       1 * time.Hour,
+		failGrace:         1 * time.Minute,
+		heartbeatInterval: 30 * time.Second,
+		started:           time.Now(),
 	}
 	if res.logger == nil {
 		res.logger = os.Stderr
@@ -178,6 +212,70 @@ func (a *Agent) StateLoc(s string) *Agent {
 	return a
 }
 
+// HeartbeatInterval changes how often the Agent sends a heartbeat to
+// dr-provision from the default of every 30 seconds.  0 turns
+// heartbeats off.
+func (a *Agent) HeartbeatInterval(t time.Duration) *Agent {
+	a.heartbeatInterval = t
+	return a
+}
+
+// heartbeat sends a heartbeat for the Machine with key to dr-provision
+// every heartbeatInterval until stop is closed.  It runs alongside the
+// main loop of the Agent, so it must not touch a.machine.
+func (a *Agent) heartbeat(key string, stop chan struct{}) {
+	if a.heartbeatInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		hb := &models.AgentHeartbeat{
+			Version:  provision.RSVersion,
+			State:    state(atomic.LoadInt32(&a.reportedState)).String(),
+			Uptime:   int64(time.Since(a.started) / time.Second),
+			BootTime: time.Unix(int64(a.bootTime), 0),
+		}
+		if err := a.client.Req().Post(hb).UrlFor("machines", key, "heartbeat").Do(nil); err != nil {
+			a.logf("MachineAgent: failed to send heartbeat: %v\n", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SelfUpdate makes the Agent replace itself with the drpcli binary
+// from dr-provision when their versions differ.  The binary is only
+// checked against a checksum from dr-provision, so an Agent that
+// requires signed actions does not update itself.
+func (a *Agent) SelfUpdate(b bool) *Agent {
+	a.selfUpdate = b
+	return a
+}
+
+// FailGrace changes how long after the Agent last did anything for a
+// running Job it waits before declaring the Job failed when it
+// (re)starts, from the default of 1 minute.  The Agent only knows
+// what it did for a Job if it has a state directory to spool job
+// updates in.
+func (a *Agent) FailGrace(t time.Duration) *Agent {
+	a.failGrace = t
+	return a
+}
+
+// ActionKey pins the public key that the server signs job actions
+// with.  The Agent asks for signed actions and refuses to run actions
+// whose signatures do not match the key.  If require is set, it also
+// refuses to run actions that are not signed at all.
+func (a *Agent) ActionKey(key *[32]byte, require bool) *Agent {
+	a.actionKey = key
+	a.requireSigned = require
+	return a
+}
+
 func (a *Agent) power(cmdLine string) error {
 	if !a.doPower {
 		return nil
@@ -218,8 +316,15 @@ func (a *Agent) initOrExit() {
 }
 
 // init resets the Machine Agent back to its initial state.  This
-// consists of marking any current running jobs as Failed and
-// reopening the event stream from dr-provision.
+// consists of replaying any job updates spooled while dr-provision
+// could not be reached, marking any current running jobs as Failed,
+// and reopening the event stream from dr-provision.  If asked to, the
+// Agent first updates itself to the version of dr-provision.  The
+// hardware inventory of the Machine is sent once per boot.
+//
+// A running job that the Agent did something for less than failGrace
+// ago is given the rest of failGrace to finish before it is failed,
+// and is left alone if its state changed in the meantime.
 func (a *Agent) init() {
 	if a.err != nil {
 		a.err = nil
@@ -229,9 +334,40 @@ func (a *Agent) init() {
 		a.events = nil
 	}
 	var err error
+	if a.selfUpdate && !a.updateChecked {
+		a.checkForUpdate()
+	}
+	if a.spool == nil && a.stateDir != "" {
+		if a.spool, err = openSpool(path.Join(a.stateDir, a.machine.Key()+".spool")); err != nil {
+			a.logf("MachineAgent: cannot open job update spool: %v\n", err)
+		}
+	}
+	if a.spool != nil {
+		if a.err = a.spool.flush(a.client); a.err != nil {
+			a.logf("MachineAgent: cannot replay spooled job updates: %v\n", a.err)
+			a.exitOrSleep()
+			return
+		}
+	}
+	if !a.inventoryChecked {
+		a.submitInventory()
+	}
 	currentJob := &models.Job{Uuid: a.machine.CurrentJob}
 	if a.client.Req().Fill(currentJob) == nil {
 		if currentJob.State == "running" || currentJob.State == "created" {
+			if a.spool != nil {
+				since := time.Since(a.spool.lastActive(currentJob.Key()))
+				if since < a.failGrace {
+					a.logf("MachineAgent: job %s was active %s ago, waiting before failing it\n", currentJob.Key(), since)
+					time.Sleep(a.failGrace - since)
+					// Only fail the job if nothing else moved it along
+					// in the meantime.
+					state := currentJob.State
+					if a.client.Req().Fill(currentJob) != nil || currentJob.State != state {
+						return
+					}
+				}
+			}
 			cj := models.Clone(currentJob).(*models.Job)
 			cj.State = "failed"
 			if _, a.err = a.client.PatchTo(currentJob, cj); a.err != nil {
@@ -480,6 +616,10 @@ func (a *Agent) runTask() {
 		a.initOrExit()
 		return
 	}
+	if runner != nil {
+		runner.pinActionKey(a.actionKey, a.requireSigned)
+		runner.spoolTo(a.spool)
+	}
 	if runner == nil {
 		if a.chrootDir != "" {
 			a.logf("Current tasks finished, exiting chroot\n")
@@ -513,7 +653,7 @@ func (a *Agent) runTask() {
 		return
 	}
 	a.state = AGENT_WAIT_FOR_RUNNABLE
-	if runner.t != nil {
+	if runner.t != nil || runner.members != nil {
 		defer runner.Close()
 		if runner.reboot {
 			runner.log("Task signalled runner to reboot")
@@ -524,6 +664,9 @@ func (a *Agent) runTask() {
 		} else if runner.stop {
 			runner.log("Task signalled runner to stop")
 			a.state = AGENT_EXIT
+		} else if runner.retrying {
+			runner.log("Task failed, retrying in %s", runner.retryDelay)
+			time.Sleep(runner.retryDelay)
 		} else if runner.failed {
 			runner.log("Task signalled that it failed")
 			if a.exitOnFailure {
@@ -642,8 +785,14 @@ func (a *Agent) changeStage() {
 		}
 	}
 	if newStage.Reboot {
-		// A reboot flag on the next stage forces an unconditional reboot.
-		a.rebootOrExit(true)
+		if a.hasBMC() {
+			// The server power cycles Machines with a BMC when they
+			// enter a Stage with the reboot flag, so leave it to that.
+			a.state = AGENT_EXIT
+		} else {
+			// A reboot flag on the next stage forces an unconditional reboot.
+			a.rebootOrExit(true)
+		}
 	}
 	newM := models.Clone(a.machine).(*models.Machine)
 	newM.Stage = nextStage
@@ -653,6 +802,16 @@ func (a *Agent) changeStage() {
 	}
 }
 
+// hasBMC returns whether the server controls the power of the machine
+// through its BMC.
+func (a *Agent) hasBMC() bool {
+	var driver interface{}
+	err := a.client.Req().Get().
+		UrlForM(a.machine, "params", "bmc/driver").
+		Params("aggregate", "true").Do(&driver)
+	return err == nil && driver != nil && driver != ""
+}
+
 func (a *Agent) loadState() {
 	if a.stateDir == "" {
 		return
@@ -701,7 +860,11 @@ func (a *Agent) Run() error {
 		}
 	}
 	a.loadState()
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	go a.heartbeat(a.machine.Key(), stopHeartbeat)
 	for {
+		atomic.StoreInt32(&a.reportedState, int32(a.state))
 		switch a.state {
 		case AGENT_INIT:
 			a.logf("Agent in init\n")
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/api"
+	"github.com/digitalrebar/provision/models"
+)
+
+// SubmitInventory sends inv to dr-provision as the hardware Inventory
+// of m.  dr-provision publishes an inventories changed event if the
+// hardware differs from what m last reported.
+func SubmitInventory(c *api.Client, m *models.Machine, inv *models.Inventory) error {
+	inv.Machine = m.Uuid
+	return c.Req().Post(inv).UrlFor("machines", m.Key(), "inventory").Do(inv)
+}
+
+// submitInventory gathers the hardware Inventory of the Machine and
+// sends it to dr-provision, unless dr-provision already has one that
+// was gathered since the Machine last booted.  It is only tried once
+// per run of the Agent, and failing to do so is not fatal.
+func (a *Agent) submitInventory() {
+	a.inventoryChecked = true
+	boot := time.Unix(int64(a.bootTime), 0)
+	old := &models.Inventory{Machine: a.machine.Uuid}
+	if err := a.client.Req().Fill(old); err == nil && old.Boot.Equal(boot) {
+		return
+	}
+	inv, err := GatherInventory()
+	if err != nil {
+		a.logf("MachineAgent: cannot gather hardware inventory: %v\n", err)
+		return
+	}
+	if err := SubmitInventory(a.client, a.machine, inv); err != nil {
+		a.logf("MachineAgent: cannot submit hardware inventory: %v\n", err)
+	}
+}
+
+// parseCPUInfo turns the contents of /proc/cpuinfo into one
+// InventoryCPU per socket.  Systems that do not report a physical id
+// for their processors are treated as having one socket.  The speed
+// in /proc/cpuinfo is the current one, so MHz is left for the caller
+// to fill in.
+func parseCPUInfo(r io.Reader) []models.InventoryCPU {
+	sockets := map[int]*models.InventoryCPU{}
+	var cur *models.InventoryCPU
+	fields := map[string]string{}
+	finish := func() {
+		if len(fields) == 0 {
+			return
+		}
+		socket, _ := strconv.Atoi(fields["physical id"])
+		cur = sockets[socket]
+		if cur == nil {
+			cur = &models.InventoryCPU{Socket: socket}
+			sockets[socket] = cur
+		}
+		if cur.Vendor == "" {
+			cur.Vendor = fields["vendor_id"]
+			if cur.Vendor == "" {
+				cur.Vendor = fields["CPU implementer"]
+			}
+		}
+		if cur.Model == "" {
+			cur.Model = fields["model name"]
+		}
+		if cores, err := strconv.Atoi(fields["cpu cores"]); err == nil {
+			cur.Cores = cores
+		} else {
+			cur.Cores++
+		}
+		cur.Threads++
+		fields = map[string]string{}
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			finish()
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	finish()
+	res := []models.InventoryCPU{}
+	for _, cpu := range sockets {
+		res = append(res, *cpu)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Socket < res[j].Socket })
+	return res
+}
+
+// smbiosMemoryTypes names the memory types in SMBIOS type 17 entries.
+var smbiosMemoryTypes = map[byte]string{
+	0x03: "DRAM",
+	0x0f: "SDRAM",
+	0x12: "DDR",
+	0x13: "DDR2",
+	0x14: "DDR2 FB-DIMM",
+	0x18: "DDR3",
+	0x1a: "DDR4",
+	0x1b: "LPDDR",
+	0x1c: "LPDDR2",
+	0x1d: "LPDDR3",
+	0x1e: "LPDDR4",
+	0x20: "HBM",
+	0x21: "HBM2",
+	0x22: "DDR5",
+	0x23: "LPDDR5",
+}
+
+// parseDIMM decodes a raw SMBIOS type 17 (Memory Device) entry.  It
+// returns false if the entry is not valid or its slot is empty.
+func parseDIMM(raw []byte) (models.InventoryDIMM, bool) {
+	res := models.InventoryDIMM{}
+	if len(raw) < 0x15 || raw[0] != 17 || raw[1] < 0x15 || int(raw[1]) > len(raw) {
+		return res, false
+	}
+	formatted := raw[:raw[1]]
+	strs := bytes.Split(raw[raw[1]:], []byte{0})
+	str := func(off int) string {
+		if off >= len(formatted) || formatted[off] == 0 || int(formatted[off]) > len(strs) {
+			return ""
+		}
+		return strings.TrimSpace(string(strs[formatted[off]-1]))
+	}
+	word := func(off int) int {
+		if off+2 > len(formatted) {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint16(formatted[off:]))
+	}
+	switch size := word(0x0c); {
+	case size == 0 || size == 0xffff:
+		return res, false
+	case size == 0x7fff && len(formatted) >= 0x20:
+		res.Size = int64(binary.LittleEndian.Uint32(formatted[0x1c:])&0x7fffffff) << 20
+	case size&0x8000 != 0:
+		res.Size = int64(size&0x7fff) << 10
+	default:
+		res.Size = int64(size) << 20
+	}
+	res.Locator = str(0x10)
+	if bank := str(0x11); bank != "" {
+		res.Locator = bank + "/" + res.Locator
+	}
+	res.Type = smbiosMemoryTypes[formatted[0x12]]
+	if res.Type == "" {
+		res.Type = "Other"
+	}
+	res.Speed = word(0x15)
+	res.Manufacturer = str(0x17)
+	res.SerialNumber = str(0x18)
+	res.PartNumber = str(0x1a)
+	return res, true
+}
@@ -0,0 +1,271 @@
+// +build linux
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/shirou/gopsutil/host"
+)
+
+// sysRead returns the trimmed contents of a file under /sys or /proc,
+// or "" if it cannot be read.
+func sysRead(parts ...string) string {
+	buf, err := ioutil.ReadFile(path.Join(parts...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// sysLink returns the last part of where a symlink under /sys points,
+// or "" if it is not a symlink.
+func sysLink(parts ...string) string {
+	dest, err := os.Readlink(path.Join(parts...))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(dest)
+}
+
+func sysInt(parts ...string) int64 {
+	res, _ := strconv.ParseInt(sysRead(parts...), 10, 64)
+	return res
+}
+
+func gatherCPUs() ([]models.InventoryCPU, error) {
+	fi, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	res := parseCPUInfo(fi)
+	cpus, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*")
+	for _, cpu := range cpus {
+		socket := int(sysInt(cpu, "topology", "physical_package_id"))
+		mhz := int(sysInt(cpu, "cpufreq", "cpuinfo_max_freq") / 1000)
+		for i := range res {
+			if res[i].Socket == socket && mhz > res[i].MHz {
+				res[i].MHz = mhz
+			}
+		}
+	}
+	return res, nil
+}
+
+func gatherMemTotal() int64 {
+	fi, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer fi.Close()
+	scanner := bufio.NewScanner(fi)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb << 10
+		}
+	}
+	return 0
+}
+
+func gatherDIMMs() []models.InventoryDIMM {
+	res := []models.InventoryDIMM{}
+	entries, _ := filepath.Glob("/sys/firmware/dmi/entries/17-*/raw")
+	for _, entry := range entries {
+		raw, err := ioutil.ReadFile(entry)
+		if err != nil {
+			continue
+		}
+		if dimm, ok := parseDIMM(raw); ok {
+			res = append(res, dimm)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Locator < res[j].Locator })
+	return res
+}
+
+func gatherDisks() []models.InventoryDisk {
+	res := []models.InventoryDisk{}
+	blocks, _ := ioutil.ReadDir("/sys/block")
+	for _, block := range blocks {
+		dir := path.Join("/sys/block", block.Name())
+		// Loop, ram, device mapper, and md devices have no device.
+		if _, err := os.Stat(path.Join(dir, "device")); err != nil {
+			continue
+		}
+		disk := models.InventoryDisk{
+			Name:       block.Name(),
+			Model:      sysRead(dir, "device", "model"),
+			Size:       sysInt(dir, "size") * 512,
+			Rotational: sysRead(dir, "queue", "rotational") == "1",
+		}
+		// NVMe controllers have a serial and firmware_rev, SCSI and
+		// ATA devices have a rev and a unit serial number VPD page.
+		disk.SerialNumber = sysRead(dir, "device", "serial")
+		if disk.SerialNumber == "" {
+			if vpd, err := ioutil.ReadFile(path.Join(dir, "device", "vpd_pg80")); err == nil && len(vpd) > 4 {
+				disk.SerialNumber = strings.TrimSpace(string(vpd[4:]))
+			}
+		}
+		disk.Firmware = sysRead(dir, "device", "firmware_rev")
+		if disk.Firmware == "" {
+			disk.Firmware = sysRead(dir, "device", "rev")
+		}
+		res = append(res, disk)
+	}
+	return res
+}
+
+// ethtoolDrvinfo is struct ethtool_drvinfo from linux/ethtool.h.
+type ethtoolDrvinfo struct {
+	cmd         uint32
+	driver      [32]byte
+	version     [32]byte
+	fwVersion   [32]byte
+	busInfo     [32]byte
+	eromVersion [32]byte
+	reserved2   [12]byte
+	nPrivFlags  uint32
+	nStats      uint32
+	testinfoLen uint32
+	eedumpLen   uint32
+	regdumpLen  uint32
+}
+
+const (
+	siocEthtool     = 0x8946
+	ethtoolGdrvinfo = 0x00000003
+)
+
+// nicFirmware asks the driver of a NIC for its firmware version.
+func nicFirmware(name string) string {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return ""
+	}
+	defer syscall.Close(fd)
+	info := ethtoolDrvinfo{cmd: ethtoolGdrvinfo}
+	// struct ifreq, which is padded out to 40 bytes by its union.
+	req := struct {
+		name [syscall.IFNAMSIZ]byte
+		data uintptr
+		_    [16]byte
+	}{data: uintptr(unsafe.Pointer(&info))}
+	copy(req.name[:], name)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocEthtool, uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return ""
+	}
+	return string(bytes.TrimRight(info.fwVersion[:], "\x00"))
+}
+
+func gatherNICs() []models.InventoryNIC {
+	res := []models.InventoryNIC{}
+	ifaces, _ := ioutil.ReadDir("/sys/class/net")
+	for _, iface := range ifaces {
+		dir := path.Join("/sys/class/net", iface.Name())
+		// Virtual interfaces have no device.
+		if _, err := os.Stat(path.Join(dir, "device")); err != nil {
+			continue
+		}
+		nic := models.InventoryNIC{
+			Name:     iface.Name(),
+			MAC:      sysRead(dir, "address"),
+			Link:     sysRead(dir, "carrier") == "1",
+			Driver:   sysLink(dir, "device", "driver"),
+			Firmware: nicFirmware(iface.Name()),
+		}
+		if speed := sysInt(dir, "speed"); nic.Link && speed > 0 {
+			nic.Speed = int(speed)
+		}
+		// Some NICs, such as virtio ones, sit on a device that sits on
+		// the PCI device.
+		if dev, err := filepath.EvalSymlinks(path.Join(dir, "device")); err == nil {
+			for ; dev != "/" && dev != "."; dev = path.Dir(dev) {
+				if sysLink(dev, "subsystem") == "pci" {
+					nic.PCIAddress = path.Base(dev)
+					break
+				}
+			}
+		}
+		res = append(res, nic)
+	}
+	return res
+}
+
+func gatherPCIDevices() []models.InventoryPCIDevice {
+	res := []models.InventoryPCIDevice{}
+	devices, _ := ioutil.ReadDir("/sys/bus/pci/devices")
+	for _, device := range devices {
+		dir := path.Join("/sys/bus/pci/devices", device.Name())
+		id := func(name string) string {
+			return strings.TrimPrefix(sysRead(dir, name), "0x")
+		}
+		res = append(res, models.InventoryPCIDevice{
+			Address:   device.Name(),
+			Class:     id("class"),
+			Vendor:    id("vendor"),
+			Device:    id("device"),
+			SubVendor: id("subsystem_vendor"),
+			SubDevice: id("subsystem_device"),
+			Driver:    sysLink(dir, "driver"),
+		})
+	}
+	return res
+}
+
+// GatherInventory gathers the hardware Inventory of the system the
+// agent is running on from /proc, /sys, and the SMBIOS tables.
+// Memory is the total size of the DIMMs when the SMBIOS tables list
+// them, since the memory the kernel reports changes with the kernel.
+func GatherInventory() (*models.Inventory, error) {
+	dmi := "/sys/class/dmi/id"
+	res := &models.Inventory{
+		Collected: time.Now(),
+		System: models.InventorySystem{
+			Manufacturer: sysRead(dmi, "sys_vendor"),
+			ProductName:  sysRead(dmi, "product_name"),
+			SerialNumber: sysRead(dmi, "product_serial"),
+			UUID:         sysRead(dmi, "product_uuid"),
+		},
+		Firmware: models.InventoryFirmware{
+			BIOSVendor:  sysRead(dmi, "bios_vendor"),
+			BIOSVersion: sysRead(dmi, "bios_version"),
+			BIOSDate:    sysRead(dmi, "bios_date"),
+		},
+		DIMMs:      gatherDIMMs(),
+		Disks:      gatherDisks(),
+		NICs:       gatherNICs(),
+		PCIDevices: gatherPCIDevices(),
+	}
+	bt, err := host.BootTime()
+	if err != nil {
+		return nil, err
+	}
+	res.Boot = time.Unix(int64(bt), 0)
+	if res.CPUs, err = gatherCPUs(); err != nil {
+		return nil, err
+	}
+	for _, dimm := range res.DIMMs {
+		res.Memory += dimm.Size
+	}
+	if res.Memory == 0 {
+		res.Memory = gatherMemTotal()
+	}
+	res.Fill()
+	return res, nil
+}
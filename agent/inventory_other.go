@@ -0,0 +1,16 @@
+// +build !linux
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// GatherInventory gathers the hardware Inventory of the system the
+// agent is running on.
+func GatherInventory() (*models.Inventory, error) {
+	return nil, fmt.Errorf("Hardware inventory not supported on %v", runtime.GOOS)
+}
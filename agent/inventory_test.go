@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestParseCPUInfo(t *testing.T) {
+	info := ""
+	for i, socket := range []string{"0", "0", "1", "1"} {
+		info += strings.Join([]string{
+			"processor\t: " + strconv.Itoa(i),
+			"vendor_id\t: GenuineIntel",
+			"model name\t: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz",
+			"cpu MHz\t\t: 1000.000",
+			"physical id\t: " + socket,
+			"siblings\t: 2",
+			"cpu cores\t: 1",
+			"",
+		}, "\n") + "\n"
+	}
+	expected := []models.InventoryCPU{
+		{Socket: 0, Vendor: "GenuineIntel", Model: "Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz", Cores: 1, Threads: 2},
+		{Socket: 1, Vendor: "GenuineIntel", Model: "Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz", Cores: 1, Threads: 2},
+	}
+	if cpus := parseCPUInfo(strings.NewReader(info)); !reflect.DeepEqual(cpus, expected) {
+		t.Errorf("Expected %v, not %v", expected, cpus)
+	}
+	// No physical id, as on many ARM systems.
+	arm := "processor\t: 0\nCPU implementer\t: 0x41\n\nprocessor\t: 1\nCPU implementer\t: 0x41\n"
+	expected = []models.InventoryCPU{{Vendor: "0x41", Cores: 2, Threads: 2}}
+	if cpus := parseCPUInfo(strings.NewReader(arm)); !reflect.DeepEqual(cpus, expected) {
+		t.Errorf("Expected %v, not %v", expected, cpus)
+	}
+}
+
+func TestParseDIMM(t *testing.T) {
+	raw := make([]byte, 0x28)
+	raw[0], raw[1] = 17, 0x28
+	binary.LittleEndian.PutUint16(raw[0x0c:], 16384)
+	raw[0x10], raw[0x11], raw[0x12] = 1, 2, 0x1a
+	binary.LittleEndian.PutUint16(raw[0x15:], 2666)
+	raw[0x17], raw[0x18], raw[0x1a] = 3, 4, 5
+	raw = append(raw, []byte("DIMM_A1\x00BANK 0\x00Samsung\x0012345678\x00M393A2K43BB1-CTD  \x00\x00")...)
+	expected := models.InventoryDIMM{
+		Locator:      "BANK 0/DIMM_A1",
+		Size:         16 << 30,
+		Type:         "DDR4",
+		Speed:        2666,
+		Manufacturer: "Samsung",
+		SerialNumber: "12345678",
+		PartNumber:   "M393A2K43BB1-CTD",
+	}
+	if dimm, ok := parseDIMM(raw); !ok || !reflect.DeepEqual(dimm, expected) {
+		t.Errorf("Expected %v, not %v (%v)", expected, dimm, ok)
+	}
+	// Sizes of 32G and up are in the extended size.
+	binary.LittleEndian.PutUint16(raw[0x0c:], 0x7fff)
+	binary.LittleEndian.PutUint32(raw[0x1c:], 65536)
+	if dimm, ok := parseDIMM(raw); !ok || dimm.Size != 64<<30 {
+		t.Errorf("Expected a 64G DIMM, not %d (%v)", dimm.Size, ok)
+	}
+	// Empty slots are skipped.
+	binary.LittleEndian.PutUint16(raw[0x0c:], 0)
+	if _, ok := parseDIMM(raw); ok {
+		t.Errorf("Expected an empty slot to be skipped")
+	}
+}
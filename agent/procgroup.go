@@ -0,0 +1,23 @@
+// +build !windows,!plan9
+
+package agent
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcGroup arranges for cmd to run in its own process group, so
+// that anything it starts can be killed along with it.
+func setProcGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcGroup kills the process group of a command started with
+// setProcGroup.
+func killProcGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,11 @@
+// +build windows plan9
+
+package agent
+
+import "os/exec"
+
+func setProcGroup(cmd *exec.Cmd) {}
+
+func killProcGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,14 @@
+// +build !windows,!plan9
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+// reexec replaces the running agent with exe, keeping its arguments
+// and environment.  It only returns on failure.
+func reexec(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
@@ -0,0 +1,12 @@
+// +build windows plan9
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func reexec(exe string) error {
+	return fmt.Errorf("Re-executing the agent not supported on %v", runtime.GOOS)
+}
@@ -0,0 +1,167 @@
+// +build linux
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroupRoot is where the agent expects the cgroup v2 hierarchy to be
+// mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// sandboxParent is the cgroup that the cgroups of sandboxed Jobs are
+// created under.
+var sandboxParent = path.Join(cgroupRoot, "drp-agent")
+
+// enableControllers enables the controllers the sandbox needs for the
+// children of the cgroup dir.
+func enableControllers(dir string) error {
+	return ioutil.WriteFile(path.Join(dir, "cgroup.subtree_control"), []byte("+memory +cpu +pids"), 0644)
+}
+
+// enterSandbox arranges for cmd to run in the namespaces the Task
+// asks for, and creates a cgroup with the resource limits the Task
+// asks for that joinSandbox will move cmd into once it has started.
+// When there is a cgroup, cmd is run by a shell that waits for
+// joinSandbox before it execs the real command, so that nothing the
+// command does escapes the limits.
+func (r *runner) enterSandbox(cmd *exec.Cmd) error {
+	sb := &r.t.Sandbox
+	if !sb.Enabled() {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if sb.PIDNamespace {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWPID
+	}
+	if sb.MountNamespace {
+		// Unsharing the mount namespace also makes all the mounts
+		// in it private, so nothing mounted in it leaks back out.
+		cmd.SysProcAttr.Unshareflags |= syscall.CLONE_NEWNS
+	}
+	if !sb.Limited() {
+		return nil
+	}
+	if _, err := os.Stat(path.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("Resource limits need cgroup v2 mounted at %s", cgroupRoot)
+	}
+	if err := os.MkdirAll(sandboxParent, 0755); err != nil {
+		return err
+	}
+	for _, dir := range []string{cgroupRoot, sandboxParent} {
+		if err := enableControllers(dir); err != nil {
+			return fmt.Errorf("Unable to enable cgroup controllers in %s: %v", dir, err)
+		}
+	}
+	dir := path.Join(sandboxParent, r.j.Key())
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	r.cgroup = dir
+	limits := map[string]string{}
+	if sb.MemoryMax > 0 {
+		limits["memory.max"] = strconv.FormatInt(sb.MemoryMax, 10)
+		// Do not let the scripts get around the limit by swapping.
+		limits["memory.swap.max"] = "0"
+	}
+	if sb.CPUPercent > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", sb.CPUPercent*1000)
+	}
+	if sb.PidsMax > 0 {
+		limits["pids.max"] = strconv.Itoa(sb.PidsMax)
+	}
+	for name, val := range limits {
+		err := ioutil.WriteFile(path.Join(dir, name), []byte(val), 0644)
+		if err != nil && !(name == "memory.swap.max" && os.IsNotExist(err)) {
+			r.exitSandbox()
+			return fmt.Errorf("Unable to set %s to %s: %v", name, val, err)
+		}
+	}
+	gateR, gateW, err := os.Pipe()
+	if err != nil {
+		r.exitSandbox()
+		return err
+	}
+	r.gateR, r.gateW = gateR, gateW
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, gateR)
+	gate := fmt.Sprintf(`read go <&%d || exit 1; exec %d<&-; exec "$@"`, fd, fd)
+	cmd.Args = append([]string{"/bin/sh", "-c", gate, "drp-sandbox", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
+
+// joinSandbox moves the freshly started cmd into the cgroup created
+// by enterSandbox, and then lets it run the real command.
+func (r *runner) joinSandbox(cmd *exec.Cmd) error {
+	if r.cgroup == "" {
+		return nil
+	}
+	r.gateR.Close()
+	r.gateR = nil
+	pid := strconv.Itoa(cmd.Process.Pid)
+	if err := ioutil.WriteFile(path.Join(r.cgroup, "cgroup.procs"), []byte(pid), 0644); err != nil {
+		return err
+	}
+	_, err := r.gateW.Write([]byte("\n"))
+	r.gateW.Close()
+	r.gateW = nil
+	return err
+}
+
+// exitSandbox kills anything left running in the cgroup created by
+// enterSandbox, and removes it.
+func (r *runner) exitSandbox() {
+	for _, f := range []*os.File{r.gateR, r.gateW} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	r.gateR, r.gateW = nil, nil
+	if r.cgroup == "" {
+		return
+	}
+	dir := r.cgroup
+	r.cgroup = ""
+	if buf, err := ioutil.ReadFile(path.Join(dir, "memory.events")); err == nil {
+		sc := bufio.NewScanner(bytes.NewReader(buf))
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+				r.log("Sandbox memory limit exceeded, %s processes killed", fields[1])
+			}
+		}
+	}
+	// cgroup.kill only exists on newer kernels, so fall back to
+	// killing whatever is left one by one.
+	if ioutil.WriteFile(path.Join(dir, "cgroup.kill"), []byte("1"), 0644) != nil {
+		if buf, err := ioutil.ReadFile(path.Join(dir, "cgroup.procs")); err == nil {
+			for _, pid := range strings.Fields(string(buf)) {
+				if p, err := strconv.Atoi(pid); err == nil {
+					syscall.Kill(p, syscall.SIGKILL)
+				}
+			}
+		}
+	}
+	// The cgroup can only be removed once everything in it is gone.
+	for i := 0; i < 50; i++ {
+		if err := syscall.Rmdir(dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	r.log("Unable to remove sandbox cgroup %s", dir)
+}
@@ -0,0 +1,22 @@
+// +build !linux
+
+package agent
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+func (r *runner) enterSandbox(cmd *exec.Cmd) error {
+	if r.t.Sandbox.Enabled() {
+		return fmt.Errorf("Task sandboxes not supported on %v", runtime.GOOS)
+	}
+	return nil
+}
+
+func (r *runner) joinSandbox(cmd *exec.Cmd) error {
+	return nil
+}
+
+func (r *runner) exitSandbox() {}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/digitalrebar/provision"
+	"github.com/digitalrebar/provision/api"
+	"github.com/digitalrebar/provision/models"
+)
+
+// updatedFromEnv is set to the version of the agent that replaced
+// itself when it re-executes the new one, so that the new one can
+// report how the update went.
+const updatedFromEnv = "RS_AGENT_UPDATED_FROM"
+
+// selfUpdateResult is the Object of the events the agent publishes
+// about updating itself.
+type selfUpdateResult struct {
+	From  string
+	To    string
+	Error string `json:",omitempty"`
+}
+
+// cliBinary is the name under /files of the drpcli binary for the
+// system the agent is running on.
+func cliBinary() string {
+	return fmt.Sprintf("drpcli.%s.%s", runtime.GOARCH, runtime.GOOS)
+}
+
+// fetchUpdate downloads name from /files to dest, and verifies it
+// against the checksum dr-provision has for it.  dest is removed if
+// it could not be downloaded or verified.
+func fetchUpdate(c *api.Client, name, dest string) error {
+	sum, err := c.GetBlobSum("files", name)
+	if err != nil {
+		return err
+	}
+	if sum == "" {
+		return fmt.Errorf("No checksum for %s", name)
+	}
+	fi, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	err = c.GetBlob(io.MultiWriter(fi, hasher), "files", name)
+	if cerr := fi.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(dest, 0755)
+	}
+	if err == nil {
+		if got := hex.EncodeToString(hasher.Sum(nil)); got != sum {
+			err = fmt.Errorf("Checksum mismatch for %s: expected %s, got %s", name, sum, got)
+		}
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
+
+// publishUpdate publishes the outcome of updating the agent as a
+// machines agent-updated or agent-update-failed event.
+func (a *Agent) publishUpdate(from, to string, err error) {
+	res := &selfUpdateResult{From: from, To: to}
+	action := "agent-updated"
+	if err != nil {
+		res.Error = err.Error()
+		action = "agent-update-failed"
+		a.logf("MachineAgent: failed to update from %s to %s: %v\n", from, to, err)
+	} else {
+		a.logf("MachineAgent: updated from %s to %s\n", from, to)
+	}
+	evt := &models.Event{
+		Time:   time.Now(),
+		Type:   "machines",
+		Action: action,
+		Key:    a.machine.Key(),
+		Object: res,
+	}
+	if err := a.client.PostEvent(evt); err != nil {
+		a.logf("MachineAgent: failed to publish %s event: %v\n", action, err)
+	}
+}
+
+// checkForUpdate compares the version of the agent with the version
+// of dr-provision.  If they differ, it replaces the running binary
+// with the drpcli binary for this system from /files and re-executes
+// it.  It only returns if there is nothing to update or the update
+// failed.  The agent only tries to update itself once per run.
+//
+// The update is not signed, so it is refused when the agent requires
+// signed actions.  Otherwise dr-provision could run whatever it wants
+// on the machine by handing out a new binary.
+func (a *Agent) checkForUpdate() {
+	a.updateChecked = true
+	info, err := a.client.Info()
+	if err != nil {
+		a.logf("MachineAgent: unable to get the version of dr-provision: %v\n", err)
+		return
+	}
+	if from := os.Getenv(updatedFromEnv); from != "" {
+		// We are the result of an update, so say how it went.
+		os.Unsetenv(updatedFromEnv)
+		if provision.RSVersion != info.Version {
+			err = fmt.Errorf("%s is still at version %s", cliBinary(), provision.RSVersion)
+		}
+		a.publishUpdate(from, info.Version, err)
+		return
+	}
+	if provision.RSVersion == info.Version {
+		return
+	}
+	a.logf("MachineAgent: updating from %s to %s\n", provision.RSVersion, info.Version)
+	err = func() error {
+		if a.requireSigned {
+			return fmt.Errorf("Signed actions are required, but %s is not signed", cliBinary())
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return err
+		}
+		// Download next to the running binary, so that replacing it
+		// is a rename within the same filesystem.
+		tmp := filepath.Join(filepath.Dir(exe), "."+filepath.Base(exe)+".update")
+		if err := fetchUpdate(a.client, cliBinary(), tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, exe); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Setenv(updatedFromEnv, provision.RSVersion); err != nil {
+			return err
+		}
+		if a.events != nil {
+			a.events.Close()
+			a.events = nil
+		}
+		if err := a.saveState(); err != nil {
+			a.logf("Error saving state: %v", err)
+		}
+		err = reexec(exe)
+		os.Unsetenv(updatedFromEnv)
+		return err
+	}()
+	a.publishUpdate(provision.RSVersion, info.Version, err)
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/digitalrebar/provision/api"
+)
+
+func TestFetchUpdate(t *testing.T) {
+	c, err := api.UserSession("https://127.0.0.1:10001", "rocketskates", "r0cketsk8ts")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	defer c.Close()
+	dir, err := ioutil.TempDir("", "selfupdate-")
+	if err != nil {
+		t.Fatalf("Failed to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	content := []byte("#!/bin/sh\necho updated\n")
+	if _, err := c.PostBlob(bytes.NewReader(content), "files", "selfupdate-test"); err != nil {
+		t.Fatalf("Failed to upload update: %v", err)
+	}
+	dest := path.Join(dir, "drpcli")
+	if err := fetchUpdate(c, "selfupdate-test", dest); err != nil {
+		t.Fatalf("Failed to fetch update: %v", err)
+	}
+	if got, err := ioutil.ReadFile(dest); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Expected the update to be downloaded, not %q: %v", got, err)
+	}
+	if st, err := os.Stat(dest); err != nil || st.Mode()&0100 == 0 {
+		t.Errorf("Expected the update to be executable: %v", err)
+	}
+	missing := path.Join(dir, "missing")
+	if err := fetchUpdate(c, "selfupdate-missing", missing); err == nil {
+		t.Errorf("Expected fetching a missing update to fail")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Expected a failed update to not be left behind: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/api"
+	"github.com/digitalrebar/provision/models"
+)
+
+// spoolRetry is how long the spool waits after failing to reach
+// dr-provision before it tries to replay its entries again.
+const spoolRetry = 5 * time.Second
+
+// activityInterval is how often the spool records that the agent is
+// still doing something for the same Job.
+const activityInterval = time.Second
+
+// spoolEntry is a job log chunk or a job state transition that could
+// not be sent to dr-provision.
+type spoolEntry struct {
+	Job   string
+	Log   []byte           `json:",omitempty"`
+	Patch jsonpatch2.Patch `json:",omitempty"`
+}
+
+// spoolActivity records the last time the agent did anything for a
+// Job, so that it can tell a Job that was interrupted by a network
+// outage from one that died with the agent.
+type spoolActivity struct {
+	Job  string
+	Time time.Time
+}
+
+// spool is a durable on-disk queue of job log chunks and job state
+// transitions that the agent could not send to dr-provision while it
+// was unreachable.  Once anything has been spooled, everything after
+// it is spooled as well, and the entries are replayed in order once
+// dr-provision can be reached again.  The spool lives in the state
+// directory of the agent, so it survives the agent restarting and the
+// machine rebooting.
+type spool struct {
+	dir     string
+	mux     *sync.Mutex
+	next    uint64
+	count   int
+	retryAt time.Time
+	// activity is what was last written to the activity file.
+	activity spoolActivity
+}
+
+// openSpool opens the spool in dir, creating it if needed.
+func openSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	res := &spool{dir: dir, mux: &sync.Mutex{}}
+	names, err := res.pending()
+	if err != nil {
+		return nil, err
+	}
+	res.count = len(names)
+	if len(names) > 0 {
+		last, _ := strconv.ParseUint(strings.TrimSuffix(names[len(names)-1], ".json"), 10, 64)
+		res.next = last + 1
+	}
+	return res, nil
+}
+
+// pending returns the names of the spooled entries in the order they
+// were added.
+func (s *spool) pending() ([]string, error) {
+	ents, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, ent := range ents {
+		name := ent.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64); err == nil {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// writeFile atomically replaces name in the spool with the JSON
+// encoding of val.
+func (s *spool) writeFile(name string, val interface{}) error {
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".spool-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path.Join(s.dir, name))
+}
+
+// add appends e to the spool.  The caller must hold mux.
+func (s *spool) add(e *spoolEntry) error {
+	if err := s.writeFile(fmt.Sprintf("%020d.json", s.next), e); err != nil {
+		return err
+	}
+	s.next++
+	s.count++
+	return nil
+}
+
+// retryable returns whether err means that the request should be
+// tried again later, as opposed to dr-provision rejecting it.  That is
+// the case when dr-provision could not be reached, when it failed
+// server side, and when it timed out or throttled the request.
+func retryable(err error) bool {
+	e, ok := err.(*models.Error)
+	if !ok {
+		return true
+	}
+	return e.Code < 400 || e.Code >= 500 ||
+		e.Code == http.StatusRequestTimeout ||
+		e.Code == http.StatusTooManyRequests
+}
+
+// deliver sends e to dr-provision.
+func deliver(c *api.Client, e *spoolEntry) error {
+	if e.Patch != nil {
+		return c.Req().Patch(e.Patch).UrlFor("jobs", e.Job).FailFast().Do(nil)
+	}
+	return c.Req().Put(e.Log).UrlFor("jobs", e.Job, "log").FailFast().Do(nil)
+}
+
+// replay sends the spooled entries to dr-provision in order, removing
+// each one once it has been sent.  Entries that dr-provision rejects
+// are dropped, as sending them again would not help.  It stops at the
+// first entry that cannot be sent because dr-provision cannot be
+// reached.  The caller must hold mux.
+func (s *spool) replay(c *api.Client) error {
+	names, err := s.pending()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		buf, err := ioutil.ReadFile(path.Join(s.dir, name))
+		if err != nil {
+			return err
+		}
+		e := &spoolEntry{}
+		if json.Unmarshal(buf, e) == nil {
+			if err := deliver(c, e); err != nil && retryable(err) {
+				s.retryAt = time.Now().Add(spoolRetry)
+				return err
+			}
+		}
+		if err := os.Remove(path.Join(s.dir, name)); err != nil {
+			return err
+		}
+		s.count--
+	}
+	return nil
+}
+
+// flush replays the spool, and fails if any of it could not be sent.
+func (s *spool) flush(c *api.Client) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.replay(c)
+}
+
+// send sends e to dr-provision, or spools it if dr-provision cannot
+// be reached or there are still older entries to replay.  It returns
+// whether e was spooled rather than sent.
+func (s *spool) send(c *api.Client, e *spoolEntry) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.active(e.Job)
+	if s.count > 0 {
+		if err := s.add(e); err != nil {
+			return false, err
+		}
+		if time.Now().After(s.retryAt) {
+			s.replay(c)
+		}
+		return true, nil
+	}
+	err := deliver(c, e)
+	if err == nil || !retryable(err) {
+		return false, err
+	}
+	s.retryAt = time.Now().Add(spoolRetry)
+	return true, s.add(e)
+}
+
+// active records that the agent just did something for the Job.  It
+// is called for every job log chunk, so activity for the same Job is
+// written at most once every activityInterval.  The caller must hold
+// mux.
+func (s *spool) active(job string) {
+	now := time.Now()
+	if job == s.activity.Job && now.Sub(s.activity.Time) < activityInterval {
+		return
+	}
+	act := spoolActivity{Job: job, Time: now}
+	if s.writeFile("activity", &act) == nil {
+		s.activity = act
+	}
+}
+
+// lastActive returns the last time the agent did anything for the
+// Job, or the zero time if it does not know of any.
+func (s *spool) lastActive(job string) time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	res := &spoolActivity{}
+	buf, err := ioutil.ReadFile(path.Join(s.dir, "activity"))
+	if err != nil || json.Unmarshal(buf, res) != nil || res.Job != job {
+		return time.Time{}
+	}
+	return res.Time
+}
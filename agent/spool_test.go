@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/api"
+	"github.com/digitalrebar/provision/models"
+)
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection refused"), true},
+		{&models.Error{Code: http.StatusBadRequest}, false},
+		{&models.Error{Code: http.StatusNotFound}, false},
+		{&models.Error{Code: http.StatusConflict}, false},
+		{&models.Error{Code: http.StatusRequestTimeout}, true},
+		{&models.Error{Code: http.StatusTooManyRequests}, true},
+		{&models.Error{Code: http.StatusInternalServerError}, true},
+		{&models.Error{Code: http.StatusServiceUnavailable}, true},
+	} {
+		if got := retryable(tc.err); got != tc.want {
+			t.Errorf("Expected retryable(%v) to be %v, not %v", tc.err, tc.want, got)
+		}
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool-")
+	if err != nil {
+		t.Fatalf("Failed to create tmpdir for spool: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := openSpool(path.Join(dir, "machine.spool"))
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	job := "3e7031fe-3062-45f1-835c-92541bc9cbd3"
+	if !s.lastActive(job).IsZero() {
+		t.Errorf("Expected a new spool to know of no activity")
+	}
+
+	// Nothing is listening here, so everything gets spooled.
+	down, _ := api.TokenSession("https://127.0.0.1:1", "token")
+	defer down.Close()
+	entries := []*spoolEntry{
+		{Job: job, Log: []byte("first\n")},
+		{Job: job, Log: []byte("second\n")},
+		{Job: job, Patch: jsonpatch2.Patch{{Op: "replace", Path: "/State", Value: "finished"}}},
+	}
+	for i, e := range entries {
+		spooled, err := s.send(down, e)
+		if err != nil || !spooled {
+			t.Fatalf("Expected entry %d to be spooled, not %v: %v", i, spooled, err)
+		}
+	}
+	if since := time.Since(s.lastActive(job)); since > time.Minute {
+		t.Errorf("Expected recent activity for %s, not %s ago", job, since)
+	}
+	if !s.lastActive("other").IsZero() {
+		t.Errorf("Expected no activity for another job")
+	}
+	if err := s.flush(down); err == nil {
+		t.Errorf("Expected flush to fail while the server cannot be reached")
+	}
+
+	// The spool survives being reopened, and keeps its order.
+	s, err = openSpool(path.Join(dir, "machine.spool"))
+	if err != nil {
+		t.Fatalf("Failed to reopen spool: %v", err)
+	}
+	names, err := s.pending()
+	if err != nil || len(names) != len(entries) {
+		t.Fatalf("Expected %d spooled entries, not %v: %v", len(entries), names, err)
+	}
+	if s.next != uint64(len(entries)) || s.count != len(entries) {
+		t.Errorf("Expected the next entry to be %d with %d pending, not %d with %d", len(entries), len(entries), s.next, s.count)
+	}
+	for i, name := range names {
+		buf, _ := ioutil.ReadFile(path.Join(s.dir, name))
+		e := &spoolEntry{}
+		if err := json.Unmarshal(buf, e); err != nil || e.Job != job || string(e.Log) != string(entries[i].Log) || len(e.Patch) != len(entries[i].Patch) {
+			t.Errorf("Expected entry %d to be %v, not %v: %v", i, entries[i], e, err)
+		}
+	}
+
+	// The server rejects updates to a Job it does not have, so they
+	// are dropped rather than retried.
+	up, err := api.UserSession("https://127.0.0.1:10001", "rocketskates", "r0cketsk8ts")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	defer up.Close()
+	if err := s.flush(up); err != nil {
+		t.Errorf("Expected flush to succeed, not %v", err)
+	}
+	if names, _ = s.pending(); len(names) != 0 || s.count != 0 {
+		t.Errorf("Expected an empty spool, not %v", names)
+	}
+	if spooled, err := s.send(up, &spoolEntry{Job: job, Log: []byte("third\n")}); spooled || err == nil {
+		t.Errorf("Expected a rejected entry to not be spooled, not %v: %v", spooled, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -26,21 +27,56 @@ func jobLog(c *api.Client, j *models.Job, dst io.Writer) error {
 }
 
 // jobActions returns the expanded list of templates that should be
-// written or executed for a specific Job.
-func jobActions(c *api.Client, j *models.Job, targetOS string) (models.JobActions, error) {
+// written or executed for a specific Job, signed by the server if
+// signed is set.
+func jobActions(c *api.Client, j *models.Job, targetOS string, signed bool) (models.JobActions, error) {
 	res := models.JobActions{}
 	req := c.Req().UrlFor("jobs", j.Key(), "actions")
 	if targetOS != "" {
 		req.Params("os", targetOS)
 	}
+	if signed {
+		req.Params("signed", "true")
+	}
 	return res, req.Do(&res)
 }
 
+// jobMembers returns the Jobs in the parallel task group of j.
+func jobMembers(c *api.Client, j *models.Job) ([]*models.Job, error) {
+	res := []*models.Job{}
+	return res, c.Req().UrlFor("jobs", j.Key(), "members").Do(&res)
+}
+
 // runner is responsible for expanding templates and running
 // scripts for a single task.
 type runner struct {
 	// Status codes that may be returned when a script exits.
 	failed, incomplete, reboot, poweroff, stop, wantChroot bool
+	// Set when the Job ran past its Timeout.
+	timedOut bool
+	// When the Job must be finished by, if it has a Timeout.
+	deadline time.Time
+	// The exit code of the last script that was run.
+	exitCode int
+	// Set when the ExitCodeMap of the Task says the exit code of a
+	// script means the Job should be retried.
+	wantsRetry bool
+	// Set when the Job failed and the Task's RetryPolicy says it
+	// should be retried after retryDelay.
+	retrying   bool
+	retryDelay time.Duration
+	// The runners for the Jobs in a parallel task group, if the Job
+	// is for one.
+	members []*runner
+	// Set when the runner is a member of a parallel task group.
+	inGroup bool
+	// The public key that actions must be signed with, and whether
+	// unsigned actions are refused.
+	actionKey     *[32]byte
+	requireSigned bool
+	// The spool that job log chunks and state transitions go through
+	// while dr-provision cannot be reached, if there is one.
+	spool *spool
 	// Client that the TaskRunner will use to communicate with the API
 	c *api.Client
 	// The Job that the TaskRunner will log to and update the status of.
@@ -57,6 +93,12 @@ type runner struct {
 	pipeWriter                  net.Conn
 	agentDir, jobDir, chrootDir string
 	logger                      io.Writer
+	// The cgroup that the sandbox of the Task limits the running
+	// command with, if there is one.
+	cgroup string
+	// The pipe that holds the command back until it has been moved
+	// into cgroup.
+	gateR, gateW *os.File
 }
 
 // newRunner creates a new TaskRunner for the passed-in machine.
@@ -87,6 +129,28 @@ func newRunner(c *api.Client, m *models.Machine, agentDir, chrootDir string, log
 		res.wantChroot = true
 		return res, nil
 	}
+	if models.ParallelTasks(job.Task) != nil {
+		jobs, err := jobMembers(c, job)
+		if err != nil {
+			return nil, err
+		}
+		for _, mj := range jobs {
+			t := &models.Task{Name: mj.Task}
+			if err := c.Req().Fill(t); err != nil {
+				return nil, err
+			}
+			res.members = append(res.members, &runner{
+				c:        c,
+				m:        m,
+				j:        mj,
+				t:        t,
+				agentDir: agentDir,
+				logger:   logger,
+				inGroup:  true,
+			})
+		}
+		return res, nil
+	}
 	if !strings.Contains(job.Task, ":") {
 		t := &models.Task{Name: job.Task}
 		if err := c.Req().Fill(t); err != nil {
@@ -97,6 +161,49 @@ func newRunner(c *api.Client, m *models.Machine, agentDir, chrootDir string, log
 	return res, nil
 }
 
+// pinActionKey sets the key that the runner and the members of its
+// parallel task group verify actions with.
+func (r *runner) pinActionKey(key *[32]byte, require bool) {
+	r.actionKey, r.requireSigned = key, require
+	for _, member := range r.members {
+		member.pinActionKey(key, require)
+	}
+}
+
+// spoolTo sets the spool that the runner and the members of its
+// parallel task group send their job updates through.
+func (r *runner) spoolTo(s *spool) {
+	r.spool = s
+	for _, member := range r.members {
+		member.spoolTo(s)
+	}
+}
+
+// verify checks the signatures of the actions against the pinned
+// action key before any of them are written or run.  actions must be
+// the whole list that was rendered for the Job, since each signature
+// also covers where the action is in it.  Actions with a bad
+// signature are always refused, and unsigned actions are refused if
+// signing is required.
+func (r *runner) verify(actions models.JobActions) error {
+	if r.actionKey == nil {
+		if r.requireSigned {
+			return fmt.Errorf("Signed actions are required, but no action key is pinned")
+		}
+		return nil
+	}
+	for i, action := range actions {
+		if len(action.Signature) == 0 && !r.requireSigned {
+			r.log("Action %s is not signed", action.Name)
+			continue
+		}
+		if err := action.Verify(r.j.Uuid, i, len(actions), r.actionKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Close() shuts down the writer side of the logging pipe.
 // This will also flush any remaining data to stderr
 func (r *runner) Close() {
@@ -185,17 +292,54 @@ func (r *runner) perform(action *models.JobAction, taskDir string) error {
 		r.log("Command failed to set up chroot: %v", err)
 		return err
 	}
-	r.log("Starting command %s\n\n", cmd.Path)
+	cmdPath := cmd.Path
+	if err := r.enterSandbox(cmd); err != nil {
+		r.exitChroot()
+		r.log("Command failed to set up sandbox: %v", err)
+		return err
+	}
+	setProcGroup(cmd)
+	r.log("Starting command %s\n\n", cmdPath)
 	if err := cmd.Start(); err != nil {
+		r.exitSandbox()
+		r.exitChroot()
 		r.log("Command failed to start: %v", err)
 		return err
 	}
+	if err := r.joinSandbox(cmd); err != nil {
+		r.log("Command failed to join sandbox: %v", err)
+		killProcGroup(cmd)
+		cmd.Process.Wait()
+		r.exitSandbox()
+		r.exitChroot()
+		return err
+	}
+	// If the Job has a deadline, kill the command and everything
+	// it started when the deadline passes.
+	var timer *time.Timer
+	killed := make(chan struct{})
+	if !r.deadline.IsZero() {
+		timer = time.AfterFunc(time.Until(r.deadline), func() {
+			defer close(killed)
+			r.log("Job timed out, killing command")
+			if err := killProcGroup(cmd); err != nil {
+				r.log("Failed to kill command: %v", err)
+			}
+		})
+	}
 	// Wait on the process, not the command to exit.
 	// We don't want to auto-close stdout and stderr,
 	// as we will continue to use them.
 	r.log("Command running")
 	pState, _ := cmd.Process.Wait()
+	r.exitSandbox()
 	r.exitChroot()
+	if timer != nil && !timer.Stop() {
+		<-killed
+		r.timedOut = true
+		r.failed = true
+		return nil
+	}
 	status := pState.Sys().(syscall.WaitStatus)
 	sane := r.t.HasFeature("sane-exit-codes")
 	if !sane {
@@ -203,8 +347,28 @@ func (r *runner) perform(action *models.JobAction, taskDir string) error {
 		sane = err == nil && st.Mode().IsRegular()
 	}
 	code := uint(status.ExitStatus())
+	r.exitCode = int(code)
 	r.log("Command exited with status %d", code)
-	if sane {
+	if outcomes, ok := r.t.ExitOutcomes(r.exitCode); ok {
+		r.log("Exit code %d means %s for task %s", code, strings.Join(outcomes, ","), r.t.Name)
+		for _, outcome := range outcomes {
+			switch outcome {
+			case "failed":
+				r.failed = true
+			case "retry":
+				r.failed = true
+				r.wantsRetry = true
+			case "incomplete":
+				r.incomplete = true
+			case "reboot":
+				r.reboot = true
+			case "poweroff":
+				r.poweroff = true
+			case "stop":
+				r.stop = true
+			}
+		}
+	} else if sane {
 		switch code {
 		case 0:
 		case 16:
@@ -244,30 +408,9 @@ func (r *runner) perform(action *models.JobAction, taskDir string) error {
 	return nil
 }
 
-// run loops over all of the actions for a particular job,
-// placing files and executing scripts as appropriate.
-// It also arranges for all logging output for the actions
-// to go to the right places.
-func (r *runner) run() error {
-	finalErr := &models.Error{
-		Type:  "RUNNER_ERR",
-		Model: r.j.Prefix(),
-		Key:   r.j.Key(),
-	}
-	if r.t == nil {
-		// no task, return based on the state of the job.
-		// These are actions that are handled on the server side
-		switch r.j.State {
-		case "created", "incomplete":
-			finalErr.Errorf("Invalid job state returned: %v", r.j.State)
-		case "running":
-			finalErr.Errorf("Job %s running somewhere else: %v", r.j.Key(), r.j.State)
-		case "failed":
-			r.failed = true
-		}
-		return finalErr.HasError()
-	}
-
+// startLog arranges for everything logged by the runner to go to
+// the Job log and to the local logger.
+func (r *runner) startLog() {
 	jKey := r.j.Key()
 	// Arrange to log everything to the job log and stderr at the same time.
 	// Due to how io.Pipe works, this should wind up being fairly synchronous.
@@ -275,7 +418,6 @@ func (r *runner) run() error {
 
 	r.in = io.MultiWriter(writer, r.logger)
 	r.pipeWriter = writer
-	helperWritten := false
 
 	go func() {
 		defer reader.Close()
@@ -289,7 +431,13 @@ func (r *runner) run() error {
 				continue
 			}
 			if pos > 0 {
-				if r.c.Req().Put(buf[:pos]).UrlFor("jobs", jKey, "log").Do(nil) != nil {
+				if r.spool != nil {
+					// buf is reused, so the spool gets its own copy.
+					chunk := &spoolEntry{Job: jKey, Log: append([]byte{}, buf[:pos]...)}
+					if _, err := r.spool.send(r.c, chunk); err != nil && !retryable(err) {
+						return
+					}
+				} else if r.c.Req().Put(buf[:pos]).UrlFor("jobs", jKey, "log").Do(nil) != nil {
 					return
 				}
 				pos = 0
@@ -303,6 +451,111 @@ func (r *runner) run() error {
 			}
 		}
 	}()
+}
+
+// finish patches the Job to its final state, and marks the machine
+// as not runnable if it should not carry on to the next Job.
+func (r *runner) finish(finalState string) {
+	exitState := "complete"
+	if finalState == "failed" {
+		exitState = "failed"
+		if r.wantsRetry {
+			exitState = "retry"
+		}
+	}
+	if r.timedOut {
+		// Whatever the last script exited with has nothing to do
+		// with why the Job failed.
+		exitState = "timeout"
+		r.exitCode = models.JobTimeoutExitCode
+	} else if r.reboot {
+		exitState = "reboot"
+	} else if r.poweroff {
+		exitState = "poweroff"
+	} else if r.stop {
+		exitState = "stop"
+	}
+	done := models.Clone(r.j).(*models.Job)
+	done.State = finalState
+	done.ExitState = exitState
+	done.ExitCode = r.exitCode
+	// Members of a parallel task group leave the machine alone, and
+	// let the group's Job decide what happens to it.  They are
+	// retried within the group instead.
+	if r.t != nil && r.t.ShouldRetry(done) {
+		r.retrying = true
+		r.retryDelay = r.t.RetryDelay(done)
+		if r.inGroup {
+			r.log("Attempt %d of %d failed, retrying in %s", done.Attempt, r.t.Retry.MaxAttempts, r.retryDelay)
+		} else {
+			r.log("Attempt %d of %d failed, leaving machine %s runnable", done.Attempt, r.t.Retry.MaxAttempts, r.m.Name)
+		}
+	} else if !r.inGroup && (r.failed || r.reboot || r.stop || r.poweroff || r.incomplete) {
+		newM := models.Clone(r.m).(*models.Machine)
+		newM.Runnable = false
+		if err := r.c.Req().PatchTo(r.m, newM).Do(&newM); err == nil {
+			r.log("Marked machine %s as not runnable", r.m.Name)
+			r.m = newM
+		} else {
+			r.log("Failed to mark machine %s as not runnable: %v", r.m.Name, err)
+		}
+	}
+	finalPatch := jsonpatch2.Patch{
+		{Op: "test", Path: "/State", Value: "running"},
+		{Op: "replace", Path: "/State", Value: finalState},
+		{Op: "replace", Path: "/ExitState", Value: exitState},
+		{Op: "replace", Path: "/ExitCode", Value: r.exitCode},
+	}
+	if r.spool != nil {
+		spooled, err := r.spool.send(r.c, &spoolEntry{Job: r.j.Key(), Patch: finalPatch})
+		switch {
+		case err != nil:
+			r.log("Failed to update job %s:%s:%s to its final state %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
+		case spooled:
+			r.log("Spooled the update of job for %s:%s:%s to %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
+			r.j = done
+		default:
+			r.c.Req().Fill(r.j)
+			r.log("Updated job for %s:%s:%s to %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
+		}
+		return
+	}
+	if err := r.c.Req().Patch(finalPatch).UrlForM(r.j).Do(&r.j); err != nil {
+		r.log("Failed to update job %s:%s:%s to its final state %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
+	} else {
+		r.log("Updated job for %s:%s:%s to %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
+	}
+}
+
+// run loops over all of the actions for a particular job,
+// placing files and executing scripts as appropriate.
+// It also arranges for all logging output for the actions
+// to go to the right places.
+func (r *runner) run() error {
+	finalErr := &models.Error{
+		Type:  "RUNNER_ERR",
+		Model: r.j.Prefix(),
+		Key:   r.j.Key(),
+	}
+	if r.members != nil {
+		return r.runGroup()
+	}
+	if r.t == nil {
+		// no task, return based on the state of the job.
+		// These are actions that are handled on the server side
+		switch r.j.State {
+		case "created", "incomplete":
+			finalErr.Errorf("Invalid job state returned: %v", r.j.State)
+		case "running":
+			finalErr.Errorf("Job %s running somewhere else: %v", r.j.Key(), r.j.State)
+		case "failed":
+			r.failed = true
+		}
+		return finalErr.HasError()
+	}
+
+	r.startLog()
+	helperWritten := false
 	// We are responsible for going from created to running.
 	// If this patch fails, we cannot do it
 	patch := jsonpatch2.Patch{
@@ -319,55 +572,32 @@ func (r *runner) run() error {
 	// No matter how the function exits, we will try to patch the Job
 	// to an appropriate final state.
 	defer os.RemoveAll(taskDir)
-	defer func() {
-		if r.failed || r.reboot || r.stop || r.poweroff || r.incomplete {
-			newM := models.Clone(r.m).(*models.Machine)
-			newM.Runnable = false
-			if err := r.c.Req().PatchTo(r.m, newM).Do(&newM); err == nil {
-				r.log("Marked machine %s as not runnable", r.m.Name)
-				r.m = newM
-			} else {
-				r.log("Failed to mark machine %s as not runnable: %v", r.m.Name, err)
-			}
-		}
-		exitState := "complete"
-		if finalState == "failed" {
-			exitState = "failed"
-		}
-		if r.reboot {
-			exitState = "reboot"
-		} else if r.poweroff {
-			exitState = "poweroff"
-		} else if r.stop {
-			exitState = "stop"
-		}
-		finalPatch := jsonpatch2.Patch{
-			{Op: "test", Path: "/State", Value: "running"},
-			{Op: "replace", Path: "/State", Value: finalState},
-			{Op: "replace", Path: "/ExitState", Value: exitState},
-		}
-		if err := r.c.Req().Patch(finalPatch).UrlForM(r.j).Do(&r.j); err != nil {
-			r.log("Failed to update job %s:%s:%s to its final state %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
-		} else {
-			r.log("Updated job for %s:%s:%s to %s", r.j.Workflow, r.j.Stage, r.j.Task, finalState)
-		}
-	}()
+	defer func() { r.finish(finalState) }()
 	obj, err := r.c.PatchModel(r.j.Prefix(), r.j.Key(), patch)
 	if err != nil {
 		finalErr.AddError(err)
 		return finalErr
 	}
 	r.j = obj.(*models.Job)
+	if r.j.Timeout > 0 {
+		r.deadline = time.Now().Add(time.Duration(r.j.Timeout) * time.Second)
+	}
 	r.log("Starting task %s:%s:%s on %s", r.j.Workflow, r.j.Stage, r.j.Task, r.m.Name)
 	// At this point, we are running.
-	var actions models.JobActions
-	if allActions, err := jobActions(r.c, r.j, runtime.GOOS); err != nil {
+	allActions, err := jobActions(r.c, r.j, runtime.GOOS, r.actionKey != nil)
+	if err != nil {
 		r.log("Failed to render actions: %v", err)
 		finalErr.AddError(err)
 		return finalErr
-	} else {
-		actions = allActions.FilterOS(runtime.GOOS)
 	}
+	if err := r.verify(allActions); err != nil {
+		r.log("Refusing to run actions: %v", err)
+		r.failed = true
+		finalState = "failed"
+		finalErr.AddError(err)
+		return finalErr
+	}
+	actions := allActions.FilterOS(runtime.GOOS)
 	for i, action := range actions {
 		final := len(actions)-1 == i
 		r.failed = false
@@ -375,6 +605,13 @@ func (r *runner) run() error {
 		r.poweroff = false
 		r.reboot = false
 		r.stop = false
+		if !r.deadline.IsZero() && time.Now().After(r.deadline) {
+			r.log("Job timed out before action %s", action.Name)
+			r.timedOut = true
+			r.failed = true
+			finalState = "failed"
+			break
+		}
 		var err error
 		if action.Path != "" {
 			err = r.expand(action, taskDir)
@@ -423,3 +660,96 @@ func (r *runner) run() error {
 	r.log("Task %s %s", r.j.Task, finalState)
 	return nil
 }
+
+// retry puts the Job of a parallel task group member back in the
+// created state for its next attempt, so that it can be run again.
+func (r *runner) retry() error {
+	patch := jsonpatch2.Patch{
+		{Op: "test", Path: "/State", Value: "failed"},
+		{Op: "replace", Path: "/State", Value: "created"},
+		{Op: "replace", Path: "/Attempt", Value: r.j.Attempt + 1},
+	}
+	obj, err := r.c.PatchModel(r.j.Prefix(), r.j.Key(), patch)
+	if err != nil {
+		return err
+	}
+	// run starts a new log pipe for each attempt.
+	if r.pipeWriter != nil {
+		r.pipeWriter.Close()
+	}
+	r.j = obj.(*models.Job)
+	r.failed, r.incomplete, r.reboot, r.poweroff, r.stop = false, false, false, false, false
+	r.timedOut, r.wantsRetry, r.retrying = false, false, false
+	r.exitCode = 0
+	return nil
+}
+
+// runGroup runs the Jobs in a parallel task group at the same time,
+// each logging to its own Job, and then updates the group's Job.
+// The group only finishes if all of its members finish, and it wants
+// a reboot, poweroff, or stop if any of its members do.
+func (r *runner) runGroup() error {
+	finalErr := &models.Error{
+		Type:  "RUNNER_ERR",
+		Model: r.j.Prefix(),
+		Key:   r.j.Key(),
+	}
+	r.startLog()
+	patch := jsonpatch2.Patch{
+		{Op: "test", Path: "/State", Value: r.j.State},
+		{Op: "replace", Path: "/State", Value: "running"},
+	}
+	obj, err := r.c.PatchModel(r.j.Prefix(), r.j.Key(), patch)
+	if err != nil {
+		finalErr.AddError(err)
+		return finalErr
+	}
+	r.j = obj.(*models.Job)
+	r.log("Starting %d tasks in parallel for %s:%s on %s", len(r.members), r.j.Workflow, r.j.Stage, r.m.Name)
+	errs := make([]error, len(r.members))
+	wg := &sync.WaitGroup{}
+	for i, member := range r.members {
+		if member.j.State == "finished" {
+			r.log("Task %s already finished", member.j.Task)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, member *runner) {
+			defer wg.Done()
+			defer member.Close()
+			for {
+				errs[i] = member.run()
+				if !member.retrying {
+					return
+				}
+				time.Sleep(member.retryDelay)
+				if err := member.retry(); err != nil {
+					member.log("Failed to retry task %s: %v", member.j.Task, err)
+					return
+				}
+			}
+		}(i, member)
+	}
+	wg.Wait()
+	for i, member := range r.members {
+		if errs[i] != nil {
+			r.log("Task %s failed: %v", member.j.Task, errs[i])
+			member.failed = true
+		}
+		r.failed = r.failed || member.failed
+		r.timedOut = r.timedOut || member.timedOut
+		r.incomplete = r.incomplete || member.incomplete
+		r.reboot = r.reboot || member.reboot
+		r.poweroff = r.poweroff || member.poweroff
+		r.stop = r.stop || member.stop
+	}
+	finalState := "finished"
+	if r.failed {
+		finalState = "failed"
+	} else if r.incomplete {
+		finalState = "incomplete"
+	}
+	r.log("Parallel tasks %s", finalState)
+	r.finish(finalState)
+	return nil
+}
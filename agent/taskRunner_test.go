@@ -452,3 +452,145 @@ Tasks:
 	}
 
 }
+
+func TestParallelGroup(t *testing.T) {
+	tjd, err := ioutil.TempDir("", "groupTest-")
+	if err != nil {
+		t.Fatalf("Failed to create tmpdir for group tester: %v", err)
+	}
+	defer os.RemoveAll(tjd)
+	os.Setenv("JT", tjd)
+	if session == nil {
+		session, err = api.UserSession("https://127.0.0.1:10001", "rocketskates", "r0cketsk8ts")
+		if err != nil {
+			t.Fatalf("Error creating session: %v", err)
+		}
+		defer func() { session = nil }()
+	}
+	objs := []models.Model{
+		mustDecode(&models.Task{}, `
+Name: grouptoken
+Templates:
+  - Name: token
+    Path: token
+    Contents: '{{.GenerateInfiniteToken}}'
+`).(*models.Task),
+		mustDecode(&models.Task{}, `
+Name: groupok
+Meta:
+  feature-flags: sane-exit-codes
+Templates:
+  - Name: ok
+    Contents: |
+      #!/usr/bin/env bash
+      exit 0
+`).(*models.Task),
+		mustDecode(&models.Task{}, `
+Name: groupflaky
+Meta:
+  feature-flags: sane-exit-codes
+Retry:
+  MaxAttempts: 2
+Templates:
+  - Name: flaky
+    Contents: |
+      #!/usr/bin/env bash
+      [[ -e "$JT"/flaky.txt ]] && exit 0
+      touch "$JT"/flaky.txt
+      exit 1
+`).(*models.Task),
+		mustDecode(&models.Stage{}, `
+Name: groupstage
+Tasks:
+  - parallel:groupok,groupflaky
+`).(*models.Stage),
+	}
+	for _, obj := range objs {
+		if err := session.CreateModel(obj); err != nil {
+			t.Fatalf("Failed to create %s %s: %v", obj.Prefix(), obj.Key(), err)
+		}
+		defer session.Req().Delete(obj)
+	}
+	machine := mustDecode(&models.Machine{}, `
+Address: 192.168.100.111
+BootEnv: local
+Name: grouped
+Runnable: true
+Uuid: 5d4c6fb9-6d1b-4b5b-9ae6-3b8ee0e6e0c1
+`).(*models.Machine)
+	if err := session.CreateModel(machine); err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	defer func() {
+		session.Req().Delete(machine)
+		jobs := []*models.Job{}
+		session.Req().Filter("jobs", "Machine", "Eq", machine.Key()).Do(&jobs)
+		for _, job := range jobs {
+			session.Req().Delete(job)
+		}
+	}()
+	mc := models.Clone(machine).(*models.Machine)
+	mc.Stage = "groupstage"
+	mc.Runnable = true
+	if err := session.Req().PatchTo(machine, mc).Do(&mc); err != nil {
+		t.Fatalf("Failed to put machine in groupstage: %v", err)
+	}
+	machine = mc
+
+	// The agent runs with the same token that it gets on a real
+	// machine, which is not allowed to list jobs.
+	previews := []*models.RenderResult{}
+	if err := session.Req().UrlFor("machines", machine.Key(), "render").Params("task", "grouptoken").Do(&previews); err != nil {
+		t.Fatalf("Failed to render a machine token: %v", err)
+	}
+	token := ""
+	for _, p := range previews {
+		if p.Prefix == "tasks" && len(p.Files) == 1 {
+			token = p.Files[0].Content
+		}
+	}
+	if token == "" {
+		t.Fatalf("Failed to render a machine token: %v", previews)
+	}
+	msession, err := api.TokenSession("https://127.0.0.1:10001", token)
+	if err != nil {
+		t.Fatalf("Error creating machine session: %v", err)
+	}
+	defer msession.Close()
+
+	buf := &bytes.Buffer{}
+	agent, err := New(msession, machine, true, true, false, io.MultiWriter(buf, os.Stderr))
+	if err != nil {
+		t.Fatalf("Agent create failed: %v", err)
+	}
+	if err := agent.Timeout(1 * time.Second).Run(); err != nil {
+		t.Errorf("Agent run failed: %v", err)
+	}
+	t.Logf("Job log: \n---------------\n%s\n---------------\nEnd log\n", buf.String())
+	if err := session.FillModel(machine, machine.Key()); err != nil {
+		t.Fatalf("Failed to fetch machine: %v", err)
+	}
+	group := &models.Job{Uuid: machine.CurrentJob}
+	if err := msession.FillModel(group, group.Key()); err != nil {
+		t.Fatalf("Failed to fetch the group job: %v", err)
+	}
+	if group.Task != "parallel:groupok,groupflaky" || group.State != "finished" {
+		t.Errorf("Expected the group job to be finished, not %s:%s", group.Task, group.State)
+	}
+	members, err := jobMembers(msession, group)
+	if err != nil {
+		t.Fatalf("Failed to list the group members with a machine token: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 members in the group, not %d", len(members))
+	}
+	for _, member := range members {
+		attempts := 1
+		if member.Task == "groupflaky" {
+			attempts = 2
+		}
+		if member.State != "finished" || member.Attempt != attempts {
+			t.Errorf("Expected %s to finish on attempt %d, not %s on attempt %d", member.Task, attempts, member.State, member.Attempt)
+		}
+	}
+}
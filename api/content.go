@@ -31,6 +31,14 @@ func (c *Client) ReplaceContent(content *models.Content) (*models.ContentSummary
 	return res, c.Req().Put(content).UrlFor("contents", content.Meta.Name).Do(res)
 }
 
+// TestContent has the server run tests against content in a scratch
+// data stack, and returns the results.
+func (c *Client) TestContent(content *models.Content, tests []*models.TemplateTest) (*models.TemplateTestReport, error) {
+	res := &models.TemplateTestReport{}
+	run := &models.TemplateTestRun{Content: content, Tests: tests}
+	return res, c.Req().Post(run).UrlFor("contents", "test").Do(res)
+}
+
 func (c *Client) DeleteContent(name string) error {
 	return c.Req().Del().UrlFor("contents", name).Do(nil)
 }
@@ -92,6 +100,12 @@ func (c *Client) BundleContent(src string, dst store.Store, params map[string]st
 		}
 		prefix := f.Name()
 
+		if prefix == models.TemplateTestSection {
+			if err := bundleTests(path.Join(src, prefix), dst); err != nil {
+				return err
+			}
+			continue
+		}
 		if _, err := models.New(prefix); err != nil {
 			// Skip things we can instantiate
 			continue
@@ -139,6 +153,63 @@ func (c *Client) BundleContent(src string, dst store.Store, params map[string]st
 	return nil
 }
 
+// ReadTemplateTests reads the TemplateTests in the directory src.
+// Each YAML or JSON file in it holds a single test, and tests that do
+// not have a Name are named after their file.
+func ReadTemplateTests(src string) ([]*models.TemplateTest, error) {
+	items, err := ioutil.ReadDir(src)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read tests from %s: %v", src, err)
+	}
+	res := []*models.TemplateTest{}
+	for _, fileInfo := range items {
+		if fileInfo.IsDir() {
+			continue
+		}
+		itemName := fileInfo.Name()
+		buf, err := ioutil.ReadFile(path.Join(src, itemName))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read test %s: %v", itemName, err)
+		}
+		test := &models.TemplateTest{}
+		switch path.Ext(itemName) {
+		case ".yaml", ".yml":
+			err = store.YamlCodec.Decode(buf, test)
+		case ".json":
+			err = store.JsonCodec.Decode(buf, test)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse test %s: %v", itemName, err)
+		}
+		if test.Name == "" {
+			test.Name = strings.TrimSuffix(itemName, path.Ext(itemName))
+		}
+		res = append(res, test)
+	}
+	return res, nil
+}
+
+// bundleTests saves the TemplateTests in src into the tests section
+// of dst.
+func bundleTests(src string, dst store.Store) error {
+	tests, err := ReadTemplateTests(src)
+	if err != nil {
+		return err
+	}
+	sub, err := dst.MakeSub(models.TemplateTestSection)
+	if err != nil {
+		return fmt.Errorf("Cannot make substore %s: %v", models.TemplateTestSection, err)
+	}
+	for _, test := range tests {
+		if err := sub.Save(test.Name, test); err != nil {
+			return fmt.Errorf("Failed to save test %s: %v", test.Name, err)
+		}
+	}
+	return nil
+}
+
 func writeMetaFile(dst, field, data string) error {
 	if data == "" {
 		return nil
@@ -173,7 +244,12 @@ func (c *Client) UnbundleContent(content store.Store, dst string) error {
 		}
 		codec := content.GetCodec()
 		for _, key := range keys {
-			item, _ := models.New(prefix)
+			var item interface{}
+			if prefix == models.TemplateTestSection {
+				item = &models.TemplateTest{}
+			} else {
+				item, _ = models.New(prefix)
+			}
 			if err := sub.Load(key, item); err != nil {
 				return fmt.Errorf("Failed to load %s:%s: %v", prefix, key, err)
 			}
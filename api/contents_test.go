@@ -1,16 +1,95 @@
 package api
 
 import (
+	"io/ioutil"
 	"log"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/store"
 )
 
+func TestContentTemplateTestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content-tests-")
+	if err != nil {
+		t.Fatalf("Failed to create tmpdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "src")
+	files := map[string]string{
+		"templates/hello.tmpl": "hello {{.Machine.Name}}\n",
+		"tests/hello.yaml":     "Description: renders hello\nExpect:\n  - Name: hello.tmpl\n    Content: \"hello test\\n\"\n",
+		"tests/named.json":     `{"Name":"other","Task":"hello"}`,
+	}
+	for name, body := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(src, name)), 0750); err != nil {
+			t.Fatalf("Failed to make %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path.Join(src, name), []byte(body), 0640); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	cc := &Client{}
+	bundle := path.Join(dir, "bundle.yaml")
+	s, err := store.Open("file:" + bundle + "?codec=yaml")
+	if err != nil {
+		t.Fatalf("Failed to open bundle store: %v", err)
+	}
+	if err := cc.BundleContent(src, s, map[string]string{"Name": "tested"}); err != nil {
+		t.Fatalf("Failed to bundle: %v", err)
+	}
+	s.Close()
+
+	buf, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	content := &models.Content{}
+	if err := DecodeYaml(buf, content); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	tests, err := content.TemplateTests()
+	if err != nil {
+		t.Fatalf("Failed to get tests from bundle: %v", err)
+	}
+	if len(tests) != 2 || tests[0].Name != "hello" || tests[1].Name != "other" {
+		t.Fatalf("Expected tests hello and other in the bundle, not %v", tests)
+	}
+	if len(tests[0].Expect) != 1 || tests[0].Expect[0].Content != "hello test\n" || tests[1].Task != "hello" {
+		t.Errorf("Expected the bundled tests to keep their contents, not %v and %v", tests[0], tests[1])
+	}
+
+	ms, _ := store.Open("memory:///")
+	defer ms.Close()
+	if err := content.ToStore(ms); err != nil {
+		t.Fatalf("Failed to load bundle: %v", err)
+	}
+	dst := path.Join(dir, "dst")
+	if err := cc.UnbundleContent(ms, dst); err != nil {
+		t.Fatalf("Failed to unbundle: %v", err)
+	}
+	unbundled, err := ReadTemplateTests(path.Join(dst, models.TemplateTestSection))
+	if err != nil {
+		t.Fatalf("Failed to read unbundled tests: %v", err)
+	}
+	if len(unbundled) != len(tests) {
+		t.Fatalf("Expected %d unbundled tests, not %v", len(tests), unbundled)
+	}
+	for i := range tests {
+		want, got := tests[i], unbundled[i]
+		if got.Name != want.Name || got.Description != want.Description || got.Task != want.Task || len(got.Expect) != len(want.Expect) {
+			t.Errorf("Expected unbundled test %v, not %v", want, got)
+		}
+	}
+}
+
 func TestContentCrud(t *testing.T) {
 	summary := `
 - Counts:
     bootenvs: 0
+    inventories: 0
     jobs: 0
     leases: 0
     machines: 0
@@ -20,6 +99,8 @@ func TestContentCrud(t *testing.T) {
     profiles: 1
     reservations: 0
     roles: 0
+    rollouts: 0
+    schedules: 0
     stages: 0
     subnets: 0
     tasks: 0
@@ -78,7 +159,7 @@ func TestContentCrud(t *testing.T) {
 - Counts:
     bootenvs: 2
     roles: 1
-    params: 1
+    params: 5
     stages: 2
   Warnings: []
   meta:
@@ -107,6 +188,7 @@ meta:
   Writable: true
 sections:
   bootenvs: {}
+  inventories: {}
   jobs: {}
   leases: {}
   machines: {}
@@ -184,6 +266,8 @@ sections:
       Validated: false
   reservations: {}
   roles: {}
+  rollouts: {}
+  schedules: {}
   stages: {}
   subnets: {}
   tasks: {}
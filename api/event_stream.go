@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"reflect"
@@ -91,6 +92,12 @@ func (c *Client) ws() (*websocket.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	return c.dialWs(ep)
+}
+
+// dialWs opens a websocket to ep, authenticating the same way as the
+// rest of the Client does.
+func (c *Client) dialWs(ep *url.URL) (*websocket.Conn, error) {
 	ep.Scheme = "wss"
 	dialer := &websocket.Dialer{
 		Proxy:           http.ProxyFromEnvironment,
@@ -110,6 +110,7 @@ func TestInfo(t *testing.T) {
 					"delete": {},
 					"get":    {},
 					"list":   {},
+					"test":   {},
 					"update": {},
 				},
 				"files": {
@@ -130,6 +131,15 @@ func TestInfo(t *testing.T) {
 					"list":    {},
 					"update":  {},
 				},
+				"inventories": {
+					"action":  {},
+					"actions": {},
+					"create":  {},
+					"delete":  {},
+					"get":     {},
+					"list":    {},
+					"update":  {},
+				},
 				"isos": {
 					"delete": {},
 					"get":    {},
@@ -158,11 +168,16 @@ func TestInfo(t *testing.T) {
 				"machines": {
 					"action":         {},
 					"actions":        {},
+					"console":        {},
+					"coordinate":     {},
 					"create":         {},
 					"delete":         {},
 					"get":            {},
 					"getSecure":      {},
+					"heartbeat":      {},
+					"inventory":      {},
 					"list":           {},
+					"render":         {},
 					"update":         {},
 					"updateSecure":   {},
 					"updateTaskList": {},
@@ -232,6 +247,24 @@ func TestInfo(t *testing.T) {
 					"list":    {},
 					"update":  {},
 				},
+				"rollouts": {
+					"action":  {},
+					"actions": {},
+					"create":  {},
+					"delete":  {},
+					"get":     {},
+					"list":    {},
+					"update":  {},
+				},
+				"schedules": {
+					"action":  {},
+					"actions": {},
+					"create":  {},
+					"delete":  {},
+					"get":     {},
+					"list":    {},
+					"update":  {},
+				},
 				"stages": {
 					"action":       {},
 					"actions":      {},
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// FollowJobLog copies the log of the Job with the passed-in UUID to
+// dst as it is written, starting at offset, until the Job has finished
+// or failed.  If the connection to the server is lost, FollowJobLog
+// reconnects and resumes from where it left off as long as it made
+// progress since the last time it connected.  It returns the offset
+// it read up to.
+func (c *Client) FollowJobLog(id string, offset int64, dst io.Writer) (int64, error) {
+	for {
+		start := offset
+		done, err := c.followJobLog(id, &offset, dst)
+		if done || (err != nil && offset == start) {
+			return offset, err
+		}
+	}
+}
+
+// followJobLog reads the log of the Job over a single websocket.
+func (c *Client) followJobLog(id string, offset *int64, dst io.Writer) (bool, error) {
+	ep, err := c.UrlFor("jobs", id, "log", "ws")
+	if err != nil {
+		return false, err
+	}
+	ep.RawQuery = "offset=" + strconv.FormatInt(*offset, 10)
+	conn, err := c.dialWs(ep)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return false, err
+		}
+		res := &models.Error{}
+		if err := json.Unmarshal(msg, res); err == nil && res.Code != 0 {
+			return false, res
+		}
+		chunk := &models.JobLogChunk{}
+		if err := json.Unmarshal(msg, chunk); err != nil {
+			return false, err
+		}
+		if chunk.Offset != *offset {
+			// The server dropped some of the log, so start over
+			// from where we are.
+			return false, fmt.Errorf("Expected log offset %d, got %d", *offset, chunk.Offset)
+		}
+		if len(chunk.Data) > 0 {
+			if _, err := dst.Write(chunk.Data); err != nil {
+				return true, err
+			}
+			*offset += int64(len(chunk.Data))
+		}
+		if chunk.Done {
+			return true, nil
+		}
+	}
+}
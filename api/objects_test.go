@@ -9,6 +9,7 @@ func TestObject(t *testing.T) {
 		name: "get objects",
 		expectRes: []string{
 			"bootenvs",
+			"inventories",
 			"jobs",
 			"leases",
 			"machines",
@@ -18,6 +19,8 @@ func TestObject(t *testing.T) {
 			"profiles",
 			"reservations",
 			"roles",
+			"rollouts",
+			"schedules",
 			"stages",
 			"subnets",
 			"tasks",
@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"crypto/rand"
+	"os"
+
+	"github.com/digitalrebar/provision/models"
+	"golang.org/x/crypto/nacl/sign"
+)
+
+// actionKeyName is the name of the secret that holds the key that
+// JobActions are signed with.
+const actionKeyName = "system-actionkey"
+
+// actionKey returns the private key that JobActions are signed with,
+// generating it the first time it is needed.
+func (rt *RequestTracker) actionKey() (*[64]byte, error) {
+	rt.dt.secretsMux.Lock()
+	defer rt.dt.secretsMux.Unlock()
+	res := &[64]byte{}
+	var buf []byte
+	err := rt.dt.Secrets.Load(actionKeyName, &buf)
+	if err == nil && len(buf) == len(res) {
+		copy(res[:], buf)
+		return res, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	_, res, err = sign.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	rt.Infof("Generated a new key to sign job actions with")
+	return res, rt.dt.Secrets.Save(actionKeyName, res[:])
+}
+
+// ActionPublicKey returns the public key that agents can pin to
+// verify signed JobActions with.
+func (rt *RequestTracker) ActionPublicKey() ([]byte, error) {
+	key, err := rt.actionKey()
+	if err != nil {
+		return nil, err
+	}
+	// The public half of a nacl/sign private key is its last 32
+	// bytes.
+	return append([]byte{}, key[32:]...), nil
+}
+
+// SignActions signs the JobActions rendered for the Job with the
+// action key.  Each signature covers the position of the JobAction in
+// actions as well, so the list has to be verified as a whole.
+func (j *Job) SignActions(rt *RequestTracker, actions models.JobActions) error {
+	key, err := rt.actionKey()
+	if err != nil {
+		return err
+	}
+	for i, action := range actions {
+		action.Sign(j.Uuid, i, len(actions), key)
+	}
+	return nil
+}
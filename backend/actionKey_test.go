@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestActionKey(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger)
+	pub, err := rt.ActionPublicKey()
+	if err != nil || len(pub) != 32 {
+		t.Fatalf("Expected a 32 byte public key, not %v: %v", pub, err)
+	}
+	if again, err := rt.ActionPublicKey(); err != nil || !bytes.Equal(pub, again) {
+		t.Errorf("Expected the action key to be saved, not replaced: %v", err)
+	}
+	key := &[32]byte{}
+	copy(key[:], pub)
+
+	j := &Job{Job: &models.Job{Uuid: uuid.NewRandom()}}
+	actions := models.JobActions{
+		{Name: "script", Content: "#!/bin/bash\necho hi\n", Meta: map[string]string{"OS": "linux"}},
+		{Name: "file", Path: "/etc/motd", Content: "hello\n"},
+	}
+	if err := j.SignActions(rt, actions); err != nil {
+		t.Fatalf("Failed to sign actions: %v", err)
+	}
+	for i, action := range actions {
+		if err := action.Verify(j.Uuid, i, len(actions), key); err != nil {
+			t.Errorf("Expected action %s to verify: %v", action.Name, err)
+		}
+	}
+	if err := actions[0].Verify(uuid.NewRandom(), 0, len(actions), key); err == nil {
+		t.Errorf("Expected an action signed for another job to not verify")
+	}
+	if err := actions[1].Verify(j.Uuid, 0, len(actions), key); err == nil {
+		t.Errorf("Expected a reordered action to not verify")
+	}
+	if err := actions[0].Verify(j.Uuid, 0, 1, key); err == nil {
+		t.Errorf("Expected an action from a truncated list to not verify")
+	}
+	actions[1].Path = "/root/.ssh/authorized_keys"
+	if err := actions[1].Verify(j.Uuid, 1, len(actions), key); err == nil {
+		t.Errorf("Expected a changed action to not verify")
+	}
+	unsigned := &models.JobAction{Name: "unsigned", Content: "reboot"}
+	if err := unsigned.Verify(j.Uuid, 0, 1, key); err == nil {
+		t.Errorf("Expected an unsigned action to not verify")
+	}
+}
@@ -0,0 +1,157 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// The params that say how to reach the BMC of a Machine.  A Machine
+// with BMCDriverParam set has its power controlled out of band by the
+// server.  BMCPasswordParam is a secure param.
+const (
+	BMCDriverParam   = "bmc/driver"
+	BMCAddressParam  = "bmc/address"
+	BMCUsernameParam = "bmc/username"
+	BMCPasswordParam = "bmc/password"
+)
+
+// bmcProvider is the provider name of the built-in power actions.
+const bmcProvider = "bmc"
+
+// The power states the BMC drivers report.  Redfish states other than
+// these are passed along in lower case.
+const (
+	powerOn  = "on"
+	powerOff = "off"
+)
+
+// The devices a BMC can be told to boot from next.
+const (
+	bootPXE  = "pxe"
+	bootDisk = "disk"
+)
+
+// bmc is the out of band power control of a Machine.
+type bmc interface {
+	PowerOn() error
+	PowerOff() error
+	PowerCycle() error
+	PowerState() (string, error)
+	// NextBoot has the Machine boot from the device once, the next
+	// time it boots.
+	NextBoot(device string) error
+}
+
+// newBMC returns the BMC driver that the bmc params ask for.
+func newBMC(params map[string]interface{}) (bmc, error) {
+	str := func(name string) string {
+		res, _ := params[name].(string)
+		return res
+	}
+	address, username, password := str(BMCAddressParam), str(BMCUsernameParam), str(BMCPasswordParam)
+	if address == "" {
+		return nil, fmt.Errorf("%s is not set", BMCAddressParam)
+	}
+	switch driver := str(BMCDriverParam); driver {
+	case "redfish":
+		return newRedfish(address, username, password), nil
+	case "ipmi":
+		return &ipmiBMC{address: address, username: username, password: password}, nil
+	default:
+		return nil, fmt.Errorf("Unknown BMC driver '%s'", driver)
+	}
+}
+
+// powerCycle power cycles the Machine, or powers it on if it is off.
+func powerCycle(b bmc) error {
+	state, err := b.PowerState()
+	if err != nil {
+		return err
+	}
+	if state == powerOff {
+		return b.PowerOn()
+	}
+	return b.PowerCycle()
+}
+
+// bmcActions are the power actions the server provides for Machines
+// that have a BMC.
+var bmcActions = map[string]func(bmc) (interface{}, error){
+	"poweron":      func(b bmc) (interface{}, error) { return nil, b.PowerOn() },
+	"poweroff":     func(b bmc) (interface{}, error) { return nil, b.PowerOff() },
+	"powercycle":   func(b bmc) (interface{}, error) { return nil, powerCycle(b) },
+	"powerstatus":  func(b bmc) (interface{}, error) { return b.PowerState() },
+	"nextbootpxe":  func(b bmc) (interface{}, error) { return nil, b.NextBoot(bootPXE) },
+	"nextbootdisk": func(b bmc) (interface{}, error) { return nil, b.NextBoot(bootDisk) },
+}
+
+func addBMCActions(ma *actions) {
+	for cmd := range bmcActions {
+		op := bmcActions[cmd]
+		ma.addBuiltin(models.AvailableAction{
+			Provider:       bmcProvider,
+			Model:          "machines",
+			Command:        cmd,
+			RequiredParams: []string{BMCDriverParam, BMCAddressParam},
+			OptionalParams: []string{BMCUsernameParam, BMCPasswordParam},
+		}, func(rt *RequestTracker, ma *models.Action) (interface{}, error) {
+			b, err := newBMC(ma.Params)
+			if err != nil {
+				return nil, err
+			}
+			return op(b)
+		})
+	}
+}
+
+// bmc returns the BMC of the Machine, or nil if it does not have one.
+func (n *Machine) bmc(rt *RequestTracker) (bmc, error) {
+	params := rt.GetParams(n, true, true)
+	if _, ok := params[BMCDriverParam]; !ok {
+		return nil, nil
+	}
+	return newBMC(params)
+}
+
+// bmcReboot has the BMC of the Machine, if it has one, boot it into
+// its BootEnv in the background once the current request is finished.  The agent on a
+// Machine with a BMC leaves the reboot to this.
+func (n *Machine) bmcReboot() {
+	b, err := n.bmc(n.rt)
+	if err != nil {
+		n.rt.Errorf("Cannot reboot machine %s through its BMC: %v", n.Key(), err)
+		return
+	}
+	if b == nil {
+		return
+	}
+	device := bootDisk
+	if env := n.rt.find("bootenvs", n.BootEnv); env != nil && AsBootEnv(env).NetBoot() {
+		device = bootPXE
+	}
+	rt, key := n.rt, n.Key()
+	rt.Infof("Machine %s changed to stage '%s', will power cycle it to boot from %s", key, n.Stage, device)
+	rt.Publish("machines", "powercycle", key, &models.Action{
+		Model:      models.Clone(n.Machine),
+		Plugin:     bmcProvider,
+		CommandSet: "machines",
+		Command:    "powercycle",
+	})
+	// Talking to a BMC can take a while, so do it in the background
+	// rather than holding up the request or anyone waiting behind it.
+	rt.PublishAfter(func() {
+		go func() {
+			// A Machine that boots from the wrong device is still
+			// better off than one that does not reboot at all.
+			if err := b.NextBoot(device); err != nil {
+				rt.Errorf("Cannot set the next boot device of machine %s to %s: %v", key, device, err)
+			}
+			if err := powerCycle(b); err != nil {
+				rt.Errorf("Cannot power cycle machine %s: %v", key, err)
+				return
+			}
+			rt.Infof("Power cycled machine %s to boot from %s", key, device)
+		}()
+	})
+}
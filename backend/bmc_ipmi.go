@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ipmiTool is the ipmitool binary that ipmiBMC runs.
+var ipmiTool = "ipmitool"
+
+// ipmiBMC controls the power of a Machine with ipmitool over IPMI
+// v2.0 LAN.  The password is passed in the environment so that it
+// does not show up in the process list.
+type ipmiBMC struct {
+	address, username, password string
+}
+
+// command returns the ipmitool command to run args against the BMC.
+func (i *ipmiBMC) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmdArgs := []string{"-I", "lanplus"}
+	if host, port, err := net.SplitHostPort(i.address); err == nil {
+		cmdArgs = append(cmdArgs, "-H", host, "-p", port)
+	} else {
+		cmdArgs = append(cmdArgs, "-H", i.address)
+	}
+	if i.username != "" {
+		cmdArgs = append(cmdArgs, "-U", i.username)
+	}
+	cmdArgs = append(cmdArgs, "-E")
+	cmd := exec.CommandContext(ctx, ipmiTool, append(cmdArgs, args...)...)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+i.password)
+	return cmd
+}
+
+// ipmiTimeout is how long ipmitool gets to finish a command.
+var ipmiTimeout = 30 * time.Second
+
+func (i *ipmiBMC) run(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ipmiTimeout)
+	defer cancel()
+	cmd := i.command(ctx, args...)
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ipmitool %s on %s failed: %v: %s", strings.Join(args, " "), i.address, err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+func (i *ipmiBMC) PowerOn() error {
+	_, err := i.run("chassis", "power", "on")
+	return err
+}
+
+func (i *ipmiBMC) PowerOff() error {
+	_, err := i.run("chassis", "power", "off")
+	return err
+}
+
+func (i *ipmiBMC) PowerCycle() error {
+	_, err := i.run("chassis", "power", "cycle")
+	return err
+}
+
+func (i *ipmiBMC) PowerState() (string, error) {
+	out, err := i.run("chassis", "power", "status")
+	if err != nil {
+		return "", err
+	}
+	// Chassis Power is on
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("ipmitool returned no power state for %s", i.address)
+	}
+	return strings.ToLower(fields[len(fields)-1]), nil
+}
+
+func (i *ipmiBMC) NextBoot(device string) error {
+	// ipmitool sets the boot device for the next boot only unless
+	// told to make it persistent.
+	_, err := i.run("chassis", "bootdev", device)
+	return err
+}
@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redfishBMC controls the power of a Machine through the Redfish API
+// of its BMC.  It works on the first system the BMC lists.
+type redfishBMC struct {
+	base, username, password string
+	client                   *http.Client
+	system                   string
+}
+
+func newRedfish(address, username, password string) *redfishBMC {
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	// Redfish paths are all absolute, so only the scheme and host
+	// matter.
+	if u, err := url.Parse(address); err == nil {
+		address = u.Scheme + "://" + u.Host
+	}
+	return &redfishBMC{
+		base:     address,
+		username: username,
+		password: password,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // BMCs use self-signed certs
+			},
+		},
+	}
+}
+
+type redfishLink struct {
+	ID string `json:"@odata.id"`
+}
+
+type redfishSystem struct {
+	PowerState string
+	Actions    struct {
+		Reset struct {
+			Target     string   `json:"target"`
+			ResetTypes []string `json:"ResetType@Redfish.AllowableValues"`
+		} `json:"#ComputerSystem.Reset"`
+	}
+}
+
+func (r *redfishBMC) do(method, path string, body, res interface{}) error {
+	var rdr io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, r.base+path, rdr)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.username, r.password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Redfish %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(buf)))
+	}
+	if res == nil || len(buf) == 0 {
+		return nil
+	}
+	return json.Unmarshal(buf, res)
+}
+
+// getSystem finds the first system the BMC lists the first time it
+// is called, and fetches it.
+func (r *redfishBMC) getSystem() (*redfishSystem, error) {
+	if r.system == "" {
+		systems := &struct{ Members []redfishLink }{}
+		if err := r.do("GET", "/redfish/v1/Systems", nil, systems); err != nil {
+			return nil, err
+		}
+		if len(systems.Members) == 0 {
+			return nil, fmt.Errorf("Redfish BMC at %s has no systems", r.base)
+		}
+		r.system = systems.Members[0].ID
+	}
+	res := &redfishSystem{}
+	return res, r.do("GET", r.system, nil, res)
+}
+
+// reset resets the system with the first of the reset types that the
+// BMC allows.  BMCs that do not say which types they allow get the
+// first one.
+func (r *redfishBMC) reset(resetTypes ...string) error {
+	sys, err := r.getSystem()
+	if err != nil {
+		return err
+	}
+	target := sys.Actions.Reset.Target
+	if target == "" {
+		target = r.system + "/Actions/ComputerSystem.Reset"
+	}
+	resetType := resetTypes[0]
+	if allowed := sys.Actions.Reset.ResetTypes; len(allowed) > 0 {
+		resetType = ""
+		for _, want := range resetTypes {
+			for _, have := range allowed {
+				if want == have && resetType == "" {
+					resetType = want
+				}
+			}
+		}
+		if resetType == "" {
+			return fmt.Errorf("Redfish BMC at %s does not allow %s", r.base, strings.Join(resetTypes, " or "))
+		}
+	}
+	return r.do("POST", target, map[string]string{"ResetType": resetType}, nil)
+}
+
+func (r *redfishBMC) PowerOn() error {
+	return r.reset("On")
+}
+
+func (r *redfishBMC) PowerOff() error {
+	return r.reset("ForceOff")
+}
+
+func (r *redfishBMC) PowerCycle() error {
+	return r.reset("PowerCycle", "ForceRestart")
+}
+
+func (r *redfishBMC) PowerState() (string, error) {
+	sys, err := r.getSystem()
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(sys.PowerState), nil
+}
+
+func (r *redfishBMC) NextBoot(device string) error {
+	target := "Hdd"
+	if device == bootPXE {
+		target = "Pxe"
+	}
+	if r.system == "" {
+		if _, err := r.getSystem(); err != nil {
+			return err
+		}
+	}
+	return r.do("PATCH", r.system, map[string]interface{}{
+		"Boot": map[string]string{
+			"BootSourceOverrideEnabled": "Once",
+			"BootSourceOverrideTarget":  target,
+		},
+	}, nil)
+}
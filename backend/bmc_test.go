@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// mockRedfish is just enough of a Redfish BMC with one system that
+// does not allow PowerCycle resets.
+type mockRedfish struct {
+	sync.Mutex
+	power  string
+	resets []string
+	boot   map[string]string
+}
+
+func (m *mockRedfish) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "root" || pass != "calvin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method + " " + r.URL.Path {
+	case "GET /redfish/v1/Systems":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Members": []interface{}{map[string]string{"@odata.id": "/redfish/v1/Systems/1"}},
+		})
+	case "GET /redfish/v1/Systems/1":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"PowerState": m.power,
+			"Actions": map[string]interface{}{
+				"#ComputerSystem.Reset": map[string]interface{}{
+					"target":                            "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset",
+					"ResetType@Redfish.AllowableValues": []string{"On", "ForceOff", "ForceRestart"},
+				},
+			},
+		})
+	case "POST /redfish/v1/Systems/1/Actions/ComputerSystem.Reset":
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		m.resets = append(m.resets, body["ResetType"])
+		switch body["ResetType"] {
+		case "On", "ForceRestart":
+			m.power = "On"
+		case "ForceOff":
+			m.power = "Off"
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "PATCH /redfish/v1/Systems/1":
+		body := map[string]map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		m.boot = body["Boot"]
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRedfishBMC(t *testing.T) {
+	mock := &mockRedfish{power: "On"}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	params := map[string]interface{}{
+		BMCDriverParam:   "redfish",
+		BMCAddressParam:  srv.URL,
+		BMCUsernameParam: "root",
+		BMCPasswordParam: "calvin",
+	}
+	b, err := newBMC(params)
+	if err != nil {
+		t.Fatalf("Failed to make a Redfish BMC: %v", err)
+	}
+	if state, err := b.PowerState(); err != nil || state != powerOn {
+		t.Errorf("Expected power state %s, not %s: %v", powerOn, state, err)
+	}
+	if err := b.PowerOff(); err != nil {
+		t.Errorf("Failed to power off: %v", err)
+	}
+	// Power cycling a machine that is off powers it on, and the BMC
+	// does not allow PowerCycle.
+	if err := powerCycle(b); err != nil {
+		t.Errorf("Failed to power cycle while off: %v", err)
+	}
+	if err := powerCycle(b); err != nil {
+		t.Errorf("Failed to power cycle while on: %v", err)
+	}
+	if expected := []string{"ForceOff", "On", "ForceRestart"}; !reflect.DeepEqual(mock.resets, expected) {
+		t.Errorf("Expected resets %v, not %v", expected, mock.resets)
+	}
+	if err := b.NextBoot(bootPXE); err != nil {
+		t.Errorf("Failed to set the next boot device: %v", err)
+	}
+	expected := map[string]string{"BootSourceOverrideEnabled": "Once", "BootSourceOverrideTarget": "Pxe"}
+	if !reflect.DeepEqual(mock.boot, expected) {
+		t.Errorf("Expected boot override %v, not %v", expected, mock.boot)
+	}
+	params[BMCPasswordParam] = "wrong"
+	if b, _ = newBMC(params); b != nil {
+		if _, err := b.PowerState(); err == nil {
+			t.Errorf("Expected a bad password to fail")
+		}
+	}
+	params[BMCDriverParam] = "smoke-signals"
+	if _, err := newBMC(params); err == nil {
+		t.Errorf("Expected an unknown driver to fail")
+	}
+
+	// The power actions are built in, and get the BMC from the params.
+	acts := newActions()
+	laa, ok := acts.get("machines", "powerstatus")
+	if !ok || len(laa) != 1 || laa[0].Provider != bmcProvider {
+		t.Fatalf("Expected a built-in powerstatus action, not %v", laa)
+	}
+	params[BMCDriverParam], params[BMCPasswordParam] = "redfish", "calvin"
+	res, err := laa[0].run(nil, &models.Action{Command: "powerstatus", Params: params})
+	if err != nil || res != powerOn {
+		t.Errorf("Expected powerstatus to return %s, not %v: %v", powerOn, res, err)
+	}
+}
+
+func TestBMCStageReboot(t *testing.T) {
+	mock := &mockRedfish{power: "Off"}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "machines:rw", "tasks", "profiles", "params", "workflows")
+	machine := &models.Machine{
+		Uuid: uuid.NewRandom(),
+		Name: "powered.fqdn",
+		Params: map[string]interface{}{
+			BMCDriverParam:   "redfish",
+			BMCAddressParam:  srv.URL,
+			BMCUsernameParam: "root",
+		},
+	}
+	tests := []crudTest{
+		{"Create stage", rt.Create, &models.Stage{Name: "power-cycle", Reboot: true}, true},
+		{"Create machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		m := ModelToBackend(models.Clone(AsMachine(rt.find("machines", machine.Key())).Machine)).(*Machine)
+		pk, err := rt.PublicKeyFor(m)
+		if err != nil {
+			t.Fatalf("Failed to get the public key of the machine: %v", err)
+		}
+		secret := &models.SecureData{}
+		if err := secret.Marshal(pk, "calvin"); err != nil {
+			t.Fatalf("Failed to encrypt the BMC password: %v", err)
+		}
+		m.Params[BMCPasswordParam] = secret
+		if _, err := rt.Update(m); err != nil {
+			t.Errorf("Failed to set the BMC password: %v", err)
+		}
+	})
+	if len(mock.resets) != 0 {
+		t.Errorf("Expected no resets before changing stages, not %v", mock.resets)
+	}
+	rt.Do(func(d Stores) {
+		m := ModelToBackend(models.Clone(AsMachine(rt.find("machines", machine.Key())).Machine)).(*Machine)
+		m.Stage = "power-cycle"
+		if _, err := rt.Update(m); err != nil {
+			t.Errorf("Failed to change the machine to a rebooting stage: %v", err)
+		}
+	})
+	mock.Lock()
+	defer mock.Unlock()
+	if expected := []string{"On"}; !reflect.DeepEqual(mock.resets, expected) {
+		t.Errorf("Expected resets %v, not %v", expected, mock.resets)
+	}
+	if mock.boot["BootSourceOverrideTarget"] != "Hdd" {
+		t.Errorf("Expected the machine to boot from its disk, not %v", mock.boot)
+	}
+}
@@ -533,6 +533,7 @@ func (b *BootEnv) Validate() {
 	// Make sure the ISO for this bootenv has been exploded locally so that
 	// the boot env can use its contents.
 	b.fillInstallRepos()
+	b.renderers = append(b.renderers, b.secureBootRenderers(b.rt)...)
 	if b.OnlyUnknown {
 		b.renderers = append(b.renderers, b.render(b.rt, nil, b)...)
 	} else {
@@ -607,6 +608,7 @@ func (b *BootEnv) BeforeDelete() error {
 }
 
 func (b *BootEnv) AfterDelete() {
+	b.secureBootRenderers(b.rt).deregister(b.rt)
 	if b.OnlyUnknown {
 		err := &models.Error{Object: b}
 		rts := b.render(b.rt, nil, err)
@@ -647,15 +649,18 @@ func (b *BootEnv) templates() *template.Template {
 }
 
 func (b *BootEnv) render(rt *RequestTracker, m *Machine, e models.ErrorAdder) renderers {
-	r := newRenderData(rt, m, b)
-	if m == nil {
+	return b.renderWith(newRenderData(rt, m, b), e)
+}
+
+func (b *BootEnv) renderWith(r *RenderData, e models.ErrorAdder) renderers {
+	if r.Machine == nil {
 		return r.makeRenderers(e)
 	}
 	res := renderers([]renderer{})
 	toRender := r.validateRequiredParams(e)
 	for i := range toRender {
 		if strings.Contains(toRender[i].Path, `{{.Machine.MacAddr `) {
-			for _, mac := range m.HardwareAddrs {
+			for _, mac := range r.Machine.HardwareAddrs {
 				r.Machine.currMac = mac
 				res = r.addRenderer(e, &toRender[i], res)
 			}
@@ -0,0 +1,209 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+	yaml "github.com/ghodss/yaml"
+)
+
+// CloudInitRoot is the location in the dynamic file tree where the
+// NoCloud-net datasource for each machine is served.  A machine's
+// seed URL is <ProvisionerURL>/cloud-init/<machine uuid>/, which can be
+// passed to cloud-init with ds=nocloud-net;s=<seed URL>
+const CloudInitRoot = "/cloud-init"
+
+// cloudInitFiles maps the files that cloud-init's NoCloud datasource
+// will ask for to the functions that generate them.
+var cloudInitFiles = map[string]func(*RenderData) ([]byte, error){
+	"meta-data":      cloudInitMetaData,
+	"user-data":      cloudInitUserData,
+	"vendor-data":    cloudInitVendorData,
+	"network-config": cloudInitNetworkConfig,
+}
+
+// cloudInitData renders the parameter named by key for use as
+// cloud-init user-data or vendor-data.  String parameters are
+// expanded as templates and passed through as-is, which allows them
+// to be scripts, MIME multipart archives, or #cloud-config documents.
+// Anything else is assumed to be the structured contents of a
+// #cloud-config document.
+func cloudInitData(r *RenderData, key string) ([]byte, error) {
+	if !r.ParamExists(key) {
+		return []byte("#cloud-config\n{}\n"), nil
+	}
+	v, err := r.ParamExpand(key)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	buf, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("#cloud-config\n"), buf...), nil
+}
+
+func cloudInitMetaData(r *RenderData) ([]byte, error) {
+	md := map[string]interface{}{}
+	if r.ParamExists("cloud-init/meta-data") {
+		v, err := r.Param("cloud-init/meta-data")
+		if err != nil {
+			return nil, err
+		}
+		if err := utils.Remarshal(v, &md); err != nil {
+			return nil, fmt.Errorf("cloud-init/meta-data must be an object: %v", err)
+		}
+	}
+	md["instance-id"] = r.Machine.UUID()
+	if _, ok := md["local-hostname"]; !ok {
+		md["local-hostname"] = r.Machine.ShortName()
+	}
+	return yaml.Marshal(md)
+}
+
+func cloudInitUserData(r *RenderData) ([]byte, error) {
+	return cloudInitData(r, "cloud-init/user-data")
+}
+
+func cloudInitVendorData(r *RenderData) ([]byte, error) {
+	return cloudInitData(r, "cloud-init/vendor-data")
+}
+
+// cloudInitNetworkConfig generates a version 2 network config.  If
+// cloud-init/network-config is set, it is used verbatim.  Otherwise
+// the config is built from net/interface-topology with any per-interface
+// addressing in net/interface-config merged in, the same way that
+// drpcli net generate does.  If neither is present, no network-config
+// is served and cloud-init will fall back to its default behaviour.
+func cloudInitNetworkConfig(r *RenderData) ([]byte, error) {
+	if r.ParamExists("cloud-init/network-config") {
+		v, err := r.Param("cloud-init/network-config")
+		if err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(v)
+	}
+	if !r.ParamExists("net/interface-topology") {
+		return nil, nil
+	}
+	topology := map[string]interface{}{}
+	addressing := map[string]interface{}{}
+	v, err := r.Param("net/interface-topology")
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.Remarshal(v, &topology); err != nil {
+		return nil, fmt.Errorf("net/interface-topology must be an object: %v", err)
+	}
+	if r.ParamExists("net/interface-config") {
+		v, err = r.Param("net/interface-config")
+		if err != nil {
+			return nil, err
+		}
+		if err := utils.Remarshal(v, &addressing); err != nil {
+			return nil, fmt.Errorf("net/interface-config must be an object: %v", err)
+		}
+	}
+	network, _ := topology["network"].(map[string]interface{})
+	if network == nil {
+		network = map[string]interface{}{}
+	}
+	if _, ok := network["version"]; !ok {
+		network["version"] = 2
+	}
+	for _, section := range []string{"vlans", "bonds", "bridges", "ethernets"} {
+		ifaces, _ := network[section].(map[string]interface{})
+		if section == "ethernets" && ifaces == nil {
+			ifaces = map[string]interface{}{}
+			network[section] = ifaces
+		}
+		for name := range ifaces {
+			addr, ok := addressing[name]
+			if !ok {
+				continue
+			}
+			delete(addressing, name)
+			from, fromOk := addr.(map[string]interface{})
+			to, toOk := ifaces[name].(map[string]interface{})
+			if !fromOk || !toOk {
+				continue
+			}
+			for k := range from {
+				to[k] = from[k]
+			}
+		}
+	}
+	ethernets := network["ethernets"].(map[string]interface{})
+	for name := range addressing {
+		ethernets[name] = addressing[name]
+	}
+	return yaml.Marshal(map[string]interface{}{"network": network})
+}
+
+// cloudInitTree returns the dynamic tree handler that serves the
+// NoCloud-net datasource for all machines under CloudInitRoot.
+func (p *DataTracker) cloudInitTree() func(string) (io.Reader, error) {
+	return func(fsPath string) (io.Reader, error) {
+		parts := strings.Split(strings.TrimPrefix(fsPath, CloudInitRoot+"/"), "/")
+		if len(parts) != 2 {
+			return nil, nil
+		}
+		gen, ok := cloudInitFiles[parts[1]]
+		if !ok {
+			return nil, nil
+		}
+		rt := p.Request(p.Logger.Switch("bootenv"),
+			"templates",
+			"tasks",
+			"stages",
+			"bootenvs",
+			"machines",
+			"profiles",
+			"params",
+			"preferences",
+			"workflows",
+			"subnets",
+			"leases",
+			"reservations")
+		var (
+			buf []byte
+			err error
+		)
+		rt.Do(func(d Stores) {
+			obj := rt.find("machines", parts[0])
+			if obj == nil {
+				return
+			}
+			m := AsMachine(obj)
+			var target renderable
+			if env := rt.find("bootenvs", m.BootEnv); env != nil {
+				target = AsBootEnv(env)
+			}
+			rd := newRenderData(rt, m, target)
+			rd.tmplKey = parts[1]
+			rd.tmplPath = fsPath
+			rd.setLimits()
+			buf, err = gen(rd)
+		})
+		if err != nil || buf == nil {
+			return nil, err
+		}
+		return bytes.NewReader(buf), nil
+	}
+}
+
+// CloudInitURL returns the NoCloud-net seed URL for the machine being
+// rendered, suitable for use as the s= argument of ds=nocloud-net on
+// the kernel command line.
+func (r *RenderData) CloudInitURL() (string, error) {
+	if r.Machine == nil {
+		return "", fmt.Errorf("Missing machine")
+	}
+	return r.ProvisionerURL() + CloudInitRoot + "/" + r.Machine.UUID() + "/", nil
+}
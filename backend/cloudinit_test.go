@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pborman/uuid"
+)
+
+func TestCloudInit(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger,
+		"stages",
+		"bootenvs",
+		"templates",
+		"machines:rw",
+		"profiles",
+		"params",
+		"tasks",
+		"preferences",
+		"workflows")
+	machine := &Machine{}
+	Fill(machine)
+	machine.Uuid = uuid.NewRandom()
+	machine.Name = "cloudy.example.com"
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(machine); !created {
+			t.Errorf("Failed to create test machine: %v", err)
+			return
+		}
+		machine.Params["cloud-init/user-data"] = "#!/bin/sh\necho {{.Machine.Name}}\n"
+		machine.Params["cloud-init/vendor-data"] = map[string]interface{}{"packages": []string{"curl"}}
+		machine.Params["net/interface-topology"] = map[string]interface{}{
+			"network": map[string]interface{}{
+				"version": 2,
+				"ethernets": map[string]interface{}{
+					"eth0": map[string]interface{}{"match": map[string]interface{}{"macaddress": "f0:1f:af:17:f0:9a"}},
+				},
+			},
+		}
+		machine.Params["net/interface-config"] = map[string]interface{}{
+			"eth0": map[string]interface{}{"dhcp4": true},
+			"eth1": map[string]interface{}{"dhcp6": true},
+		}
+		if saved, err := rt.Save(machine); !saved {
+			t.Errorf("Failed to save test machine: %v", err)
+		}
+	})
+	expected := map[string]string{
+		"meta-data": "instance-id: " + machine.UUID() + "\nlocal-hostname: cloudy\n",
+		"user-data": "#!/bin/sh\necho cloudy.example.com\n",
+		"vendor-data": `#cloud-config
+packages:
+- curl
+`,
+		"network-config": `network:
+  ethernets:
+    eth0:
+      dhcp4: true
+      match:
+        macaddress: f0:1f:af:17:f0:9a
+    eth1:
+      dhcp6: true
+  version: 2
+`,
+	}
+	for name, want := range expected {
+		loc := path.Join(CloudInitRoot, machine.UUID(), name)
+		out, err := dt.FS.Open(loc, nil)
+		if err != nil || out == nil {
+			t.Errorf("Failed to get %s: %v", loc, err)
+			continue
+		}
+		buf, err := ioutil.ReadAll(out)
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", loc, err)
+		} else if string(buf) != want {
+			t.Errorf("Unexpected %s!\nExpected:\n%s\n\nGot:\n%s", name, want, string(buf))
+		}
+	}
+	for _, loc := range []string{
+		path.Join(CloudInitRoot, machine.UUID(), "bogus"),
+		path.Join(CloudInitRoot, uuid.NewRandom().String(), "meta-data"),
+	} {
+		if out, err := dt.FS.Open(loc, nil); out != nil || err != nil {
+			t.Errorf("Expected nothing at %s, got %v: %v", loc, out, err)
+		}
+	}
+	// Templates in cloud-init params are held to the render limits.
+	dt.RenderMaxSize = 10
+	loc := path.Join(CloudInitRoot, machine.UUID(), "user-data")
+	if _, err := dt.FS.Open(loc, nil); err == nil || !strings.Contains(err.Error(), "generated more than 10 bytes") {
+		t.Errorf("Expected %s to be limited to 10 bytes, got %v", loc, err)
+	}
+}
@@ -0,0 +1,292 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// ConsoleSOLParam is the param that asks for the serial-over-LAN
+// console of a Machine with a BMC to be captured.
+const ConsoleSOLParam = "console/sol"
+
+// DefaultConsoleMaxSize is about how many bytes of console output
+// are kept for each Machine when the DataTracker ConsoleMaxSize field
+// is left at zero.
+const DefaultConsoleMaxSize = 1 << 20
+
+func (p *DataTracker) consoleMaxSize() int64 {
+	if p.ConsoleMaxSize <= 0 {
+		return DefaultConsoleMaxSize
+	}
+	return p.ConsoleMaxSize
+}
+
+// consolePath is where the console output of the Machine with key is
+// kept.  Once it is half of the ConsoleMaxSize it is rotated to
+// consolePath + ".1", replacing the older output there.
+func (p *DataTracker) consolePath(key string) string {
+	return filepath.Join(p.LogRoot, "console", key)
+}
+
+// AppendConsole adds the text received from source at when to the
+// console output of the Machine with key.  Each line is kept with when
+// and source, and carriage returns and empty lines are dropped.
+func (p *DataTracker) AppendConsole(key, source string, when time.Time, text string) error {
+	buf := &strings.Builder{}
+	stamp := when.UTC().Format(time.RFC3339Nano)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fmt.Fprintf(buf, "%s\t%s\t%s\n", stamp, source, line)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	p.consoleMux.Lock()
+	defer p.consoleMux.Unlock()
+	dest := p.consolePath(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dest); err == nil && fi.Size()+int64(buf.Len()) > p.consoleMaxSize()/2 {
+		if err := os.Rename(dest, dest+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, buf.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadConsole returns the console output of the Machine with key that
+// was received from since up to until, oldest first.  A zero since or
+// until leaves that end open.
+func (p *DataTracker) ReadConsole(key string, since, until time.Time) ([]models.ConsoleLine, error) {
+	p.consoleMux.Lock()
+	defer p.consoleMux.Unlock()
+	res := []models.ConsoleLine{}
+	for _, src := range []string{p.consolePath(key) + ".1", p.consolePath(key)} {
+		f, err := os.Open(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), "\t", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			when, err := time.Parse(time.RFC3339Nano, parts[0])
+			if err != nil {
+				continue
+			}
+			if (!since.IsZero() && when.Before(since)) || (!until.IsZero() && when.After(until)) {
+				continue
+			}
+			res = append(res, models.ConsoleLine{Time: when, Source: parts[1], Line: parts[2]})
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// removeConsole removes the console output of the Machine with key.
+func (p *DataTracker) removeConsole(key string) {
+	p.consoleMux.Lock()
+	defer p.consoleMux.Unlock()
+	os.Remove(p.consolePath(key))
+	os.Remove(p.consolePath(key) + ".1")
+}
+
+// ConsoleWindow is the time window of the console output that goes
+// with the Job.  It is open ended while the Job is still running.
+func (j *Job) ConsoleWindow() (since, until time.Time) {
+	since = j.StartTime
+	if j.done() {
+		until = j.EndTime
+	}
+	return
+}
+
+// solBMC returns the BMC to capture the serial-over-LAN console of a
+// Machine from.  Serial-over-LAN is an IPMI feature, so it is used
+// with the host part of the address of Redfish BMCs as well.
+func solBMC(params map[string]interface{}) (*ipmiBMC, error) {
+	b, err := newBMC(params)
+	if err != nil {
+		return nil, err
+	}
+	switch bmc := b.(type) {
+	case *ipmiBMC:
+		return bmc, nil
+	case *redfishBMC:
+		u, err := url.Parse(bmc.base)
+		if err != nil {
+			return nil, err
+		}
+		return &ipmiBMC{address: u.Hostname(), username: bmc.username, password: bmc.password}, nil
+	}
+	return nil, fmt.Errorf("BMC does not support serial-over-LAN")
+}
+
+// solSession captures the serial-over-LAN console of one Machine
+// until it is cancelled.
+type solSession struct {
+	bmc    ipmiBMC
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ConsoleCapture keeps the serial-over-LAN consoles of the Machines
+// that have ConsoleSOLParam set captured.  Every interval it starts
+// capturing the consoles of new Machines, restarts the sessions of
+// Machines whose BMC changed, and stops the ones that are no longer
+// wanted.  Sessions that drop are restarted after the retry delay.
+type ConsoleCapture struct {
+	periodic
+	dt       *DataTracker
+	retry    time.Duration
+	sessions map[string]*solSession
+}
+
+// wanted returns the BMCs of the Machines whose consoles should be
+// captured.
+func (cc *ConsoleCapture) wanted() map[string]ipmiBMC {
+	res := map[string]ipmiBMC{}
+	rt := cc.dt.Request(cc.dt.Logger, "machines", "profiles", "params")
+	rt.Do(func(d Stores) {
+		for _, obj := range d("machines").Items() {
+			m := AsMachine(obj)
+			params := rt.GetParams(m, true, true)
+			if want, _ := params[ConsoleSOLParam].(bool); !want {
+				continue
+			}
+			b, err := solBMC(params)
+			if err != nil {
+				rt.Errorf("Cannot capture the console of machine %s: %v", m.Key(), err)
+				continue
+			}
+			res[m.Key()] = *b
+		}
+	})
+	return res
+}
+
+func (cc *ConsoleCapture) capture(ctx context.Context, key string, s *solSession) {
+	defer close(s.done)
+	for first := true; ; first = false {
+		if first {
+			// Kick off a session left behind by an earlier run,
+			// since a BMC only allows one at a time.  Later on, a
+			// session that is already active belongs to someone
+			// else, so it is left alone until they are done.
+			dctx, cancel := context.WithTimeout(ctx, ipmiTimeout)
+			s.bmc.command(dctx, "sol", "deactivate").Run()
+			cancel()
+		}
+		cmd := s.bmc.command(ctx, "sol", "activate", "usesolkeepalive")
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		// ipmitool sends what it reads to the console, so give it
+		// nothing to read without closing its input.
+		in, err := cmd.StdinPipe()
+		var out io.ReadCloser
+		if err == nil {
+			out, err = cmd.StdoutPipe()
+		}
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err == nil {
+			// Lines longer than the buffer are saved in pieces, so
+			// that a console that never sends a newline is still
+			// saved.
+			rdr := bufio.NewReader(out)
+			for {
+				line, _, rerr := rdr.ReadLine()
+				if rerr != nil {
+					break
+				}
+				if err := cc.dt.AppendConsole(key, "sol", time.Now(), string(line)); err != nil {
+					cc.dt.Errorf("Failed to save the console of machine %s: %v", key, err)
+				}
+			}
+			err = cmd.Wait()
+		}
+		if in != nil {
+			in.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		cc.dt.Debugf("Serial-over-LAN console of machine %s dropped: %v: %s", key, err, strings.TrimSpace(stderr.String()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cc.retry):
+		}
+	}
+}
+
+// sync starts and stops capturing consoles to match what is wanted.
+func (cc *ConsoleCapture) sync(wanted map[string]ipmiBMC) {
+	for key, s := range cc.sessions {
+		if b, ok := wanted[key]; ok && b == s.bmc {
+			continue
+		}
+		s.cancel()
+		<-s.done
+		delete(cc.sessions, key)
+	}
+	for key, b := range wanted {
+		if _, ok := cc.sessions[key]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s := &solSession{bmc: b, cancel: cancel, done: make(chan struct{})}
+		cc.sessions[key] = s
+		go cc.capture(ctx, key, s)
+	}
+}
+
+// NewConsoleCapture starts capturing serial-over-LAN consoles, and
+// checks which Machines want theirs captured every interval.
+func NewConsoleCapture(dt *DataTracker, interval time.Duration) *ConsoleCapture {
+	cc := &ConsoleCapture{
+		dt:       dt,
+		retry:    interval,
+		sessions: map[string]*solSession{},
+	}
+	// Shutting down stops capturing all the consoles.
+	cc.start(interval,
+		func(time.Time) { cc.sync(cc.wanted()) },
+		func() { cc.sync(map[string]ipmiBMC{}) })
+	return cc
+}
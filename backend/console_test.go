@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestConsole(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "machines:rw", "profiles", "params", "stages", "bootenvs", "tasks", "templates", "workflows", "leases", "jobs:rw", "inventories:rw")
+	m := &models.Machine{Uuid: uuid.NewRandom(), Name: "console.fqdn", Address: net.ParseIP("192.168.124.50")}
+	crudTest{"Create machine", rt.Create, m, true}.Test(t, rt)
+	key := m.Key()
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(secs int) time.Time { return start.Add(time.Duration(secs) * time.Second) }
+	if err := dt.AppendConsole(key, "sol", at(0), "BIOS starting\r\n\r\n"); err != nil {
+		t.Fatalf("Failed to append console output: %v", err)
+	}
+	if err := dt.AppendConsole(key, "netconsole", at(10), "Kernel panic\nnot syncing\n"); err != nil {
+		t.Fatalf("Failed to append console output: %v", err)
+	}
+	lines, err := dt.ReadConsole(key, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to read console output: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines of console output, not %v", lines)
+	}
+	if lines[0].Line != "BIOS starting" || lines[0].Source != "sol" || !lines[0].Time.Equal(at(0)) {
+		t.Errorf("Unexpected first line %v", lines[0])
+	}
+	if lines[2].Line != "not syncing" || lines[2].Source != "netconsole" {
+		t.Errorf("Unexpected last line %v", lines[2])
+	}
+	if lines, _ = dt.ReadConsole(key, at(5), time.Time{}); len(lines) != 2 {
+		t.Errorf("Expected 2 lines since %v, not %v", at(5), lines)
+	}
+	if lines, _ = dt.ReadConsole(key, time.Time{}, at(5)); len(lines) != 1 {
+		t.Errorf("Expected 1 line until %v, not %v", at(5), lines)
+	}
+
+	// Jobs pick the console output from while they ran.
+	j := &Job{Job: &models.Job{StartTime: at(5), State: "running"}}
+	if since, until := j.ConsoleWindow(); !since.Equal(at(5)) || !until.IsZero() {
+		t.Errorf("Expected a running job window from %v, not %v to %v", at(5), since, until)
+	}
+	j.State, j.EndTime = "failed", at(8)
+	since, until := j.ConsoleWindow()
+	if lines, _ = dt.ReadConsole(key, since, until); len(lines) != 0 {
+		t.Errorf("Expected no lines while the job ran, not %v", lines)
+	}
+
+	// Old output is rotated out once there is too much of it.
+	dt.ConsoleMaxSize = 4096
+	long := strings.Repeat("x", 500)
+	for i := 0; i < 20; i++ {
+		if err := dt.AppendConsole(key, "sol", at(20+i), long); err != nil {
+			t.Fatalf("Failed to append console output: %v", err)
+		}
+	}
+	lines, _ = dt.ReadConsole(key, time.Time{}, time.Time{})
+	if len(lines) == 0 || len(lines) >= 23 {
+		t.Errorf("Expected old console output to be rotated out, got %d lines", len(lines))
+	} else if !lines[len(lines)-1].Time.Equal(at(39)) {
+		t.Errorf("Expected the newest output to be kept, not %v", lines[len(lines)-1])
+	}
+	for _, suffix := range []string{"", ".1"} {
+		if fi, err := os.Stat(dt.consolePath(key) + suffix); err != nil || fi.Size() > dt.ConsoleMaxSize/2 {
+			t.Errorf("Expected console file%s to be at most %d bytes: %v", suffix, dt.ConsoleMaxSize/2, err)
+		}
+	}
+
+	// Senders are found by the address of the machine.
+	rt.Do(func(d Stores) {
+		if found := rt.MachineForAddress(net.ParseIP("192.168.124.50")); found == nil || found.Key() != key {
+			t.Errorf("Expected to find machine %s by its address, not %v", key, found)
+		}
+		if found := rt.MachineForAddress(net.ParseIP("192.168.124.51")); found != nil {
+			t.Errorf("Expected no machine for an unknown address, not %s", found.Key())
+		}
+	})
+
+	// The console output goes away with the machine.
+	crudTest{"Remove machine", rt.Remove, m, true}.Test(t, rt)
+	if lines, _ = dt.ReadConsole(key, time.Time{}, time.Time{}); len(lines) != 0 {
+		t.Errorf("Expected the console output to be removed with the machine, not %v", lines)
+	}
+}
@@ -0,0 +1,375 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// ClusterParam is the param that names the cluster a Machine is a
+// part of.  Barriers and Locks are shared between all the Machines
+// with the same value for it, unless they ask to share them between
+// the Machines with the same Profile instead.
+const ClusterParam = "cluster/name"
+
+// waitable is embedded in barriers and locks so that the Machines
+// waiting on them can be woken up whenever they change.
+type waitable struct {
+	changed chan struct{}
+}
+
+func (w *waitable) broadcast() {
+	if w.changed != nil {
+		close(w.changed)
+	}
+	w.changed = make(chan struct{})
+}
+
+type barrier struct {
+	waitable
+	models.Barrier
+	released bool
+}
+
+func (b *barrier) has(id uuid.UUID) bool {
+	for _, m := range b.Arrived {
+		if uuid.Equal(m, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *barrier) leave(id uuid.UUID) bool {
+	for i, m := range b.Arrived {
+		if uuid.Equal(m, id) {
+			b.Arrived = append(b.Arrived[:i], b.Arrived[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *barrier) clone() *models.Barrier {
+	res := b.Barrier
+	res.Arrived = append([]uuid.UUID{}, b.Arrived...)
+	return &res
+}
+
+type lock struct {
+	waitable
+	models.Lock
+}
+
+func (l *lock) holds(id uuid.UUID) bool {
+	for _, h := range l.Holders {
+		if uuid.Equal(h.Machine, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lock) release(id uuid.UUID) bool {
+	for i, h := range l.Holders {
+		if uuid.Equal(h.Machine, id) {
+			l.Holders = append(l.Holders[:i], l.Holders[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lock) clone() *models.Lock {
+	res := l.Lock
+	res.Holders = append([]models.LockHolder{}, l.Holders...)
+	return &res
+}
+
+// coordinator keeps track of all the Barriers and Locks.  They only
+// live in memory, and are keyed by scope and name.
+type coordinator struct {
+	sync.Mutex
+	barriers map[string]*barrier
+	locks    map[string]*lock
+}
+
+func newCoordinator() *coordinator {
+	return &coordinator{
+		barriers: map[string]*barrier{},
+		locks:    map[string]*lock{},
+	}
+}
+
+// coordinationTarget looks up the Machine that wants to use a Barrier
+// or Lock and works out the scope it should be looked for in.  An
+// empty scope means the cluster the Machine is in according to its
+// cluster/name param, and profile:<name> means all the Machines with
+// that Profile.  The Machine must have the Profile it asks for.
+func (rt *RequestTracker) coordinationTarget(kind, machine, scope, name string) (id, job uuid.UUID, fullScope string, err error) {
+	e := &models.Error{
+		Code:  http.StatusBadRequest,
+		Type:  "ValidationError",
+		Model: kind,
+		Key:   name,
+	}
+	e.AddError(models.ValidName("Invalid name", name))
+	rt.Do(func(d Stores) {
+		mo := rt.find("machines", machine)
+		if mo == nil {
+			e.Code = http.StatusNotFound
+			e.Type = "NotFound"
+			e.Errorf("Machine %s does not exist", machine)
+			return
+		}
+		m := AsMachine(mo)
+		id, job = m.Uuid, m.CurrentJob
+		switch {
+		case scope == "":
+			v, _ := rt.GetParam(m, ClusterParam, true, false)
+			if cluster, _ := v.(string); cluster != "" {
+				fullScope = "cluster:" + cluster
+			} else {
+				e.Errorf("Machine %s does not have a %s param, and no scope was given", m.Key(), ClusterParam)
+			}
+		case strings.HasPrefix(scope, "profile:"):
+			if profile := strings.TrimPrefix(scope, "profile:"); m.HasProfile(profile) {
+				fullScope = scope
+			} else {
+				e.Errorf("Machine %s does not have profile %s", m.Key(), profile)
+			}
+		default:
+			e.Errorf("Invalid scope %s.  It must be empty or profile:<name>", scope)
+		}
+	})
+	err = e.HasError()
+	return
+}
+
+func waitError(kind, scope, name string, err error) error {
+	res := &models.Error{
+		Code:  http.StatusConflict,
+		Type:  "Conflict",
+		Model: kind,
+		Key:   name,
+	}
+	if err == context.DeadlineExceeded {
+		res.Code = http.StatusRequestTimeout
+		res.Type = "Timeout"
+	}
+	res.Errorf("Gave up waiting on %s in %s: %v", name, scope, err)
+	return res
+}
+
+// WaitBarrier has the Machine arrive at the named Barrier, and waits
+// until count Machines in the same scope have arrived or ctx is done.
+// The first Machine to arrive sets the count, and every other Machine
+// must agree with it.  If ctx is done first, the Machine leaves the
+// Barrier again.
+func (rt *RequestTracker) WaitBarrier(ctx context.Context, machine, scope, name string, count int) (*models.Barrier, error) {
+	id, _, scope, err := rt.coordinationTarget("barriers", machine, scope, name)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		e := &models.Error{Code: http.StatusBadRequest, Type: "ValidationError", Model: "barriers", Key: name}
+		e.Errorf("Barrier count must be at least 1, not %d", count)
+		return nil, e
+	}
+	c := rt.dt.coordination
+	c.Lock()
+	defer c.Unlock()
+	key := scope + "/" + name
+	b := c.barriers[key]
+	if b == nil {
+		b = &barrier{Barrier: models.Barrier{Scope: scope, Name: name, Count: count, Arrived: []uuid.UUID{}}}
+		b.broadcast()
+		c.barriers[key] = b
+	} else if b.Count != count {
+		e := &models.Error{Code: http.StatusConflict, Type: "Conflict", Model: "barriers", Key: name}
+		e.Errorf("Barrier %s in %s is waiting for %d machines, not %d", name, scope, b.Count, count)
+		return nil, e
+	}
+	if !b.has(id) {
+		b.Arrived = append(b.Arrived, id)
+		rt.Infof("Machine %s arrived at barrier %s in %s (%d of %d)", id, name, scope, len(b.Arrived), b.Count)
+	}
+	if len(b.Arrived) >= b.Count {
+		rt.Infof("Barrier %s in %s released %d machines", name, scope, len(b.Arrived))
+		b.released = true
+		delete(c.barriers, key)
+		b.broadcast()
+		return b.clone(), nil
+	}
+	for {
+		changed := b.changed
+		c.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+		c.Lock()
+		if b.released {
+			return b.clone(), nil
+		}
+		if !b.has(id) {
+			return nil, waitError("barriers", scope, name, context.Canceled)
+		}
+		if err := ctx.Err(); err != nil {
+			b.leave(id)
+			if len(b.Arrived) == 0 && c.barriers[key] == b {
+				delete(c.barriers, key)
+			}
+			b.broadcast()
+			return nil, waitError("barriers", scope, name, err)
+		}
+	}
+}
+
+// AcquireLock has the Machine take the named Lock, waiting until
+// fewer than limit Machines in the same scope hold it or ctx is done.
+// The first Machine to ask for the Lock sets the limit, and every
+// other Machine must agree with it.  Taking a Lock the Machine already
+// holds succeeds right away.
+func (rt *RequestTracker) AcquireLock(ctx context.Context, machine, scope, name string, limit int) (*models.Lock, error) {
+	id, job, scope, err := rt.coordinationTarget("locks", machine, scope, name)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 {
+		e := &models.Error{Code: http.StatusBadRequest, Type: "ValidationError", Model: "locks", Key: name}
+		e.Errorf("Lock limit must be at least 1, not %d", limit)
+		return nil, e
+	}
+	c := rt.dt.coordination
+	c.Lock()
+	defer c.Unlock()
+	key := scope + "/" + name
+	l := c.locks[key]
+	if l == nil {
+		l = &lock{Lock: models.Lock{Scope: scope, Name: name, Limit: limit, Holders: []models.LockHolder{}}}
+		l.broadcast()
+		c.locks[key] = l
+	} else if l.Limit != limit {
+		e := &models.Error{Code: http.StatusConflict, Type: "Conflict", Model: "locks", Key: name}
+		e.Errorf("Lock %s in %s can be held by %d machines, not %d", name, scope, l.Limit, limit)
+		return nil, e
+	}
+	for {
+		if l.holds(id) {
+			return l.clone(), nil
+		}
+		if len(l.Holders) < l.Limit {
+			l.Holders = append(l.Holders, models.LockHolder{Machine: id, Job: job, Acquired: time.Now()})
+			rt.Infof("Machine %s acquired lock %s in %s", id, name, scope)
+			l.broadcast()
+			return l.clone(), nil
+		}
+		l.Waiting++
+		changed := l.changed
+		c.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+		c.Lock()
+		l.Waiting--
+		if err := ctx.Err(); err != nil {
+			if len(l.Holders) == 0 && l.Waiting == 0 {
+				delete(c.locks, key)
+			}
+			return nil, waitError("locks", scope, name, err)
+		}
+	}
+}
+
+// ReleaseLock has the Machine give up the named Lock, letting the
+// next Machine waiting on it take it.
+func (rt *RequestTracker) ReleaseLock(machine, scope, name string) (*models.Lock, error) {
+	id, _, scope, err := rt.coordinationTarget("locks", machine, scope, name)
+	if err != nil {
+		return nil, err
+	}
+	c := rt.dt.coordination
+	c.Lock()
+	defer c.Unlock()
+	key := scope + "/" + name
+	l := c.locks[key]
+	if l == nil || !l.release(id) {
+		e := &models.Error{Code: http.StatusNotFound, Type: "NotFound", Model: "locks", Key: name}
+		e.Errorf("Machine %s does not hold lock %s in %s", id, name, scope)
+		return nil, e
+	}
+	rt.Infof("Machine %s released lock %s in %s", id, name, scope)
+	if len(l.Holders) == 0 && l.Waiting == 0 {
+		delete(c.locks, key)
+	}
+	l.broadcast()
+	return l.clone(), nil
+}
+
+// releaseCoordination releases every Lock the Machine holds and
+// takes it back out of every Barrier it is waiting at.  It is called
+// when one of the Jobs of the Machine fails, and when the Machine is
+// deleted.
+func (rt *RequestTracker) releaseCoordination(id uuid.UUID) {
+	c := rt.dt.coordination
+	c.Lock()
+	defer c.Unlock()
+	for key, l := range c.locks {
+		if !l.release(id) {
+			continue
+		}
+		rt.Infof("Machine %s released lock %s in %s", id, l.Name, l.Scope)
+		if len(l.Holders) == 0 && l.Waiting == 0 {
+			delete(c.locks, key)
+		}
+		l.broadcast()
+	}
+	for key, b := range c.barriers {
+		if !b.leave(id) {
+			continue
+		}
+		rt.Infof("Machine %s left barrier %s in %s", id, b.Name, b.Scope)
+		if len(b.Arrived) == 0 {
+			delete(c.barriers, key)
+		}
+		b.broadcast()
+	}
+}
+
+// Barriers returns all the Barriers that Machines are waiting at.
+func (p *DataTracker) Barriers() []*models.Barrier {
+	c := p.coordination
+	c.Lock()
+	defer c.Unlock()
+	res := make([]*models.Barrier, 0, len(c.barriers))
+	for _, b := range c.barriers {
+		res = append(res, b.clone())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Scope+"/"+res[i].Name < res[j].Scope+"/"+res[j].Name
+	})
+	return res
+}
+
+// Locks returns all the Locks that are held or waited on.
+func (p *DataTracker) Locks() []*models.Lock {
+	c := p.coordination
+	c.Lock()
+	defer c.Unlock()
+	res := make([]*models.Lock, 0, len(c.locks))
+	for _, l := range c.locks {
+		res = append(res, l.clone())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Scope+"/"+res[i].Name < res[j].Scope+"/"+res[j].Name
+	})
+	return res
+}
@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestCoordination(t *testing.T) {
+	dt := mkDT()
+	locks := []string{"stages", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles:rw", "params", "jobs:rw", "workflows", "inventories:rw"}
+	rt := dt.Request(dt.Logger, locks...)
+	mkMachine := func(name string) *models.Machine {
+		return &models.Machine{Uuid: uuid.NewRandom(), Name: name, Profiles: []string{"etcd"}}
+	}
+	m1, m2, m3 := mkMachine("etcd1.fqdn"), mkMachine("etcd2.fqdn"), mkMachine("etcd3.fqdn")
+	loner := &models.Machine{Uuid: uuid.NewRandom(), Name: "loner.fqdn"}
+	tests := []crudTest{
+		{"Create profile", rt.Create, &models.Profile{Name: "etcd", Params: map[string]interface{}{ClusterParam: "etcd"}}, true},
+		{"Create task", rt.Create, &models.Task{Name: "join"}, true},
+		{"Create machine 1", rt.Create, m1, true},
+		{"Create machine 2", rt.Create, m2, true},
+		{"Create machine 3", rt.Create, m3, true},
+		{"Create machine without a cluster", rt.Create, loner, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	errCode := func(err error) int {
+		if err == nil {
+			return 0
+		}
+		return err.(*models.Error).Code
+	}
+	ctx := context.Background()
+	if _, err := dt.Request(dt.Logger, locks...).WaitBarrier(ctx, loner.UUID(), "", "up", 1); errCode(err) != http.StatusBadRequest {
+		t.Errorf("Expected a machine without a cluster to need a scope, not %v", err)
+	}
+	if _, err := dt.Request(dt.Logger, locks...).AcquireLock(ctx, loner.UUID(), "profile:etcd", "join", 1); errCode(err) != http.StatusBadRequest {
+		t.Errorf("Expected a machine without the etcd profile to not use its scope, not %v", err)
+	}
+
+	// Two machines wait at a barrier for three, and are let go once
+	// the third arrives.
+	waited := make(chan error, 2)
+	for _, m := range []*models.Machine{m1, m2} {
+		go func(m *models.Machine) {
+			_, err := dt.Request(dt.Logger, locks...).WaitBarrier(ctx, m.UUID(), "profile:etcd", "up", 3)
+			waited <- err
+		}(m)
+	}
+	for i := 0; i < 100; i++ {
+		if b := dt.Barriers(); len(b) == 1 && len(b[0].Arrived) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("Barrier released a machine early: %v", err)
+	default:
+	}
+	if _, err := dt.Request(dt.Logger, locks...).WaitBarrier(ctx, m3.UUID(), "profile:etcd", "up", 2); errCode(err) != http.StatusConflict {
+		t.Errorf("Expected a conflicting barrier count to fail, not %v", err)
+	}
+	b, err := dt.Request(dt.Logger, locks...).WaitBarrier(ctx, m3.UUID(), "profile:etcd", "up", 3)
+	if err != nil || len(b.Arrived) != 3 {
+		t.Errorf("Expected the barrier to release 3 machines, not %v: %v", b, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-waited; err != nil {
+			t.Errorf("Unexpected error waiting at barrier: %v", err)
+		}
+	}
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := dt.Request(dt.Logger, locks...).WaitBarrier(short, m1.UUID(), "", "up", 3); errCode(err) != http.StatusRequestTimeout {
+		t.Errorf("Expected waiting at the barrier to time out, not %v", err)
+	}
+	if b := dt.Barriers(); len(b) != 0 {
+		t.Errorf("Expected the timed out machine to leave the barrier, not %v", b)
+	}
+
+	// Only one machine at a time may hold the join lock, and a failed
+	// job gives up the locks its machine holds.
+	if _, err := dt.Request(dt.Logger, locks...).AcquireLock(ctx, m1.UUID(), "", "join", 1); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := dt.Request(dt.Logger, locks...).AcquireLock(ctx, m2.UUID(), "", "join", 1)
+		acquired <- err
+	}()
+	for i := 0; i < 100; i++ {
+		if l := dt.Locks(); len(l) == 1 && l[0].Waiting == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-acquired:
+		t.Fatalf("Acquired a held lock: %v", err)
+	default:
+	}
+	job := &models.Job{Uuid: uuid.NewRandom(), Previous: uuid.NIL, Machine: m1.Uuid, Task: "join", State: "running"}
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(job); !created {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		failed := models.Clone(job).(*models.Job)
+		failed.State = "failed"
+		failed.ExitState = "failed"
+		if _, err := rt.Update(failed); err != nil {
+			t.Errorf("Failed to fail job: %v", err)
+		}
+	})
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Unexpected error acquiring lock: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Failing a job did not release its machine's lock")
+	}
+	if l := dt.Locks(); len(l) != 1 || !uuid.Equal(l[0].Holders[0].Machine, m2.Uuid) {
+		t.Errorf("Expected machine 2 to hold the lock, not %v", l)
+	}
+	if _, err := dt.Request(dt.Logger, locks...).ReleaseLock(m1.UUID(), "", "join"); errCode(err) != http.StatusNotFound {
+		t.Errorf("Expected releasing a lock that is not held to fail, not %v", err)
+	}
+	crudTest{"Remove machine holding a lock", rt.Remove, m2, true}.Test(t, rt)
+	if l := dt.Locks(); len(l) != 0 {
+		t.Errorf("Expected deleting the machine to release its lock, not %v", l)
+	}
+}
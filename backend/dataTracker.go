@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/digitalrebar/logger"
@@ -123,6 +124,18 @@ func Fill(t store.KeySaver) {
 		if obj.Tenant == nil {
 			obj.Tenant = &models.Tenant{}
 		}
+	case *Schedule:
+		if obj.Schedule == nil {
+			obj.Schedule = &models.Schedule{}
+		}
+	case *Rollout:
+		if obj.Rollout == nil {
+			obj.Rollout = &models.Rollout{}
+		}
+	case *Inventory:
+		if obj.Inventory == nil {
+			obj.Inventory = &models.Inventory{}
+		}
 	case *RawModel:
 		if obj.RawModel == nil {
 			obj.RawModel = &models.RawModel{}
@@ -170,6 +183,12 @@ func ModelToBackend(m models.Model) store.KeySaver {
 		return &Role{Role: obj}
 	case *models.Tenant:
 		return &Tenant{Tenant: obj}
+	case *models.Schedule:
+		return &Schedule{Schedule: obj}
+	case *models.Rollout:
+		return &Rollout{Rollout: obj}
+	case *models.Inventory:
+		return &Inventory{Inventory: obj}
 	case *models.RawModel:
 		return &RawModel{RawModel: obj}
 	default:
@@ -370,6 +389,36 @@ func toBackend(m models.Model, rt *RequestTracker) store.KeySaver {
 		res.Tenant = obj
 		res.rt = rt
 		return &res
+	case *models.Schedule:
+		var res Schedule
+		if ours != nil {
+			res = *ours.(*Schedule)
+		} else {
+			res = Schedule{}
+		}
+		res.Schedule = obj
+		res.rt = rt
+		return &res
+	case *models.Rollout:
+		var res Rollout
+		if ours != nil {
+			res = *ours.(*Rollout)
+		} else {
+			res = Rollout{}
+		}
+		res.Rollout = obj
+		res.rt = rt
+		return &res
+	case *models.Inventory:
+		var res Inventory
+		if ours != nil {
+			res = *ours.(*Inventory)
+		} else {
+			res = Inventory{}
+		}
+		res.Inventory = obj
+		res.rt = rt
+		return &res
 	case *models.RawModel:
 		var res RawModel
 		if ours != nil {
@@ -434,32 +483,76 @@ func (p *DataTracker) logCheck(prefName, prefVal string) (logName, logTarget str
 // a dataTracker.
 type DataTracker struct {
 	logger.Logger
-	FileRoot          string
-	LogRoot           string
-	OurAddress        string
-	ForceOurAddress   bool
-	Cleanup           bool
-	Info              *models.Info
-	FS                *FileSystem
-	Backend           *DataStack
-	Secrets           store.Store
-	secretsMux        *sync.Mutex
-	objs              map[string]*Store
-	defaultPrefs      map[string]string
-	runningPrefs      map[string]string
-	prefMux           *sync.Mutex
-	allMux            *sync.RWMutex
-	GlobalProfileName string
-	tokenManager      *JwtManager
-	rootTemplate      *template.Template
-	tmplMux           *sync.Mutex
-	thunks            []func()
-	thunkMux          *sync.Mutex
-	publishers        *Publishers
-	macAddrMap        map[string]string
-	macAddrMux        *sync.RWMutex
-	licenses          models.LicenseBundle
-	pc                *PluginController
+	FileRoot            string
+	LogRoot             string
+	OurAddress          string
+	ForceOurAddress     bool
+	Cleanup             bool
+	RenderTimeout       time.Duration
+	RenderMaxSize       int64
+	RenderMaxDepth      int
+	ArtifactMaxSize     int64
+	ArtifactMaxTotal    int64
+	JobLogCompressAge   time.Duration
+	JobLogMaxAge        time.Duration
+	JobLogMaxPerMachine int
+	JobLogMaxTotal      int64
+	JobLogArchiveRoot   string
+	HeartbeatStale      time.Duration
+	ConsoleMaxSize      int64
+	Info                *models.Info
+	FS                  *FileSystem
+	Backend             *DataStack
+	Secrets             store.Store
+	secretsMux          *sync.Mutex
+	objs                map[string]*Store
+	defaultPrefs        map[string]string
+	runningPrefs        map[string]string
+	prefMux             *sync.Mutex
+	allMux              *sync.RWMutex
+	GlobalProfileName   string
+	tokenManager        *JwtManager
+	rootTemplate        *template.Template
+	tmplMux             *sync.Mutex
+	thunks              []func()
+	thunkMux            *sync.Mutex
+	publishers          *Publishers
+	macAddrMap          map[string]string
+	macAddrMux          *sync.RWMutex
+	licenses            models.LicenseBundle
+	pc                  *PluginController
+	coordination        *coordinator
+	artifactMux         *sync.Mutex
+	jobLogMux           *sync.Mutex
+	jobLogFollowers     map[string]map[chan struct{}]struct{}
+	consoleMux          *sync.Mutex
+	heartbeatMux        *sync.Mutex
+	heartbeats          map[string]heartbeat
+	heartbeatsSince     time.Time
+}
+
+// The DataTracker RenderTimeout, RenderMaxSize, and RenderMaxDepth
+// fields limit how long a template may take to render, how many bytes
+// it may generate, and how deeply CallTemplate may nest.  These are
+// used when they are left at zero.
+const (
+	DefaultRenderTimeout  = 30 * time.Second
+	DefaultRenderMaxSize  = 64 << 20
+	DefaultRenderMaxDepth = 32
+)
+
+func (p *DataTracker) renderLimits() (timeout time.Duration, size int64, depth int) {
+	timeout, size, depth = p.RenderTimeout, p.RenderMaxSize, p.RenderMaxDepth
+	if timeout <= 0 {
+		timeout = DefaultRenderTimeout
+	}
+	if size <= 0 {
+		size = DefaultRenderMaxSize
+	}
+	if depth <= 0 {
+		depth = DefaultRenderMaxDepth
+	}
+	return
 }
 
 func (p *DataTracker) LogFor(s string) logger.Logger {
@@ -491,6 +584,9 @@ func allKeySavers() []models.Model {
 		&Plugin{},
 		&Job{},
 		&Tenant{},
+		&Schedule{},
+		&Rollout{},
+		&Inventory{},
 	}
 }
 
@@ -857,7 +953,16 @@ func NewDataTracker(backend *DataStack,
 		macAddrMux:        &sync.RWMutex{},
 		secretsMux:        &sync.Mutex{},
 		pc:                pc,
+		coordination:      newCoordinator(),
+		artifactMux:       &sync.Mutex{},
+		jobLogMux:         &sync.Mutex{},
+		jobLogFollowers:   map[string]map[chan struct{}]struct{}{},
+		consoleMux:        &sync.Mutex{},
+		heartbeatMux:      &sync.Mutex{},
+		heartbeats:        map[string]heartbeat{},
+		heartbeatsSince:   time.Now(),
 	}
+	res.FS.AddDynamicTree(CloudInitRoot, res.cloudInitTree())
 
 	// Make sure incoming writable backend has all stores created
 	loadRT := res.Request(logger)
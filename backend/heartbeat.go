@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// DefaultHeartbeatStale is how long after its last heartbeat the agent
+// on a Machine is considered unresponsive when the DataTracker
+// HeartbeatStale field is left at zero.
+const DefaultHeartbeatStale = 90 * time.Second
+
+func (p *DataTracker) heartbeatStale() time.Duration {
+	if p.HeartbeatStale <= 0 {
+		return DefaultHeartbeatStale
+	}
+	return p.HeartbeatStale
+}
+
+// heartbeat is the last heartbeat the agent on a Machine sent.
+// Agents send them every few seconds, so they are kept in memory
+// instead of being saved with the Machine each time.  The Machine
+// is only saved when its Liveness changes.
+type heartbeat struct {
+	lastSeen time.Time
+	hb       models.AgentHeartbeat
+}
+
+// lastHeartbeat returns the last heartbeat from the agent on the
+// Machine with key since dr-provision started, if there was one.
+func (p *DataTracker) lastHeartbeat(key string) (heartbeat, bool) {
+	p.heartbeatMux.Lock()
+	defer p.heartbeatMux.Unlock()
+	hb, ok := p.heartbeats[key]
+	return hb, ok
+}
+
+// forgetHeartbeat drops the last heartbeat of a deleted Machine.
+func (p *DataTracker) forgetHeartbeat(key string) {
+	p.heartbeatMux.Lock()
+	defer p.heartbeatMux.Unlock()
+	delete(p.heartbeats, key)
+}
+
+// mergeHeartbeat fills in LastSeen and Heartbeat on m from the last
+// heartbeat kept in memory.
+func (p *DataTracker) mergeHeartbeat(m *models.Machine) {
+	if hb, ok := p.lastHeartbeat(m.Key()); ok && hb.lastSeen.After(m.LastSeen) {
+		m.LastSeen, m.Heartbeat = hb.lastSeen, hb.hb
+	}
+}
+
+// MergeHeartbeat fills in LastSeen and Heartbeat from the last
+// heartbeat if obj is a Machine, since they are not saved with the
+// Machine for every heartbeat.  Liveness is always up to date.
+func (rt *RequestTracker) MergeHeartbeat(obj models.Model) {
+	switch m := obj.(type) {
+	case *Machine:
+		rt.dt.mergeHeartbeat(m.Machine)
+	case *models.Machine:
+		rt.dt.mergeHeartbeat(m)
+	}
+}
+
+// Heartbeat records a heartbeat from the agent on the Machine, and
+// returns the Machine with its LastSeen and Heartbeat updated.  The
+// Machine is only saved if it was not already alive, in which case a
+// machines alive event is published if it was stale.  The caller must
+// hold the machines lock for writing.
+func (n *Machine) Heartbeat(rt *RequestTracker, hb *models.AgentHeartbeat, now time.Time) (*Machine, error) {
+	rt.dt.heartbeatMux.Lock()
+	rt.dt.heartbeats[n.Key()] = heartbeat{lastSeen: now, hb: *hb}
+	rt.dt.heartbeatMux.Unlock()
+	m := ModelToBackend(models.Clone(n.Machine)).(*Machine)
+	m.LastSeen = now
+	m.Heartbeat = *hb
+	if m.Liveness == "alive" {
+		return m, nil
+	}
+	wasStale := m.Liveness == "stale"
+	m.Liveness = "alive"
+	m.inHeartbeat = true
+	if _, err := rt.Update(m); err != nil {
+		return nil, err
+	}
+	if wasStale {
+		rt.Infof("Agent on machine %s is alive again", m.Name)
+		rt.Publish("machines", "alive", m.Key(), m)
+	}
+	return m, nil
+}
+
+// MarkStaleMachines marks the alive Machines whose agents have not
+// sent a heartbeat since HeartbeatStale before now as stale, and
+// publishes a machines stale event for each of them.  It returns the
+// keys of the Machines it marked.  Agents get at least HeartbeatStale
+// after dr-provision starts to send their first heartbeat to it.
+func (p *DataTracker) MarkStaleMachines(now time.Time) []string {
+	marked := []string{}
+	rt := p.Request(p.Logger,
+		"stages",
+		"bootenvs",
+		"machines:rw",
+		"tasks",
+		"profiles",
+		"templates",
+		"workflows",
+		"params")
+	limit := p.heartbeatStale()
+	rt.Do(func(d Stores) {
+		for _, obj := range d("machines").Items() {
+			old := AsMachine(obj)
+			if old.Liveness != "alive" {
+				continue
+			}
+			m := ModelToBackend(models.Clone(old.Machine)).(*Machine)
+			p.mergeHeartbeat(m.Machine)
+			seen := m.LastSeen
+			if seen.Before(p.heartbeatsSince) {
+				seen = p.heartbeatsSince
+			}
+			if seen.Add(limit).After(now) {
+				continue
+			}
+			m.Liveness = "stale"
+			m.inHeartbeat = true
+			if _, err := rt.Update(m); err != nil {
+				rt.Errorf("Failed to mark machine %s as stale: %v", m.Key(), err)
+				continue
+			}
+			rt.Warnf("Agent on machine %s has not sent a heartbeat since %s", m.Name, m.LastSeen)
+			rt.Publish("machines", "stale", m.Key(), m)
+			marked = append(marked, m.Key())
+		}
+	})
+	return marked
+}
+
+// LivenessMonitor periodically calls MarkStaleMachines until it is
+// shut down.
+type LivenessMonitor struct {
+	periodic
+	dt *DataTracker
+}
+
+// NewLivenessMonitor starts looking for Machines whose agents have
+// stopped sending heartbeats every interval.
+func NewLivenessMonitor(dt *DataTracker, interval time.Duration) *LivenessMonitor {
+	l := &LivenessMonitor{dt: dt}
+	l.start(interval, func(now time.Time) { l.dt.MarkStaleMachines(now) }, nil)
+	return l
+}
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestMachineHeartbeat(t *testing.T) {
+	dt := mkDT()
+	dt.HeartbeatStale = time.Minute
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "machines:rw", "tasks", "profiles", "params", "workflows")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "beating.fqdn", Liveness: "alive"}
+	tests := []crudTest{
+		{"Create machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	if machine.Liveness != "" || !machine.LastSeen.IsZero() {
+		t.Errorf("Expected a new machine to have no liveness, not %q since %s", machine.Liveness, machine.LastSeen)
+	}
+	now := time.Now()
+	hb := &models.AgentHeartbeat{Version: "v4.0.0", State: "RUN_TASK", Uptime: 10, BootTime: now.Add(-time.Hour)}
+	rt.Do(func(d Stores) {
+		m, err := AsMachine(rt.find("machines", machine.Key())).Heartbeat(rt, hb, now)
+		if err != nil {
+			t.Fatalf("Failed to record heartbeat: %v", err)
+		}
+		if m.Liveness != "alive" || !m.LastSeen.Equal(now) || m.Heartbeat.State != "RUN_TASK" {
+			t.Errorf("Expected an alive machine seen at %s, not %q at %s: %v", now, m.Liveness, m.LastSeen, m.Heartbeat)
+		}
+		// Users cannot change the liveness of a Machine.
+		upd := ModelToBackend(models.Clone(m.Machine)).(*Machine)
+		upd.Liveness = "stale"
+		upd.LastSeen = time.Time{}
+		if _, err := rt.Update(upd); err != nil {
+			t.Errorf("Failed to update machine: %v", err)
+		}
+		if m = AsMachine(rt.find("machines", machine.Key())); m.Liveness != "alive" || !m.LastSeen.Equal(now) {
+			t.Errorf("Expected liveness to be read-only, not %q at %s", m.Liveness, m.LastSeen)
+		}
+		// Heartbeats from an alive Machine are only kept in memory.
+		later := now.Add(10 * time.Second)
+		if _, err := m.Heartbeat(rt, hb, later); err != nil {
+			t.Errorf("Failed to record heartbeat: %v", err)
+		}
+		if m = AsMachine(rt.find("machines", machine.Key())); !m.LastSeen.Equal(now) {
+			t.Errorf("Expected a heartbeat from an alive machine not to be saved, but it was seen at %s", m.LastSeen)
+		}
+		m = AsMachine(rt.Find("machines", machine.Key()))
+		if rt.MergeHeartbeat(m); !m.LastSeen.Equal(later) {
+			t.Errorf("Expected the machine to be seen at %s, not %s", later, m.LastSeen)
+		}
+	})
+	if marked := dt.MarkStaleMachines(now.Add(30 * time.Second)); len(marked) != 0 {
+		t.Errorf("Marked machines that are still alive as stale: %v", marked)
+	}
+	marked := dt.MarkStaleMachines(now.Add(2 * time.Minute))
+	if len(marked) != 1 || marked[0] != machine.Key() {
+		t.Fatalf("Expected to mark only %s as stale, not %v", machine.Key(), marked)
+	}
+	if again := dt.MarkStaleMachines(now.Add(3 * time.Minute)); len(again) != 0 {
+		t.Errorf("Marked stale machines as stale again: %v", again)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", machine.Key()))
+		if m.Liveness != "stale" {
+			t.Errorf("Expected a stale machine, not %q", m.Liveness)
+		}
+		idx, ok := m.Indexes()["Liveness"]
+		if !ok {
+			t.Fatalf("Expected machines to have a Liveness index")
+		}
+		ref, _ := idx.Fill("stale")
+		if !idx.Eq(m, ref) {
+			t.Errorf("Expected the Liveness index to find the stale machine")
+		}
+		if m, _ = m.Heartbeat(rt, hb, now.Add(4*time.Minute)); m == nil || m.Liveness != "alive" {
+			t.Errorf("Expected a heartbeat to bring the machine back to life")
+		}
+	})
+}
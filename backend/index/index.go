@@ -6,6 +6,7 @@ import (
 	"log"
 	"regexp"
 	s "sort"
+	"strings"
 
 	"github.com/digitalrebar/provision/models"
 )
@@ -788,3 +789,64 @@ func Uniq(q Filter) Filter {
 		return sf, nil
 	}
 }
+
+// ParseFilter turns a filter value from a list query into a Filter.
+// If no function is specified, Eq is assumed.
+// Supported Forms:
+//
+//	Eq(value)
+//	Lt(value)
+//	Lte(value)
+//	Gt(value)
+//	Gte(value)
+//	Ne(value)
+//	Re(regex)
+//	Between(valueLower, valueHigher)
+//	Except(valueLower, valueHigher)
+//	In(value1,value2,...)
+//	Nin(value1,value2,...)
+func ParseFilter(v string) (Filter, error) {
+	args := strings.SplitN(v, "(", 2)
+	if len(args) == 1 || args[1] == "" || !strings.HasSuffix(args[1], ")") {
+		return Eq(v), nil
+	}
+	subargs := strings.TrimSuffix(args[1], ")")
+	switch args[0] {
+	case "Eq":
+		return Eq(subargs), nil
+	case "Re":
+		return Re(subargs), nil
+	case "Lt":
+		return Lt(subargs), nil
+	case "Lte":
+		return Lte(subargs), nil
+	case "Gt":
+		return Gt(subargs), nil
+	case "Gte":
+		return Gte(subargs), nil
+	case "Ne":
+		return Ne(subargs), nil
+	case "Between":
+		parts := strings.Split(subargs, ",")
+		return Between(parts[0], parts[1]), nil
+	case "Except":
+		parts := strings.Split(subargs, ",")
+		return Except(parts[0], parts[1]), nil
+	case "In":
+		parts := strings.Split(subargs, ",")
+		subf := make([]Filter, len(parts))
+		for i := range parts {
+			subf[i] = Eq(parts[i])
+		}
+		return Uniq(Any(subf...)), nil
+	case "Nin":
+		parts := strings.Split(subargs, ",")
+		subf := make([]Filter, len(parts))
+		for i := range parts {
+			subf[i] = Ne(parts[i])
+		}
+		return Uniq(All(subf...)), nil
+	default:
+		return Eq(v), nil
+	}
+}
@@ -0,0 +1,293 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/store"
+	"github.com/pborman/uuid"
+)
+
+// Inventory is the backend model wrapper for Inventory.
+type Inventory struct {
+	*models.Inventory
+	validate
+	// what changed in the hardware when the Inventory was last
+	// saved, for AfterSave to publish.
+	changes []string
+}
+
+// SetReadOnly is a helper function to set the ReadOnly flag.
+func (i *Inventory) SetReadOnly(b bool) {
+	i.ReadOnly = b
+}
+
+// SaveClean clears validation fields and returns a KeySaver
+// object for use by the backing store.
+func (i *Inventory) SaveClean() store.KeySaver {
+	mod := *i.Inventory
+	mod.ClearValidation()
+	return toBackend(&mod, i.rt)
+}
+
+// AsInventory converts a models.Model into an *Inventory.
+func AsInventory(o models.Model) *Inventory {
+	return o.(*Inventory)
+}
+
+// AsInventories converts a list of models.Model into a list of
+// *Inventory.
+func AsInventories(o []models.Model) []*Inventory {
+	res := make([]*Inventory, len(o))
+	for i := range o {
+		res[i] = AsInventory(o[i])
+	}
+	return res
+}
+
+// New returns a new empty Inventory with the RT field from the caller.
+func (i *Inventory) New() store.KeySaver {
+	res := &Inventory{Inventory: &models.Inventory{}}
+	if i.Inventory != nil && i.ChangeForced() {
+		res.ForceChange()
+	}
+	res.rt = i.rt
+	res.Fill()
+	return res
+}
+
+// stringIndex makes an index on a string field of the Inventory.
+func (i *Inventory) stringIndex(get func(*Inventory) string, set func(*Inventory, string)) index.Maker {
+	fix := AsInventory
+	return index.Maker{
+		Unique: false,
+		Type:   "string",
+		Less:   func(a, b models.Model) bool { return get(fix(a)) < get(fix(b)) },
+		Eq:     func(a, b models.Model) bool { return get(fix(a)) == get(fix(b)) },
+		Match:  func(a models.Model, re *regexp.Regexp) bool { return re.MatchString(get(fix(a))) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			val := get(fix(ref))
+			return func(s models.Model) bool {
+					return get(fix(s)) >= val
+				},
+				func(s models.Model) bool {
+					return get(fix(s)) > val
+				}
+		},
+		Fill: func(s string) (models.Model, error) {
+			res := fix(i.New())
+			set(res, s)
+			return res, nil
+		},
+	}
+}
+
+// intIndex makes an index on a number in the Inventory.
+func (i *Inventory) intIndex(get func(*Inventory) int64, set func(*Inventory, int64)) index.Maker {
+	fix := AsInventory
+	return index.Maker{
+		Unique: false,
+		Type:   "integer",
+		Less:   func(a, b models.Model) bool { return get(fix(a)) < get(fix(b)) },
+		Eq:     func(a, b models.Model) bool { return get(fix(a)) == get(fix(b)) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			val := get(fix(ref))
+			return func(s models.Model) bool {
+					return get(fix(s)) >= val
+				},
+				func(s models.Model) bool {
+					return get(fix(s)) > val
+				}
+		},
+		Fill: func(s string) (models.Model, error) {
+			val, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid number: %s", s)
+			}
+			res := fix(i.New())
+			set(res, val)
+			return res, nil
+		},
+	}
+}
+
+// Indexes returns the valid Indexes on Inventory.
+func (i *Inventory) Indexes() map[string]index.Maker {
+	fix := AsInventory
+	res := index.MakeBaseIndexes(i)
+	res["Machine"] = index.Maker{
+		Unique: true,
+		Type:   "UUID string",
+		Less:   func(a, b models.Model) bool { return fix(a).Machine.String() < fix(b).Machine.String() },
+		Eq:     func(a, b models.Model) bool { return fix(a).Machine.String() == fix(b).Machine.String() },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			refUuid := fix(ref).Machine.String()
+			return func(s models.Model) bool {
+					return fix(s).Machine.String() >= refUuid
+				},
+				func(s models.Model) bool {
+					return fix(s).Machine.String() > refUuid
+				}
+		},
+		Fill: func(s string) (models.Model, error) {
+			id := uuid.Parse(s)
+			if id == nil {
+				return nil, fmt.Errorf("Invalid UUID: %s", s)
+			}
+			res := fix(i.New())
+			res.Machine = id
+			return res, nil
+		},
+	}
+	res["Manufacturer"] = i.stringIndex(
+		func(r *Inventory) string { return r.System.Manufacturer },
+		func(r *Inventory, s string) { r.System.Manufacturer = s })
+	res["ProductName"] = i.stringIndex(
+		func(r *Inventory) string { return r.System.ProductName },
+		func(r *Inventory, s string) { r.System.ProductName = s })
+	res["SerialNumber"] = i.stringIndex(
+		func(r *Inventory) string { return r.System.SerialNumber },
+		func(r *Inventory, s string) { r.System.SerialNumber = s })
+	res["BIOSVersion"] = i.stringIndex(
+		func(r *Inventory) string { return r.Firmware.BIOSVersion },
+		func(r *Inventory, s string) { r.Firmware.BIOSVersion = s })
+	res["CPUModel"] = i.stringIndex(
+		func(r *Inventory) string {
+			if len(r.CPUs) == 0 {
+				return ""
+			}
+			return r.CPUs[0].Model
+		},
+		func(r *Inventory, s string) { r.CPUs = []models.InventoryCPU{{Model: s}} })
+	res["Cores"] = i.intIndex(
+		func(r *Inventory) int64 { return int64(r.Cores()) },
+		func(r *Inventory, v int64) { r.CPUs = []models.InventoryCPU{{Cores: int(v)}} })
+	res["Memory"] = i.intIndex(
+		func(r *Inventory) int64 { return r.Memory },
+		func(r *Inventory, v int64) { r.Memory = v })
+	res["MACs"] = index.MakeUnordered(
+		"list",
+		func(a, b models.Model) bool {
+			have := map[string]struct{}{}
+			for _, mac := range fix(a).MACs() {
+				have[mac] = struct{}{}
+			}
+			for _, mac := range fix(b).MACs() {
+				if _, ok := have[mac]; !ok {
+					return false
+				}
+			}
+			return true
+		},
+		func(s string) (models.Model, error) {
+			res := fix(i.New())
+			for _, mac := range strings.Split(s, ",") {
+				res.NICs = append(res.NICs, models.InventoryNIC{MAC: strings.TrimSpace(mac)})
+			}
+			return res, nil
+		})
+	return res
+}
+
+var inventoryLockMap = map[string][]string{
+	"get":     {"inventories"},
+	"create":  {"inventories:rw", "machines"},
+	"update":  {"inventories:rw", "machines"},
+	"patch":   {"inventories:rw", "machines"},
+	"delete":  {"inventories:rw"},
+	"actions": {"inventories", "profiles", "params"},
+}
+
+// Locks returns a list of prefixes to lock for the specified action.
+func (i *Inventory) Locks(action string) []string {
+	return inventoryLockMap[action]
+}
+
+// Validate makes sure the Inventory is valid, and that its Machine
+// exists.
+func (i *Inventory) Validate() {
+	i.Inventory.Validate()
+	i.AddError(index.CheckUnique(i, i.rt.stores("inventories").Items()))
+	if i.Machine != nil && i.rt.find("machines", i.Key()) == nil {
+		i.Errorf("Machine %s does not exist", i.Key())
+	}
+	if i.SetValid() {
+		i.SetAvailable()
+	}
+}
+
+// BeforeSave returns an error if the Inventory is not valid.
+func (i *Inventory) BeforeSave() error {
+	i.Fill()
+	i.Validate()
+	if !i.Validated {
+		return i.MakeError(422, ValidationError, i)
+	}
+	return nil
+}
+
+// OnCreate starts the Inventory with an empty History.
+func (i *Inventory) OnCreate() error {
+	i.History = []models.InventoryChange{}
+	i.changes = nil
+	return nil
+}
+
+// OnChange keeps the History of the Inventory, and adds to it when
+// the hardware differs from the last report.
+func (i *Inventory) OnChange(oldThing store.KeySaver) error {
+	old := AsInventory(oldThing)
+	i.History = append([]models.InventoryChange{}, old.History...)
+	i.changes = i.Diff(old.Inventory)
+	if len(i.changes) > 0 {
+		i.AddChange(time.Now(), i.changes)
+	}
+	return nil
+}
+
+// AfterSave raises an "inventories changed" event when the hardware
+// of the Machine has changed.
+func (i *Inventory) AfterSave() {
+	if len(i.changes) > 0 {
+		i.rt.Infof("Hardware of machine %s changed: %s", i.Key(), strings.Join(i.changes, ", "))
+		i.rt.Publish("inventories", "changed", i.Key(), i)
+	}
+	i.changes = nil
+}
+
+// OnLoad initializes the Inventory when loaded from the data store.
+func (i *Inventory) OnLoad() error {
+	defer func() { i.rt = nil }()
+	i.Fill()
+	return i.BeforeSave()
+}
+
+// SubmitInventory saves the Inventory that the agent on the Machine
+// reports, creating it the first time.  Only the hardware is taken
+// from inv, so the Meta and ownership of an existing Inventory are
+// kept.  The caller must hold the inventories lock for writing.
+func (n *Machine) SubmitInventory(rt *RequestTracker, inv *models.Inventory) (*Inventory, error) {
+	inv.Machine = n.Uuid
+	found := rt.find("inventories", n.Key())
+	if found == nil {
+		res := ModelToBackend(models.Clone(inv)).(*Inventory)
+		if _, err := rt.Create(res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	res := ModelToBackend(models.Clone(AsInventory(found).Inventory)).(*Inventory)
+	res.Collected, res.Boot = inv.Collected, inv.Boot
+	res.System, res.Firmware = inv.System, inv.Firmware
+	res.CPUs, res.Memory, res.DIMMs = inv.CPUs, inv.Memory, inv.DIMMs
+	res.Disks, res.NICs, res.PCIDevices = inv.Disks, inv.NICs, inv.PCIDevices
+	if _, err := rt.Update(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
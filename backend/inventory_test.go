@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestInventory(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "machines:rw", "tasks", "profiles", "params", "workflows", "jobs:rw", "inventories:rw")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "inventoried.fqdn"}
+	tests := []crudTest{
+		{"Create machine", rt.Create, machine, true},
+		{"Create inventory for a missing machine", rt.Create, &models.Inventory{Machine: uuid.NewRandom()}, false},
+		{"Create inventory with a bad MAC", rt.Create, &models.Inventory{Machine: machine.Uuid, NICs: []models.InventoryNIC{{Name: "eth0", MAC: "nope"}}}, false},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	inv := &models.Inventory{
+		System: models.InventorySystem{Manufacturer: "Acme", ProductName: "R1000"},
+		CPUs: []models.InventoryCPU{
+			{Socket: 0, Model: "Xeon", Cores: 8, Threads: 16},
+			{Socket: 1, Model: "Xeon", Cores: 8, Threads: 16},
+		},
+		Memory: 64 << 30,
+		NICs: []models.InventoryNIC{
+			{Name: "eno1", MAC: "52:54:00:12:34:56", Speed: 10000, Link: true},
+			{Name: "eno2", MAC: "52:54:00:12:34:57"},
+		},
+		Disks: []models.InventoryDisk{{Name: "sda", SerialNumber: "S1", Size: 1 << 40}},
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", machine.Key()))
+		res, err := m.SubmitInventory(rt, models.Clone(inv).(*models.Inventory))
+		if err != nil {
+			t.Fatalf("Failed to submit inventory: %v", err)
+		}
+		if res.Key() != machine.Key() || len(res.History) != 0 {
+			t.Errorf("Expected a new inventory for %s with no history, not %s: %v", machine.Key(), res.Key(), res.History)
+		}
+		// Reordering the hardware is not a change.
+		same := models.Clone(inv).(*models.Inventory)
+		same.NICs[0], same.NICs[1] = same.NICs[1], same.NICs[0]
+		same.Collected = time.Now()
+		if res, err = m.SubmitInventory(rt, same); err != nil || len(res.History) != 0 {
+			t.Errorf("Expected no hardware change, not %v: %v", res.History, err)
+		}
+		// Users cannot rewrite the history.
+		res.Meta["color"] = "blue"
+		res.History = []models.InventoryChange{{Time: time.Now(), Changes: []string{"fake"}}}
+		if _, err := rt.Update(res); err != nil {
+			t.Errorf("Failed to update inventory: %v", err)
+		}
+		changed := models.Clone(inv).(*models.Inventory)
+		changed.NICs = changed.NICs[:1]
+		changed.Disks[0].Size = 2 << 40
+		changed.Memory = 32 << 30
+		if res, err = m.SubmitInventory(rt, changed); err != nil {
+			t.Fatalf("Failed to submit changed inventory: %v", err)
+		}
+		expected := []string{
+			"Memory: changed from 68719476736 to 34359738368",
+			"Disks: changed S1",
+			"NICs: removed 52:54:00:12:34:57",
+		}
+		if len(res.History) != 1 || !reflect.DeepEqual(res.History[0].Changes, expected) {
+			t.Errorf("Expected one change %v, not %v", expected, res.History)
+		}
+		if res.Meta["color"] != "blue" {
+			t.Errorf("Expected submitting an inventory to keep its Meta, not %v", res.Meta)
+		}
+		for name, val := range map[string]string{
+			"Manufacturer": "Acme",
+			"Cores":        "16",
+			"Memory":       "34359738368",
+			"MACs":         "52:54:00:12:34:56",
+		} {
+			idx, ok := res.Indexes()[name]
+			if !ok {
+				t.Errorf("Expected inventories to have a %s index", name)
+				continue
+			}
+			ref, err := idx.Fill(val)
+			if err != nil || !idx.EqualItems(res, ref) {
+				t.Errorf("Expected the %s index to find the inventory by %s: %v", name, val, err)
+			}
+		}
+	})
+	tests = []crudTest{
+		{"Remove machine", rt.Remove, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		if rt.find("inventories", machine.Key()) != nil {
+			t.Errorf("Expected removing the machine to remove its inventory")
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// The DataTracker ArtifactMaxSize and ArtifactMaxTotal fields limit
+// how big a single Job artifact may be, and how big all the artifacts
+// of a Job may be together.  These are used when they are left at
+// zero.
+const (
+	DefaultArtifactMaxSize  = 64 << 20
+	DefaultArtifactMaxTotal = 256 << 20
+)
+
+func (p *DataTracker) artifactLimits() (size, total int64) {
+	size, total = p.ArtifactMaxSize, p.ArtifactMaxTotal
+	if size <= 0 {
+		size = DefaultArtifactMaxSize
+	}
+	if total <= 0 {
+		total = DefaultArtifactMaxTotal
+	}
+	return
+}
+
+// ArtifactPath returns the directory the artifacts of the Job are
+// stored in, next to its log.
+func (j *Job) ArtifactPath(rt *RequestTracker) string {
+	return j.LogPath(rt) + ".artifacts"
+}
+
+func artifactError(j *Job, code int, f string, args ...interface{}) *models.Error {
+	err := &models.Error{
+		Code:  code,
+		Type:  ValidationError,
+		Model: j.Prefix(),
+		Key:   j.Key(),
+	}
+	err.Errorf(f, args...)
+	return err
+}
+
+func readArtifacts(dir string) ([]models.JobArtifact, error) {
+	res := []models.JobArtifact{}
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return nil, err
+	}
+	for _, ent := range ents {
+		if !ent.Mode().IsRegular() || models.ValidName("", ent.Name()) != nil {
+			continue
+		}
+		res = append(res, models.JobArtifact{
+			Name:     ent.Name(),
+			Size:     ent.Size(),
+			Modified: ent.ModTime(),
+		})
+	}
+	sort.Slice(res, func(i, k int) bool { return res[i].Name < res[k].Name })
+	return res, nil
+}
+
+// Artifacts lists the artifacts of the Job in order of their names.
+func (j *Job) Artifacts(rt *RequestTracker) ([]models.JobArtifact, error) {
+	return readArtifacts(j.ArtifactPath(rt))
+}
+
+// ArtifactFile returns the path to the named artifact of the Job, or
+// a NotFound error if there is no such artifact.
+func (j *Job) ArtifactFile(rt *RequestTracker, name string) (string, error) {
+	if models.ValidName("", name) != nil {
+		return "", artifactError(j, http.StatusNotFound, "Job %s has no artifact %s", j.Key(), name)
+	}
+	path := filepath.Join(j.ArtifactPath(rt), name)
+	if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+		return "", artifactError(j, http.StatusNotFound, "Job %s has no artifact %s", j.Key(), name)
+	}
+	return path, nil
+}
+
+// PutArtifact stores src as the named artifact of the Job, replacing
+// any artifact that already has that name.  It fails with
+// StatusRequestEntityTooLarge if the artifact is bigger than
+// ArtifactMaxSize, or if it would make the artifacts of the Job bigger
+// than ArtifactMaxTotal.
+func (j *Job) PutArtifact(rt *RequestTracker, name string, src io.Reader) (*models.JobArtifact, error) {
+	if err := models.ValidName("Invalid artifact name", name); err != nil {
+		return nil, artifactError(j, http.StatusBadRequest, "%v", err)
+	}
+	maxSize, maxTotal := rt.dt.artifactLimits()
+	dir := j.ArtifactPath(rt)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(dir, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, io.LimitReader(src, maxSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size > maxSize {
+		return nil, artifactError(j, http.StatusRequestEntityTooLarge,
+			"Artifact %s is bigger than the %d bytes allowed", name, maxSize)
+	}
+	rt.dt.artifactMux.Lock()
+	defer rt.dt.artifactMux.Unlock()
+	have, err := readArtifacts(dir)
+	if err != nil {
+		return nil, err
+	}
+	total := size
+	for _, a := range have {
+		if a.Name != name {
+			total += a.Size
+		}
+	}
+	if total > maxTotal {
+		return nil, artifactError(j, http.StatusRequestEntityTooLarge,
+			"Job %s would have %d bytes of artifacts, more than the %d bytes allowed", j.Key(), total, maxTotal)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	rt.Debugf("Job %s: stored %d byte artifact %s", j.Key(), size, name)
+	return &models.JobArtifact{Name: name, Size: fi.Size(), Modified: fi.ModTime()}, nil
+}
@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobArtifacts(t *testing.T) {
+	dt := mkDT()
+	dt.ArtifactMaxSize = 10
+	dt.ArtifactMaxTotal = 16
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles", "params", "jobs:rw", "workflows")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "artifacts.fqdn"}
+	job := &models.Job{Uuid: uuid.NewRandom(), Previous: uuid.NIL, Machine: machine.Uuid, Stage: "inventory", Task: "lshw", State: "finished"}
+	tests := []crudTest{
+		{"Create task", rt.Create, &models.Task{Name: "lshw"}, true},
+		{"Create stage", rt.Create, &models.Stage{Name: "inventory", Tasks: []string{"lshw"}}, true},
+		{"Create machine", rt.Create, machine, true},
+		{"Create job", rt.Create, job, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var j *Job
+	rt.Do(func(d Stores) { j = AsJob(rt.find("jobs", job.Key())) })
+	errCode := func(err error) int {
+		if err == nil {
+			return 0
+		}
+		return err.(*models.Error).Code
+	}
+	put := func(name, body string) (*models.JobArtifact, error) {
+		return j.PutArtifact(rt, name, strings.NewReader(body))
+	}
+
+	if _, err := put("../escape", "nope"); errCode(err) != http.StatusBadRequest {
+		t.Errorf("Expected a bad artifact name to fail, not %v", err)
+	}
+	if _, err := put("big.txt", "12345678901"); errCode(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected an artifact over ArtifactMaxSize to fail, not %v", err)
+	}
+	if a, err := put("lshw.json", "1234567890"); err != nil || a.Size != 10 {
+		t.Errorf("Failed to put lshw.json: %v %v", a, err)
+	}
+	if _, err := put("smart.txt", "1234567"); errCode(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected artifacts over ArtifactMaxTotal to fail, not %v", err)
+	}
+	if _, err := put("smart.txt", "123456"); err != nil {
+		t.Errorf("Failed to put smart.txt: %v", err)
+	}
+	// Replacing an artifact only counts its new size.
+	if _, err := put("lshw.json", "12"); err != nil {
+		t.Errorf("Failed to replace lshw.json: %v", err)
+	}
+	arts, err := j.Artifacts(rt)
+	if err != nil || len(arts) != 2 || arts[0].Name != "lshw.json" || arts[0].Size != 2 || arts[1].Name != "smart.txt" {
+		t.Errorf("Expected lshw.json and smart.txt, not %v: %v", arts, err)
+	}
+	path, err := j.ArtifactFile(rt, "smart.txt")
+	if err != nil {
+		t.Fatalf("Failed to find smart.txt: %v", err)
+	}
+	if buf, err := ioutil.ReadFile(path); err != nil || string(buf) != "123456" {
+		t.Errorf("Expected smart.txt to hold 123456, not %q: %v", string(buf), err)
+	}
+	if _, err := j.ArtifactFile(rt, "missing.txt"); errCode(err) != http.StatusNotFound {
+		t.Errorf("Expected a missing artifact to not be found, not %v", err)
+	}
+
+	dir := j.ArtifactPath(rt)
+	crudTest{"Remove job", rt.Remove, job, true}.Test(t, rt)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected removing the job to purge its artifacts, not %v", err)
+	}
+}
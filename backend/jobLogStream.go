@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// jobLogChunkSize is the most log a JobLogStream returns at once.
+const jobLogChunkSize = 64 << 10
+
+// wakeJobLogFollowers tells everything following the log of the Job
+// with key that it has changed.  The caller must hold jobLogMux.
+func (p *DataTracker) wakeJobLogFollowers(key string) {
+	for wake := range p.jobLogFollowers[key] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wakeLogFollowers tells everything following the log of the Job that
+// it or the Job has changed.
+func (j *Job) wakeLogFollowers() {
+	j.rt.dt.jobLogMux.Lock()
+	defer j.rt.dt.jobLogMux.Unlock()
+	j.rt.dt.wakeJobLogFollowers(j.Key())
+}
+
+// JobLogStream follows the log of a Job as it is written.  Followers
+// are only woken up when the log changes, and read what they have not
+// seen yet from the log itself, so a slow follower never holds up the
+// Job or misses any of its log.
+type JobLogStream struct {
+	rt     *RequestTracker
+	key    string
+	offset int64
+	wake   chan struct{}
+	done   bool
+}
+
+// FollowLog starts following the log of the Job from offset.  The
+// JobLogStream must be closed once the caller is done with it.
+func (j *Job) FollowLog(rt *RequestTracker, offset int64) *JobLogStream {
+	s := &JobLogStream{
+		rt:     rt,
+		key:    j.Key(),
+		offset: offset,
+		wake:   make(chan struct{}, 1),
+	}
+	rt.dt.jobLogMux.Lock()
+	defer rt.dt.jobLogMux.Unlock()
+	if rt.dt.jobLogFollowers[s.key] == nil {
+		rt.dt.jobLogFollowers[s.key] = map[chan struct{}]struct{}{}
+	}
+	rt.dt.jobLogFollowers[s.key][s.wake] = struct{}{}
+	return s
+}
+
+// Close stops following the log.
+func (s *JobLogStream) Close() {
+	s.rt.dt.jobLogMux.Lock()
+	defer s.rt.dt.jobLogMux.Unlock()
+	delete(s.rt.dt.jobLogFollowers[s.key], s.wake)
+	if len(s.rt.dt.jobLogFollowers[s.key]) == 0 {
+		delete(s.rt.dt.jobLogFollowers, s.key)
+	}
+}
+
+// read reads the next part of the log after the offset.
+func (s *JobLogStream) read(j *Job) ([]byte, error) {
+	src, err := j.OpenLog(s.rt)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if seeker, ok := src.(io.Seeker); ok {
+		_, err = seeker.Seek(s.offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, src, s.offset)
+	}
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(io.LimitReader(src, jobLogChunkSize))
+}
+
+// Next waits until there is more of the log to return, the Job is
+// done, or ctx is done.  Once the last chunk has been returned, Next
+// returns io.EOF.  It fails with NotFound if the Job is removed or
+// archived.
+func (s *JobLogStream) Next(ctx context.Context) (*models.JobLogChunk, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	for {
+		var j *Job
+		s.rt.Do(func(d Stores) {
+			if obj := s.rt.find("jobs", s.key); obj != nil {
+				j = AsJob(obj)
+			}
+		})
+		if j == nil {
+			return nil, &models.Error{
+				Code:     http.StatusNotFound,
+				Type:     ValidationError,
+				Model:    "jobs",
+				Key:      s.key,
+				Messages: []string{"Job " + s.key + " does not exist"},
+			}
+		}
+		// Check whether the Job is done before reading, so that the
+		// log is complete once it has been read.
+		done := j.done()
+		buf, err := s.read(j)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) > 0 || done {
+			res := &models.JobLogChunk{Offset: s.offset, Data: buf}
+			s.offset += int64(len(buf))
+			if done && len(buf) < jobLogChunkSize {
+				res.Done = true
+				s.done = true
+			}
+			return res, nil
+		}
+		select {
+		case <-s.wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
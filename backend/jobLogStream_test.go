@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobLogStream(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles", "params", "jobs:rw", "workflows")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "follow.fqdn"}
+	job := &models.Job{Uuid: uuid.NewRandom(), Previous: uuid.NIL, Machine: machine.Uuid, Stage: "install", Task: "os", State: "running"}
+	tests := []crudTest{
+		{"Create task", rt.Create, &models.Task{Name: "os"}, true},
+		{"Create stage", rt.Create, &models.Stage{Name: "install", Tasks: []string{"os"}}, true},
+		{"Create machine", rt.Create, machine, true},
+		{"Create job", rt.Create, job, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var j *Job
+	rt.Do(func(d Stores) { j = AsJob(rt.find("jobs", job.Key())) })
+	appendLog := func(s string) {
+		rt.Do(func(d Stores) {
+			if err := AsJob(rt.find("jobs", job.Key())).Log(rt, bytes.NewBufferString(s)); err != nil {
+				t.Errorf("Failed to append %q to the log: %v", s, err)
+			}
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream := j.FollowLog(rt, 0)
+	defer stream.Close()
+	chunk, err := stream.Next(ctx)
+	if err != nil || chunk.Offset != 0 || !strings.Contains(string(chunk.Data), "Log for Job: "+job.Key()) {
+		t.Fatalf("Expected the log so far, not %v: %v", chunk, err)
+	}
+	header := int64(len(chunk.Data))
+
+	// Next waits for the log to be written to.
+	got := make(chan *models.JobLogChunk)
+	go func() {
+		chunk, err := stream.Next(ctx)
+		if err != nil {
+			t.Errorf("Failed to follow the log: %v", err)
+		}
+		got <- chunk
+	}()
+	select {
+	case chunk = <-got:
+		t.Fatalf("Expected Next to wait for the log, not return %v", chunk)
+	case <-time.After(100 * time.Millisecond):
+	}
+	appendLog("Installing\n")
+	if chunk = <-got; chunk == nil || chunk.Offset != header || string(chunk.Data) != "Installing\n" || chunk.Done {
+		t.Errorf("Expected the appended log at %d, not %v", header, chunk)
+	}
+
+	// A new stream can resume from an offset.
+	resumed := j.FollowLog(rt, header)
+	defer resumed.Close()
+	if chunk, err = resumed.Next(ctx); err != nil || chunk.Offset != header || string(chunk.Data) != "Installing\n" {
+		t.Errorf("Expected to resume at %d, not %v: %v", header, chunk, err)
+	}
+
+	// Following stops when the context is done.
+	waiting := j.FollowLog(rt, 1<<20)
+	defer waiting.Close()
+	short, stop := context.WithCancel(ctx)
+	stop()
+	if _, err = waiting.Next(short); err != context.Canceled {
+		t.Errorf("Expected following to be canceled, not %v", err)
+	}
+
+	// Once the Job is done, the last chunk says so.
+	appendLog("Done\n")
+	rt.Do(func(d Stores) {
+		finished := models.Clone(job).(*models.Job)
+		finished.State = "finished"
+		if _, err := rt.Update(finished); err != nil {
+			t.Errorf("Failed to finish job: %v", err)
+		}
+	})
+	if chunk, err = stream.Next(ctx); err != nil || string(chunk.Data) != "Done\n" || !chunk.Done {
+		t.Errorf("Expected the last chunk, not %v: %v", chunk, err)
+	}
+	if _, err = stream.Next(ctx); err != io.EOF {
+		t.Errorf("Expected the stream to end, not %v", err)
+	}
+}
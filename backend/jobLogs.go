@@ -0,0 +1,396 @@
+package backend
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// The DataTracker JobLog fields control how long Job logs are kept
+// around, and each of them is disabled when it is left at zero:
+//
+// JobLogCompressAge is how long after a Job is done its log is
+// compressed.
+//
+// JobLogMaxAge is how long after a Job is done it expires.
+//
+// JobLogMaxPerMachine is how many done Jobs with logs each Machine
+// may have before the oldest ones expire.
+//
+// JobLogMaxTotal is how many bytes of logs and artifacts all the
+// Jobs may have together before the oldest ones expire.
+//
+// Expired Jobs are removed, unless JobLogArchiveRoot is set.  Then
+// their logs and artifacts are moved there instead, and the Jobs are
+// marked as Archived.
+
+// compressedLogPath is where the log of the Job is once it has been
+// compressed.
+func (j *Job) compressedLogPath(rt *RequestTracker) string {
+	return j.LogPath(rt) + ".gz"
+}
+
+func (j *Job) done() bool {
+	return j.State == "finished" || j.State == "failed"
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// OpenLog opens the log of the Job for reading, decompressing it if
+// it has been compressed.  It fails with NotFound if the log has been
+// archived.
+func (j *Job) OpenLog(rt *RequestTracker) (io.ReadCloser, error) {
+	if j.Archived {
+		return nil, &models.Error{
+			Code:     http.StatusNotFound,
+			Type:     ValidationError,
+			Model:    j.Prefix(),
+			Key:      j.Key(),
+			Messages: []string{"The log for Job " + j.Key() + " has been archived"},
+		}
+	}
+	rt.dt.jobLogMux.Lock()
+	defer rt.dt.jobLogMux.Unlock()
+	f, err := os.Open(j.LogPath(rt))
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err = os.Open(j.compressedLogPath(rt))
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gz, f: f}, nil
+}
+
+// gzipFile compresses src into dst, and removes src once dst has been
+// written.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".gzip-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	gz := gzip.NewWriter(tmp)
+	_, err = io.Copy(gz, in)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err == nil {
+		err = os.Remove(src)
+	}
+	return err
+}
+
+// gunzipFile is the reverse of gzipFile.
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".gunzip-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, gz)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err == nil {
+		err = os.Remove(src)
+	}
+	return err
+}
+
+// uncompressLog makes sure the log of the Job is not compressed, so
+// that it can be appended to.  The caller must hold jobLogMux.
+func (j *Job) uncompressLog(rt *RequestTracker) error {
+	if _, err := os.Stat(j.compressedLogPath(rt)); err != nil {
+		return nil
+	}
+	return gunzipFile(j.compressedLogPath(rt), j.LogPath(rt))
+}
+
+// compressLog compresses the log of the Job, if it has not been
+// already.
+func (j *Job) compressLog(rt *RequestTracker) error {
+	rt.dt.jobLogMux.Lock()
+	defer rt.dt.jobLogMux.Unlock()
+	if _, err := os.Stat(j.LogPath(rt)); err != nil {
+		return nil
+	}
+	return gzipFile(j.LogPath(rt), j.compressedLogPath(rt))
+}
+
+// logSize returns how many bytes the log and the artifacts of the Job
+// take up.
+func (j *Job) logSize(rt *RequestTracker) int64 {
+	var res int64
+	for _, path := range []string{j.LogPath(rt), j.compressedLogPath(rt)} {
+		if fi, err := os.Stat(path); err == nil {
+			res += fi.Size()
+		}
+	}
+	if arts, err := j.Artifacts(rt); err == nil {
+		for _, a := range arts {
+			res += a.Size
+		}
+	}
+	return res
+}
+
+// moveFile moves src to dst, copying it if they are on different
+// filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// archiveLog moves the compressed log and the artifacts of the Job to
+// the archive.
+func (j *Job) archiveLog(rt *RequestTracker, root string) error {
+	rt.dt.jobLogMux.Lock()
+	defer rt.dt.jobLogMux.Unlock()
+	if _, err := os.Stat(j.LogPath(rt)); err == nil {
+		if err := gzipFile(j.LogPath(rt), j.compressedLogPath(rt)); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(j.compressedLogPath(rt)); err == nil {
+		if err := moveFile(j.compressedLogPath(rt), filepath.Join(root, j.Key()+".gz")); err != nil {
+			return err
+		}
+	}
+	arts, err := j.Artifacts(rt)
+	if err != nil || len(arts) == 0 {
+		return err
+	}
+	dst := filepath.Join(root, j.Key()+".artifacts")
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	for _, a := range arts {
+		if err := moveFile(filepath.Join(j.ArtifactPath(rt), a.Name), filepath.Join(dst, a.Name)); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(j.ArtifactPath(rt))
+}
+
+// expiredJobs returns the done Jobs whose logs should not be kept any
+// longer at now, oldest first.  Current and archived Jobs never
+// expire.
+func (p *DataTracker) expiredJobs(rt *RequestTracker, jobs []*Job, now time.Time) []*Job {
+	candidates := []*Job{}
+	var total int64
+	for _, j := range jobs {
+		if j.Archived {
+			continue
+		}
+		if p.JobLogMaxTotal > 0 {
+			total += j.logSize(rt)
+		}
+		if j.done() && !j.Current {
+			candidates = append(candidates, j)
+		}
+	}
+	sort.SliceStable(candidates, func(i, k int) bool {
+		return candidates[i].EndTime.Before(candidates[k].EndTime)
+	})
+	expired := map[string]bool{}
+	kept := map[string]int{}
+	expire := func(j *Job) {
+		expired[j.Key()] = true
+		if p.JobLogMaxTotal > 0 {
+			total -= j.logSize(rt)
+		}
+	}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		j := candidates[i]
+		if p.JobLogMaxAge > 0 && now.Sub(j.EndTime) > p.JobLogMaxAge {
+			expire(j)
+			continue
+		}
+		if p.JobLogMaxPerMachine > 0 {
+			if kept[j.Machine.String()] >= p.JobLogMaxPerMachine {
+				expire(j)
+				continue
+			}
+			kept[j.Machine.String()]++
+		}
+	}
+	for _, j := range candidates {
+		if p.JobLogMaxTotal > 0 && total > p.JobLogMaxTotal && !expired[j.Key()] {
+			expire(j)
+		}
+	}
+	res := []*Job{}
+	for _, j := range candidates {
+		if expired[j.Key()] {
+			res = append(res, j)
+		}
+	}
+	return res
+}
+
+// CleanJobLogs applies the JobLog retention settings at now.  The
+// logs of done Jobs are compressed once they are old enough, and
+// expired Jobs are archived or removed.  It returns the keys of the
+// expired Jobs.
+//
+// The logs are compressed, archived, and removed from a snapshot of
+// the Jobs without holding any locks, as that can take a while.  The
+// locks are only taken again to check that the expired Jobs are still
+// done before they are removed or marked as archived.
+func (p *DataTracker) CleanJobLogs(now time.Time) []string {
+	res := []string{}
+	jobs := []*Job{}
+	rt := p.Request(p.Logger, "jobs")
+	rt.Do(func(d Stores) {
+		for _, obj := range d("jobs").Items() {
+			jobs = append(jobs, AsJob(ModelToBackend(models.Clone(obj))))
+		}
+	})
+	if p.JobLogCompressAge > 0 {
+		for _, j := range jobs {
+			if j.Archived || !j.done() || now.Sub(j.EndTime) < p.JobLogCompressAge {
+				continue
+			}
+			if err := j.compressLog(rt); err != nil {
+				rt.Errorf("Failed to compress the log for job %s: %v", j.Key(), err)
+			}
+		}
+	}
+	expired := []*Job{}
+	for _, old := range p.expiredJobs(rt, jobs, now) {
+		if p.JobLogArchiveRoot == "" {
+			os.Remove(old.LogPath(rt))
+			os.Remove(old.compressedLogPath(rt))
+			os.RemoveAll(old.ArtifactPath(rt))
+		} else if err := old.archiveLog(rt, p.JobLogArchiveRoot); err != nil {
+			rt.Errorf("Failed to archive the log for job %s: %v", old.Key(), err)
+			continue
+		}
+		expired = append(expired, old)
+	}
+	if len(expired) == 0 {
+		return res
+	}
+	rt = p.Request(p.Logger,
+		"stages",
+		"bootenvs",
+		"jobs:rw",
+		"machines:rw",
+		"tasks",
+		"profiles",
+		"workflows",
+		"params")
+	rt.Do(func(d Stores) {
+		for _, old := range expired {
+			obj := rt.find("jobs", old.Key())
+			if obj == nil {
+				continue
+			}
+			if cur := AsJob(obj); cur.Archived || !cur.done() || cur.Current {
+				continue
+			}
+			if p.JobLogArchiveRoot == "" {
+				if _, err := rt.Remove(obj); err != nil {
+					rt.Errorf("Failed to remove expired job %s: %v", old.Key(), err)
+					continue
+				}
+				res = append(res, old.Key())
+				continue
+			}
+			job := ModelToBackend(models.Clone(obj)).(*Job)
+			job.Archived = true
+			if _, err := rt.Update(job); err != nil {
+				rt.Errorf("Failed to mark job %s as archived: %v", job.Key(), err)
+				continue
+			}
+			res = append(res, job.Key())
+		}
+		if len(res) > 0 {
+			rt.Infof("Expired %d job logs", len(res))
+		}
+	})
+	return res
+}
+
+// LogJanitor periodically calls CleanJobLogs until it is shut down.
+type LogJanitor struct {
+	periodic
+	dt *DataTracker
+}
+
+// NewLogJanitor starts cleaning up Job logs every interval.
+func NewLogJanitor(dt *DataTracker, interval time.Duration) *LogJanitor {
+	r := &LogJanitor{dt: dt}
+	r.start(interval, func(now time.Time) { r.dt.CleanJobLogs(now) }, nil)
+	return r
+}
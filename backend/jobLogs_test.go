@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobLogRetention(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles", "params", "jobs:rw", "workflows")
+	now := time.Now()
+	m1 := &models.Machine{Uuid: uuid.NewRandom(), Name: "retained1.fqdn"}
+	m2 := &models.Machine{Uuid: uuid.NewRandom(), Name: "retained2.fqdn"}
+	tests := []crudTest{
+		{"Create task", rt.Create, &models.Task{Name: "burnin"}, true},
+		{"Create stage", rt.Create, &models.Stage{Name: "burnin", Tasks: []string{"burnin"}}, true},
+		{"Create machine 1", rt.Create, m1, true},
+		{"Create machine 2", rt.Create, m2, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	mkJob := func(m *models.Machine, prev uuid.UUID, age time.Duration) *models.Job {
+		j := &models.Job{
+			Uuid:     uuid.NewRandom(),
+			Previous: prev,
+			Machine:  m.Uuid,
+			Stage:    "burnin",
+			Task:     "burnin",
+			State:    "finished",
+			EndTime:  now.Add(-age),
+		}
+		crudTest{"Create job", rt.Create, j, true}.Test(t, rt)
+		return j
+	}
+	day := 24 * time.Hour
+	j1 := mkJob(m1, uuid.NIL, 10*day)
+	j2 := mkJob(m1, j1.Uuid, 5*day)
+	j3 := mkJob(m1, j2.Uuid, 2*day)
+	j4 := mkJob(m1, j3.Uuid, time.Hour)
+	j5 := mkJob(m2, uuid.NIL, 30*day)
+	job := func(j *models.Job) (res *Job) {
+		rt.Do(func(d Stores) {
+			if o := rt.find("jobs", j.Key()); o != nil {
+				res = AsJob(o)
+			}
+		})
+		return
+	}
+	readLog := func(j *models.Job) (string, error) {
+		src, err := job(j).OpenLog(rt)
+		if err != nil {
+			return "", err
+		}
+		defer src.Close()
+		buf, err := ioutil.ReadAll(src)
+		return string(buf), err
+	}
+	compressed := func(j *models.Job) bool {
+		_, err := os.Stat(job(j).compressedLogPath(rt))
+		_, plainErr := os.Stat(job(j).LogPath(rt))
+		return err == nil && os.IsNotExist(plainErr)
+	}
+
+	// Logs are compressed a day after their jobs are done, and are
+	// still readable.
+	dt.JobLogCompressAge = day
+	if expired := dt.CleanJobLogs(now); len(expired) != 0 {
+		t.Errorf("Expected no jobs to expire, not %v", expired)
+	}
+	for _, j := range []*models.Job{j1, j2, j3, j5} {
+		if !compressed(j) {
+			t.Errorf("Expected the log for job %s to be compressed", j.Key())
+		}
+	}
+	if compressed(j4) {
+		t.Errorf("Expected the log for job %s to not be compressed yet", j4.Key())
+	}
+	if buf, err := readLog(j1); err != nil || !strings.Contains(buf, "Log for Job: "+j1.Key()) {
+		t.Errorf("Expected to read the compressed log for job %s, not %q: %v", j1.Key(), buf, err)
+	}
+	rt.Do(func(d Stores) {
+		if err := AsJob(rt.find("jobs", j1.Key())).Log(rt, bytes.NewBufferString("more\n")); err != nil {
+			t.Errorf("Failed to append to compressed log: %v", err)
+		}
+	})
+	if buf, err := readLog(j1); err != nil || !strings.HasSuffix(buf, "more\n") || compressed(j1) {
+		t.Errorf("Expected appending to uncompress the log for job %s, not %q: %v", j1.Key(), buf, err)
+	}
+	dt.JobLogCompressAge = 0
+
+	// Only the newest two done jobs of a machine keep their logs, and
+	// current jobs are never expired.
+	dt.JobLogMaxPerMachine = 2
+	if expired := dt.CleanJobLogs(now); len(expired) != 1 || expired[0] != j1.Key() {
+		t.Errorf("Expected only job %s to expire, not %v", j1.Key(), expired)
+	}
+	if job(j1) != nil {
+		t.Errorf("Expected job %s to be removed", j1.Key())
+	}
+	dt.JobLogMaxPerMachine = 0
+
+	// Old jobs are archived when there is an archive.
+	dt.JobLogMaxAge = 3 * day
+	dt.JobLogArchiveRoot = filepath.Join(tmpDir, "job-archive")
+	if expired := dt.CleanJobLogs(now); len(expired) != 1 || expired[0] != j2.Key() {
+		t.Errorf("Expected only job %s to expire, not %v", j2.Key(), expired)
+	}
+	if j := job(j2); j == nil || !j.Archived {
+		t.Errorf("Expected job %s to be archived", j2.Key())
+	}
+	if _, err := os.Stat(filepath.Join(dt.JobLogArchiveRoot, j2.Key()+".gz")); err != nil {
+		t.Errorf("Expected the log for job %s to be in the archive: %v", j2.Key(), err)
+	}
+	if _, err := readLog(j2); err == nil || err.(*models.Error).Code != http.StatusNotFound {
+		t.Errorf("Expected the archived log for job %s to not be found, not %v", j2.Key(), err)
+	}
+	if expired := dt.CleanJobLogs(now); len(expired) != 0 {
+		t.Errorf("Expected archived jobs to stay archived, not %v", expired)
+	}
+	dt.JobLogMaxAge = 0
+
+	// The oldest jobs expire until the logs fit.
+	dt.JobLogMaxTotal = 1
+	if expired := dt.CleanJobLogs(now); len(expired) != 1 || expired[0] != j3.Key() {
+		t.Errorf("Expected only job %s to expire, not %v", j3.Key(), expired)
+	}
+	for _, j := range []*models.Job{j4, j5} {
+		if o := job(j); o == nil || o.Archived {
+			t.Errorf("Expected current job %s to be kept", j.Key())
+		}
+	}
+}
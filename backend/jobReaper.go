@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// JobTimeoutGrace is how long past its Timeout a running Job is
+// given for its agent to kill it and report back before the server
+// fails it.
+const JobTimeoutGrace = 30 * time.Second
+
+// ReapJobs fails all the running Jobs that should have finished
+// before now.  Each reaped Job gets an ExitState of "timeout", an
+// ExitCode of models.JobTimeoutExitCode, a note in its log, and a jobs
+// timeout event, and its Machine is marked as not runnable just like
+// the agent would have done unless the Task's RetryPolicy says it
+// should be retried.  It returns the
+// keys of the reaped Jobs.
+func (p *DataTracker) ReapJobs(now time.Time) []string {
+	reaped := []string{}
+	rt := p.Request(p.Logger,
+		"stages",
+		"bootenvs",
+		"jobs:rw",
+		"machines:rw",
+		"tasks",
+		"profiles",
+		"templates",
+		"workflows",
+		"params")
+	rt.Do(func(d Stores) {
+		for _, obj := range d("jobs").Items() {
+			old := AsJob(obj)
+			if old.State != "running" || old.Timeout <= 0 {
+				continue
+			}
+			limit := time.Duration(old.Timeout) * time.Second
+			if old.StartTime.Add(limit + JobTimeoutGrace).After(now) {
+				continue
+			}
+			job := ModelToBackend(models.Clone(old.Job)).(*Job)
+			rt.Warnf("Job %s for task %s on machine %s timed out after %s", job.Key(), job.Task, job.Machine, limit)
+			job.State = "failed"
+			job.ExitState = "timeout"
+			job.ExitCode = models.JobTimeoutExitCode
+			job.EndTime = now
+			// Like the agent, stop the machine before failing the job,
+			// so that failing it can send the machine on through its
+			// Workflow.
+			if to := rt.find("tasks", job.Task); to != nil && AsTask(to).ShouldRetry(job.Job) {
+				rt.Infof("Job %s will be retried", job.Key())
+			} else if mo := rt.find("machines", job.Machine.String()); mo != nil {
+				m := ModelToBackend(models.Clone(AsMachine(mo).Machine)).(*Machine)
+				if m.Runnable && uuid.Equal(m.CurrentJob, job.Uuid) {
+					m.Runnable = false
+					rt.Update(m)
+				}
+			}
+			job.Log(rt, bytes.NewBufferString(fmt.Sprintf("\nJob timed out after %s and was failed by the server\n", limit)))
+			if _, err := rt.Update(job); err != nil {
+				rt.Errorf("Failed to mark job %s as timed out: %v", job.Key(), err)
+				continue
+			}
+			rt.Publish("jobs", "timeout", job.Key(), job)
+			reaped = append(reaped, job.Key())
+		}
+	})
+	return reaped
+}
+
+// JobReaper periodically calls ReapJobs until it is shut down.
+type JobReaper struct {
+	periodic
+	dt *DataTracker
+}
+
+// NewJobReaper starts reaping timed out Jobs every interval.
+func NewJobReaper(dt *DataTracker, interval time.Duration) *JobReaper {
+	r := &JobReaper{dt: dt}
+	r.start(interval, func(now time.Time) { r.dt.ReapJobs(now) }, nil)
+	return r
+}
@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobReaper(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles", "params", "jobs:rw", "workflows")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "reaped.fqdn"}
+	tests := []crudTest{
+		{"Create task with negative timeout", rt.Create, &models.Task{Name: "bad", Timeout: -1}, false},
+		{"Create task without timeout", rt.Create, &models.Task{Name: "untimed"}, true},
+		{"Create task with timeout", rt.Create, &models.Task{Name: "timed", Timeout: 60}, true},
+		{"Create stage with timeout", rt.Create, &models.Stage{Name: "slow", Timeout: 600, Tasks: []string{"timed", "untimed"}}, true},
+		{"Create machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	mkJob := func(task string) *models.Job {
+		return &models.Job{
+			Uuid:     uuid.NewRandom(),
+			Previous: uuid.NIL,
+			Machine:  machine.Uuid,
+			Stage:    "slow",
+			Task:     task,
+			State:    "running",
+		}
+	}
+	timed, untimed := mkJob("timed"), mkJob("untimed")
+	rt.Do(func(d Stores) {
+		for _, j := range []*models.Job{timed, untimed} {
+			if created, err := rt.Create(j); !created {
+				t.Fatalf("Failed to create job for %s: %v", j.Task, err)
+			}
+		}
+		m := AsMachine(rt.find("machines", machine.UUID()))
+		m.CurrentJob = timed.Uuid
+		m.Runnable = true
+		rt.Update(m)
+	})
+	if timed.Timeout != 60 || untimed.Timeout != 600 {
+		t.Errorf("Expected job timeouts of 60 and 600, not %d and %d", timed.Timeout, untimed.Timeout)
+	}
+	if reaped := dt.ReapJobs(time.Now()); len(reaped) != 0 {
+		t.Errorf("Reaped jobs that have not timed out: %v", reaped)
+	}
+	reaped := dt.ReapJobs(time.Now().Add(61*time.Second + JobTimeoutGrace))
+	if len(reaped) != 1 || reaped[0] != timed.Key() {
+		t.Fatalf("Expected to reap only %s, not %v", timed.Key(), reaped)
+	}
+	rt.Do(func(d Stores) {
+		job := AsJob(rt.find("jobs", timed.Key()))
+		if job.State != "failed" || job.ExitState != "timeout" || job.ExitCode != models.JobTimeoutExitCode {
+			t.Errorf("Expected reaped job to be failed with timeout, not %s/%s/%d", job.State, job.ExitState, job.ExitCode)
+		}
+		if job := AsJob(rt.find("jobs", untimed.Key())); job.State != "running" {
+			t.Errorf("Expected untimed job to still be running, not %s", job.State)
+		}
+		if m := AsMachine(rt.find("machines", machine.UUID())); m.Runnable {
+			t.Errorf("Expected machine to not be runnable after its job was reaped")
+		}
+	})
+}
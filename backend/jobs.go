@@ -152,6 +152,30 @@ func (j *Job) Indexes() map[string]index.Maker {
 			return job, nil
 		},
 	}
+	res["Parent"] = index.Maker{
+		Unique: false,
+		Type:   "UUID string",
+		Less:   func(i, j models.Model) bool { return fix(i).Parent.String() < fix(j).Parent.String() },
+		Eq:     func(i, j models.Model) bool { return fix(i).Parent.String() == fix(j).Parent.String() },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			refUuid := fix(ref).Parent.String()
+			return func(s models.Model) bool {
+					return fix(s).Parent.String() >= refUuid
+				},
+				func(s models.Model) bool {
+					return fix(s).Parent.String() > refUuid
+				}
+		},
+		Fill: func(s string) (models.Model, error) {
+			id := uuid.Parse(s)
+			if id == nil {
+				return nil, fmt.Errorf("Invalid UUID: %s", s)
+			}
+			job := fix(j.New())
+			job.Parent = id
+			return job, nil
+		},
+	}
 	res["Stage"] = index.Maker{
 		Unique: false,
 		Type:   "string",
@@ -380,8 +404,67 @@ func (j *Job) Indexes() map[string]index.Maker {
 	return res
 }
 
+// inGroup returns true if the Job runs one of the Tasks of a parallel
+// task group.  The group's own Job stands for it in the Job history,
+// so it is never the current Job of its Machine.
+func (j *Job) inGroup() bool {
+	return j.Parent != nil && !uuid.Equal(j.Parent, uuid.NIL)
+}
+
+// groupMembers returns the Jobs in the parallel task group of j.
+func (j *Job) groupMembers(rt *RequestTracker) []*Job {
+	members, err := index.All(
+		index.Sort(j.Indexes()["Parent"]),
+		index.Eq(j.Uuid.String()))(&rt.stores("jobs").Index)
+	if err != nil {
+		return nil
+	}
+	res := []*Job{}
+	for _, obj := range members.Items() {
+		res = append(res, AsJob(obj))
+	}
+	return res
+}
+
+// Members returns copies of the Jobs in the parallel task group of j.
+// It must be called with jobs locked.
+func (j *Job) Members(rt *RequestTracker) []*models.Job {
+	res := []*models.Job{}
+	for _, member := range j.groupMembers(rt) {
+		res = append(res, models.Clone(member.Job).(*models.Job))
+	}
+	return res
+}
+
+// updateGroupMembers makes sure none of the Jobs in the parallel task
+// group of j are current.  Once j has failed, nothing will wait on
+// the members that are still created or running, so they are failed
+// as well.
+func (j *Job) updateGroupMembers(failed bool) {
+	for _, member := range j.groupMembers(j.rt) {
+		if member.Current {
+			member.Current = false
+			j.rt.Save(member)
+		}
+		if !failed || (member.State != "created" && member.State != "running") {
+			continue
+		}
+		reaped := ModelToBackend(models.Clone(member.Job)).(*Job)
+		reaped.State = "failed"
+		if _, err := j.rt.Update(reaped); err != nil {
+			j.rt.Errorf("Failed to fail job %s in group %s: %v", member.Key(), j.Key(), err)
+			continue
+		}
+		reaped.Log(j.rt, bytes.NewBufferString(fmt.Sprintf("\nFailed because group job %s failed\n", j.Key())))
+	}
+}
+
 func (j *Job) OnCreate() error {
-	j.Current = true
+	j.Current = !j.inGroup()
+	j.Timeout = j.timeout()
+	if j.Attempt < 1 {
+		j.Attempt = 1
+	}
 	if _, err := os.Stat(j.LogPath(j.rt)); err != nil {
 		if f, err := os.Create(j.LogPath(j.rt)); err != nil {
 			j.AddError(err)
@@ -395,6 +478,18 @@ func (j *Job) OnCreate() error {
 	return j.HasError()
 }
 
+// timeout works out how long the Job may run from its Task, falling
+// back to its Stage.
+func (j *Job) timeout() int {
+	if obj := j.rt.find("tasks", j.Task); obj != nil && AsTask(obj).Timeout > 0 {
+		return AsTask(obj).Timeout
+	}
+	if obj := j.rt.find("stages", j.Stage); obj != nil {
+		return AsStage(obj).Timeout
+	}
+	return 0
+}
+
 func (j *Job) OnLoad() error {
 	defer func() { j.rt = nil }()
 	j.oldState = j.State
@@ -473,9 +568,20 @@ func (j *Job) BeforeSave() error {
 }
 
 func (j *Job) AfterSave() {
+	j.wakeLogFollowers()
+	failed := j.State == "failed" && j.oldState != "failed"
+	if failed {
+		j.rt.releaseCoordination(j.Machine)
+	}
+	if models.ParallelTasks(j.Task) != nil {
+		j.updateGroupMembers(failed)
+	}
 	if !j.Current {
 		return
 	}
+	if failed {
+		j.failed()
+	}
 	oldJ := j.rt.d("jobs").Find(j.Previous.String())
 	if oldJ == nil {
 		return
@@ -485,6 +591,47 @@ func (j *Job) AfterSave() {
 	j.rt.Save(oj)
 }
 
+// failed sends the Machine the Job ran on to the failure Stage of its
+// Workflow, if it has one and the Task will not be retried.  Jobs
+// that were failed without an ExitState were interrupted rather than
+// failing on their own, and are left alone.
+func (j *Job) failed() {
+	if j.ExitState == "" {
+		return
+	}
+	if obj := j.rt.find("tasks", j.Task); obj != nil && AsTask(obj).ShouldRetry(j.Job) {
+		return
+	}
+	mo := j.rt.find("machines", j.Machine.String())
+	if mo == nil {
+		return
+	}
+	m := AsMachine(mo)
+	if m.Workflow == "" ||
+		m.Stage != j.Stage ||
+		m.CurrentTask != j.CurrentIndex ||
+		!uuid.Equal(m.CurrentJob, j.Uuid) {
+		return
+	}
+	wo := j.rt.find("workflows", m.Workflow)
+	if wo == nil {
+		return
+	}
+	to := AsWorkflow(wo).nextStage(j.rt, m, m.Stage, "failure")
+	if to == "" {
+		return
+	}
+	nm := ModelToBackend(models.Clone(m.Machine)).(*Machine)
+	nm.InRunner()
+	nm.failedTo = to
+	nm.Runnable = true
+	if _, err := j.rt.Update(nm); err != nil {
+		j.rt.Errorf("Failed to send machine %s to Stage %s: %v", m.UUID(), to, err)
+		return
+	}
+	j.Log(j.rt, bytes.NewBufferString(fmt.Sprintf("\nWorkflow %s is sending the machine to Stage %s\n", m.Workflow, nm.Stage)))
+}
+
 func (j *Job) BeforeDelete() error {
 	e := &models.Error{Code: 422, Type: ValidationError, Model: j.Prefix(), Key: j.Key()}
 	if j.State == "finished" || j.State == "failed" {
@@ -583,6 +730,9 @@ func writePanicSafe(name string, writefn func(net.IP) (io.Reader, error), addr n
 
 func (j *Job) AfterDelete() {
 	os.Remove(j.LogPath(j.rt))
+	os.Remove(j.compressedLogPath(j.rt))
+	os.RemoveAll(j.ArtifactPath(j.rt))
+	j.wakeLogFollowers()
 }
 
 func (j *Job) Log(rt *RequestTracker, src io.Reader) error {
@@ -590,25 +740,33 @@ func (j *Job) Log(rt *RequestTracker, src io.Reader) error {
 		j.setRT(rt)
 		defer j.clearRT()
 	}
+	j.rt.dt.jobLogMux.Lock()
+	defer j.rt.dt.jobLogMux.Unlock()
+	if err := j.uncompressLog(j.rt); err != nil {
+		j.rt.Errorf("Job %s: error uncompressing log: %v", j.UUID(), err)
+		return err
+	}
 	f, err := os.OpenFile(j.LogPath(rt), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
 	if err != nil {
 		fmt.Printf("Umm err: %v\n", err)
 		return err
 	}
+	defer f.Close()
 	cnt, err := io.Copy(f, src)
 	if err != nil {
 		j.rt.Errorf("Job %s: error writing log: %v", j.UUID(), err)
 		return err
 	}
 	j.rt.Debugf("Job %s: %d bytes appended to log", j.UUID(), cnt)
+	j.rt.dt.wakeJobLogFollowers(j.Key())
 	return nil
 }
 
 var jobLockMap = map[string][]string{
 	"get":     {"jobs"},
 	"create":  {"stages", "bootenvs", "jobs:rw", "machines:rw", "tasks", "profiles", "workflows", "params"},
-	"update":  {"stages", "bootenvs", "jobs:rw", "machines", "tasks", "profiles", "workflows", "params"},
-	"patch":   {"stages", "bootenvs", "jobs:rw", "machines", "tasks", "profiles", "workflows", "params"},
+	"update":  {"stages", "bootenvs", "jobs:rw", "machines:rw", "tasks", "profiles", "workflows", "params"},
+	"patch":   {"stages", "bootenvs", "jobs:rw", "machines:rw", "tasks", "profiles", "workflows", "params"},
 	"delete":  {"machines", "jobs:rw"},
 	"actions": {"stages", "jobs", "machines", "tasks", "profiles", "bootenvs", "params", "workflows"},
 }
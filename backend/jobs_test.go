@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestGroupJobsNotCurrent(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles", "params", "jobs:rw", "workflows")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "grouped.fqdn"}
+	tests := []crudTest{
+		{"Create task t1", rt.Create, &models.Task{Name: "t1"}, true},
+		{"Create task t2", rt.Create, &models.Task{Name: "t2"}, true},
+		{"Create stage with a parallel group", rt.Create, &models.Stage{Name: "both", Tasks: []string{"parallel:t1,t2"}}, true},
+		{"Create machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	group := &models.Job{
+		Uuid:     uuid.NewRandom(),
+		Previous: uuid.NIL,
+		Machine:  machine.Uuid,
+		Stage:    "both",
+		Task:     "parallel:t1,t2",
+		State:    "running",
+	}
+	members := []*models.Job{}
+	for _, task := range []string{"t1", "t2"} {
+		members = append(members, &models.Job{
+			Uuid:     uuid.NewRandom(),
+			Previous: uuid.NIL,
+			Parent:   group.Uuid,
+			Machine:  machine.Uuid,
+			Stage:    "both",
+			Task:     task,
+			State:    "created",
+		})
+	}
+	find := func(j *models.Job) (res *Job) {
+		rt.Do(func(d Stores) { res = AsJob(rt.find("jobs", j.Key())) })
+		return
+	}
+	rt.Do(func(d Stores) {
+		for _, j := range append([]*models.Job{group}, members...) {
+			if created, err := rt.Create(j); !created {
+				t.Fatalf("Failed to create job for %s: %v", j.Task, err)
+			}
+		}
+	})
+	if !find(group).Current {
+		t.Errorf("Expected the group job to be current")
+	}
+	for _, j := range members {
+		if find(j).Current {
+			t.Errorf("Expected the job for %s in the group not to be current", j.Task)
+		}
+	}
+
+	// Members left current by older servers are cleared once the
+	// group job is saved.
+	rt.Do(func(d Stores) {
+		stale := AsJob(rt.find("jobs", members[0].Key()))
+		stale.Current = true
+		rt.Save(stale)
+		j := ModelToBackend(models.Clone(AsJob(rt.find("jobs", group.Key())).Job)).(*Job)
+		j.State = "finished"
+		if _, err := rt.Update(j); err != nil {
+			t.Errorf("Failed to finish the group job: %v", err)
+		}
+	})
+	if find(members[0]).Current {
+		t.Errorf("Expected finishing the group job to clear Current on its members")
+	}
+}
+
+func TestGroupJobsReaped(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "machines:rw", "tasks:rw", "profiles", "params", "jobs:rw", "workflows")
+	machine := &models.Machine{Uuid: uuid.NewRandom(), Name: "reaped.fqdn"}
+	tests := []crudTest{
+		{"Create task t1", rt.Create, &models.Task{Name: "t1"}, true},
+		{"Create task t2", rt.Create, &models.Task{Name: "t2"}, true},
+		{"Create stage with a parallel group", rt.Create, &models.Stage{Name: "both", Tasks: []string{"parallel:t1,t2"}}, true},
+		{"Create machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	group := &models.Job{
+		Uuid:     uuid.NewRandom(),
+		Previous: uuid.NIL,
+		Machine:  machine.Uuid,
+		Stage:    "both",
+		Task:     "parallel:t1,t2",
+		State:    "running",
+	}
+	members := []*models.Job{}
+	for i, task := range []string{"t1", "t2"} {
+		state := "finished"
+		if i == 1 {
+			state = "running"
+		}
+		members = append(members, &models.Job{
+			Uuid:     uuid.NewRandom(),
+			Previous: uuid.NIL,
+			Parent:   group.Uuid,
+			Machine:  machine.Uuid,
+			Stage:    "both",
+			Task:     task,
+			State:    state,
+		})
+	}
+	find := func(j *models.Job) (res *Job) {
+		rt.Do(func(d Stores) { res = AsJob(rt.find("jobs", j.Key())) })
+		return
+	}
+	rt.Do(func(d Stores) {
+		for _, j := range append([]*models.Job{group}, members...) {
+			if created, err := rt.Create(j); !created {
+				t.Fatalf("Failed to create job for %s: %v", j.Task, err)
+			}
+		}
+		if listed := AsJob(rt.find("jobs", group.Key())).Members(rt); len(listed) != len(members) {
+			t.Errorf("Expected %d members in the group, not %d", len(members), len(listed))
+		}
+		j := ModelToBackend(models.Clone(AsJob(rt.find("jobs", group.Key())).Job)).(*Job)
+		j.State = "failed"
+		j.ExitState = "timeout"
+		if _, err := rt.Update(j); err != nil {
+			t.Errorf("Failed to fail the group job: %v", err)
+		}
+	})
+	if state := find(members[0]).State; state != "finished" {
+		t.Errorf("Expected the finished member to be left alone, not %s", state)
+	}
+	if state := find(members[1]).State; state != "failed" {
+		t.Errorf("Expected the running member to be failed with its group, not %s", state)
+	}
+}
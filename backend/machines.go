@@ -9,11 +9,14 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/digitalrebar/provision/backend/index"
 	"github.com/digitalrebar/provision/models"
 	"github.com/digitalrebar/provision/store"
+	"github.com/digitalrebar/provision/utils"
 	"github.com/pborman/uuid"
 )
 
@@ -27,6 +30,14 @@ type Machine struct {
 	oldMachine                             *Machine
 	changeStageAllowed, inCreate, inRunner bool
 	toDeRegister, toRegister               renderers
+	// set when a failed Job sends the Machine to another Stage.
+	failedTo string
+	// set when a Schedule wants the Machine to run its Workflow
+	// again from the start.
+	restartWorkflow bool
+	// set when a heartbeat or the liveness monitor is updating the
+	// liveness of the Machine.
+	inHeartbeat bool
 }
 
 func (n *Machine) SetReadOnly(b bool) {
@@ -171,6 +182,27 @@ func (n *Machine) Indexes() map[string]index.Maker {
 			return m, nil
 		},
 	}
+	res["Liveness"] = index.Maker{
+		Unique: false,
+		Type:   "string",
+		Less:   func(i, j models.Model) bool { return fix(i).Liveness < fix(j).Liveness },
+		Eq:     func(i, j models.Model) bool { return fix(i).Liveness == fix(j).Liveness },
+		Match:  func(i models.Model, re *regexp.Regexp) bool { return re.MatchString(fix(i).Liveness) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			refLiveness := fix(ref).Liveness
+			return func(s models.Model) bool {
+					return fix(s).Liveness >= refLiveness
+				},
+				func(s models.Model) bool {
+					return fix(s).Liveness > refLiveness
+				}
+		},
+		Fill: func(s string) (models.Model, error) {
+			m := fix(n.New())
+			m.Liveness = s
+			return m, nil
+		},
+	}
 	res["Address"] = index.Maker{
 		Unique: false,
 		Type:   "IP Address",
@@ -409,6 +441,8 @@ func (n *Machine) OnCreate() error {
 		n.CurrentTask = -1
 	}
 	n.Runnable = true
+	// A new Machine has not heard from its agent yet.
+	n.LastSeen, n.Liveness, n.Heartbeat = time.Time{}, "", models.AgentHeartbeat{}
 	n.Validate()
 	// If create is forced, let it happen
 	if n.ChangeForced() && n.Useable() {
@@ -541,6 +575,12 @@ func (n *Machine) Validate() {
 					n.AddError(bootErr)
 					n.Errorf("BootEnv %s cannot boot Arch %s", env.Name, n.Arch)
 				}
+				if n.rt.SecureBoot(n) {
+					if sbErr := env.canSecureBoot(n.rt, n.Arch); sbErr != nil {
+						n.AddError(sbErr)
+						n.Errorf("BootEnv %s cannot Secure Boot Arch %s", env.Name, n.Arch)
+					}
+				}
 				n.Runnable = false
 			}
 			if obFound := bootenvs.Find(n.oldBootEnv); obFound != nil {
@@ -570,6 +610,12 @@ func (n *Machine) Validate() {
 				}
 			case "action":
 				continue
+			case "parallel":
+				for _, name := range models.ParallelTasks(ent) {
+					if tasks.Find(name) == nil {
+						n.Errorf("Task %s (at %d) does not exist", name, i)
+					}
+				}
 			case "chroot":
 			default:
 				n.Errorf("%s (at %d) is malformed", ent, i)
@@ -668,6 +714,11 @@ func (n *Machine) AfterSave() {
 			}
 		}
 	}
+	if n.oldStage != n.Stage && !n.inCreate {
+		if stage := n.rt.find("stages", n.Stage); stage != nil && AsStage(stage).Reboot {
+			n.bmcReboot()
+		}
+	}
 	n.toDeRegister = nil
 	n.toRegister = nil
 	n.oldStage = n.Stage
@@ -677,6 +728,8 @@ func (n *Machine) AfterSave() {
 	n.changeStageAllowed = false
 	n.inCreate = false
 	n.inRunner = false
+	n.failedTo = ""
+	n.restartWorkflow = false
 	n.rt.dt.macAddrMux.Lock()
 	for _, mac := range n.HardwareAddrs {
 		n.rt.dt.macAddrMap[mac] = n.UUID()
@@ -722,6 +775,30 @@ func (n *Machine) expandTaskPrerequisites(current []string, e *models.Error) (re
 	res = []string{}
 	cEnv := n.BootEnv
 	seenTasks := map[string]struct{}{}
+	addPrereqs := func(i int, action string) bool {
+		if n.CurrentTask <= i {
+			vv := n.rt.find("tasks", action)
+			if vv != nil {
+				task := AsTask(vv)
+				if !task.Available {
+					e.AddError(task)
+					return false
+				}
+				prereqs, sane := task.sanityCheck(n.rt, n, map[string]int{})
+				if !sane {
+					return false
+				}
+				for _, prereq := range prereqs {
+					if _, ok := seenTasks[prereq]; ok {
+						continue
+					}
+					seenTasks[prereq] = struct{}{}
+					res = append(res, prereq)
+				}
+			}
+		}
+		return true
+	}
 	for i, ent := range current {
 		prefix, action := "task", ""
 		parts := strings.SplitN(ent, ":", 2)
@@ -738,28 +815,22 @@ func (n *Machine) expandTaskPrerequisites(current []string, e *models.Error) (re
 			}
 			cEnv = action
 		case "task":
-			if n.CurrentTask <= i {
-				vv := n.rt.find("tasks", action)
-				if vv != nil {
-					task := AsTask(vv)
-					if !task.Available {
-						e.AddError(task)
-						return
-					}
-					prereqs, sane := task.sanityCheck(n.rt, n, map[string]int{})
-					if !sane {
-						return
-					}
-					for _, prereq := range prereqs {
-						if _, ok := seenTasks[prereq]; ok {
-							continue
-						}
-						seenTasks[prereq] = struct{}{}
-						res = append(res, prereq)
-					}
-				}
+			if !addPrereqs(i, action) {
+				return
 			}
 			seenTasks[action] = struct{}{}
+		case "parallel":
+			// Prerequisites of the Tasks in a group run before the
+			// whole group does.
+			members := models.ParallelTasks(ent)
+			for _, member := range members {
+				if !addPrereqs(i, member) {
+					return
+				}
+			}
+			for _, member := range members {
+				seenTasks[member] = struct{}{}
+			}
 		}
 		res = append(res, ent)
 	}
@@ -767,7 +838,10 @@ func (n *Machine) expandTaskPrerequisites(current []string, e *models.Error) (re
 }
 
 func (n *Machine) validateChangeWorkflow(oldm *Machine, e *models.Error) (newStage, newEnv string) {
-	if oldm.Workflow == n.Workflow {
+	if oldm.Workflow == n.Workflow && !n.restartWorkflow {
+		if n.inRunner {
+			n.followTransitions(oldm)
+		}
 		return
 	}
 	if n.Workflow == "" {
@@ -793,10 +867,17 @@ func (n *Machine) validateChangeWorkflow(oldm *Machine, e *models.Error) (newSta
 		return
 	}
 	n.CurrentTask = -1
+	newStage, newEnv = n.workflowTasks(workflow.Stages, e)
+	return
+}
+
+// workflowTasks fills in the Machine's task list from stages, and
+// returns the first Stage and BootEnv the Machine should be in.
+func (n *Machine) workflowTasks(stages []string, e *models.Error) (newStage, newEnv string) {
 	taskList := []string{}
 	lastEnv := ""
 	firstStage := true
-	for _, stageName := range workflow.Stages {
+	for _, stageName := range stages {
 		stage := n.rt.find("stages", stageName).(*Stage)
 		taskList = append(taskList, "stage:"+stageName)
 		if firstStage {
@@ -817,6 +898,74 @@ func (n *Machine) validateChangeWorkflow(oldm *Machine, e *models.Error) (newSta
 	return
 }
 
+// followTransitions checks the Transitions of the Machine's Workflow
+// when the runner moves it out of a Stage, and when a Job fails.  If
+// one of them sends the Machine somewhere other than the next Stage,
+// its task list is rebuilt starting at the new Stage.  If that Stage
+// is part of the Workflow, the rest of the Workflow follows it.
+func (n *Machine) followTransitions(oldm *Machine) {
+	if n.Workflow == "" {
+		return
+	}
+	obj := n.rt.find("workflows", n.Workflow)
+	if obj == nil {
+		return
+	}
+	workflow := AsWorkflow(obj)
+	from, to := oldm.Stage, ""
+	switch {
+	case n.failedTo != "":
+		to = n.failedTo
+	case oldm.Stage != n.Stage:
+		if to = workflow.nextStage(n.rt, n, from, "success"); to == n.Stage {
+			return
+		}
+	case n.CurrentTask >= len(n.Tasks) && oldm.CurrentTask < len(oldm.Tasks):
+		to = workflow.nextStage(n.rt, n, from, "success")
+	}
+	if to == "" {
+		return
+	}
+	stages := []string{to}
+	for i, stageName := range workflow.Stages {
+		if stageName == to {
+			stages = workflow.Stages[i:]
+			break
+		}
+	}
+	e := &models.Error{}
+	oldTasks, oldEnv := n.Tasks, n.BootEnv
+	newStage, _ := n.workflowTasks(stages, e)
+	if e.ContainsError() {
+		n.rt.Errorf("Machine %s cannot go from Stage %s to %s: %v", n.UUID(), from, to, e)
+		n.Tasks, n.BootEnv = oldTasks, oldEnv
+		return
+	}
+	n.rt.Infof("Machine %s Workflow %s is sending it from Stage %s to %s", n.UUID(), n.Workflow, from, newStage)
+	n.Stage = newStage
+	n.CurrentTask = -1
+	if cur, ok := n.Params["change-stage/map"]; ok {
+		// Only redirect the entry for the Stage being left, and keep
+		// its Reboot, Stop, or Shutdown specifier.
+		csMap := map[string]string{}
+		if err := utils.Remarshal(cur, &csMap); err != nil {
+			n.rt.Errorf("Machine %s has an invalid change-stage/map: %v", n.UUID(), err)
+			return
+		}
+		target := newStage
+		if pieces := strings.SplitN(csMap[from], ":", 2); len(pieces) == 2 {
+			target += ":" + pieces[1]
+		}
+		csMap[from] = target
+		params := make(map[string]interface{}, len(n.Params))
+		for k, v := range n.Params {
+			params[k] = v
+		}
+		params["change-stage/map"] = csMap
+		n.Params = params
+	}
+}
+
 func (n *Machine) validateChangeStage(oldm *Machine, e *models.Error) {
 	if oldm.Stage == n.Stage {
 		return
@@ -950,6 +1099,10 @@ func (n *Machine) OnChange(oldThing store.KeySaver) error {
 	n.oldStage = oldm.Stage
 	n.oldWorkflow = oldm.Workflow
 	n.oldMachine = oldm
+	if !n.inHeartbeat {
+		// Only the agent and the liveness monitor get to change these.
+		n.LastSeen, n.Liveness, n.Heartbeat = oldm.LastSeen, oldm.Liveness, oldm.Heartbeat
+	}
 	oldPast, oldPresent, oldFuture := oldm.SplitTasks()
 	newPast, newPresent, newFuture := n.SplitTasks()
 	e := &models.Error{
@@ -959,6 +1112,10 @@ func (n *Machine) OnChange(oldThing store.KeySaver) error {
 		Key:   n.Key(),
 	}
 	if n.inRunner {
+		n.validateChangeWorkflow(oldm, e)
+		if e.ContainsError() {
+			return e
+		}
 		return nil
 	}
 	if n.CurrentTask != oldm.CurrentTask && n.CurrentTask > -1 && len(n.Tasks) > 0 {
@@ -1034,6 +1191,7 @@ func (n *Machine) OnChange(oldThing store.KeySaver) error {
 }
 
 func (n *Machine) AfterDelete() {
+	n.rt.dt.forgetHeartbeat(n.Key())
 	e := &models.Error{}
 	if b := n.rt.stores("bootenvs").Find(n.BootEnv); b != nil {
 		AsBootEnv(b).render(n.rt, n, e).deregister(n.rt)
@@ -1046,6 +1204,10 @@ func (n *Machine) AfterDelete() {
 		job.Current = false
 		n.rt.Save(job)
 	}
+	if inv := n.rt.find("inventories", n.Key()); inv != nil {
+		n.rt.Remove(inv)
+	}
+	n.rt.dt.removeConsole(n.Key())
 	n.rt.dt.macAddrMux.Lock()
 	for _, mac := range n.HardwareAddrs {
 		if v, ok := n.rt.dt.macAddrMap[mac]; ok && v == n.UUID() {
@@ -1054,7 +1216,7 @@ func (n *Machine) AfterDelete() {
 	}
 	n.rt.DeleteKeyFor(n)
 	n.rt.dt.macAddrMux.Unlock()
-
+	n.rt.releaseCoordination(n.Uuid)
 }
 
 func AsMachine(o models.Model) *Machine {
@@ -1069,12 +1231,41 @@ func AsMachines(o []models.Model) []*Machine {
 	return res
 }
 
+// machineFilters turns a map of Machine index or param names to list
+// filters into index Filters for Machines.
+func machineFilters(rt *RequestTracker, filter map[string]string) ([]index.Filter, error) {
+	ref := &Machine{Machine: &models.Machine{}}
+	ref.rt = rt
+	indexes := ref.Indexes()
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	filters := []index.Filter{}
+	for _, k := range keys {
+		maker, ok := indexes[k]
+		if !ok {
+			var err error
+			if maker, err = ref.ParameterMaker(rt, k); err != nil {
+				return nil, err
+			}
+		}
+		f, err := index.ParseFilter(filter[k])
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, index.Use(maker), f)
+	}
+	return filters, nil
+}
+
 var machineLockMap = map[string][]string{
 	"get":     {"stages", "bootenvs", "machines", "profiles", "params", "workflows"},
 	"create":  {"stages", "bootenvs", "machines:rw", "tasks", "profiles", "templates", "params", "workflows"},
 	"update":  {"stages", "bootenvs", "machines:rw", "tasks", "profiles", "templates", "params", "workflows"},
 	"patch":   {"stages", "bootenvs", "machines:rw", "tasks", "profiles", "templates", "params", "workflows"},
-	"delete":  {"stages", "bootenvs", "machines:rw", "jobs:rw", "tasks", "profiles", "params"},
+	"delete":  {"stages", "bootenvs", "machines:rw", "jobs:rw", "tasks", "profiles", "params", "inventories:rw"},
 	"actions": {"stages", "bootenvs", "machines", "profiles", "params"},
 }
 
@@ -48,7 +48,7 @@ func (p *patchTest) test(t *testing.T, target models.Model) {
 
 func TestMachineCrud(t *testing.T) {
 	dt := mkDT()
-	rt := dt.Request(dt.Logger, "stages", "templates:rw", "machines:rw", "tasks", "bootenvs:rw", "profiles", "jobs", "workflows")
+	rt := dt.Request(dt.Logger, "stages", "templates:rw", "machines:rw", "tasks", "bootenvs:rw", "profiles", "jobs", "workflows", "inventories:rw")
 	okUUID := uuid.NewRandom()
 	tests := []crudTest{
 		{"Create known-good Template", rt.Create, &models.Template{ID: "default"}, true},
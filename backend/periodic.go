@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// periodic runs a function every interval in the background until it
+// is shut down.  The services that keep the DataTracker tidy embed it
+// for their Shutdown method.
+type periodic struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// start calls tick with the current time every interval, and calls
+// finish, if there is one, once Shutdown is called.
+func (p *periodic) start(interval time.Duration, tick func(time.Time), finish func()) {
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				tick(now)
+			case <-p.stop:
+				if finish != nil {
+					finish()
+				}
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the service, and waits for it to finish until ctx is
+// done.
+func (p *periodic) Shutdown(ctx context.Context) error {
+	close(p.stop)
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
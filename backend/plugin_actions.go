@@ -14,6 +14,9 @@ type availableAction struct {
 
 	plugin *RunningPlugin
 	ma     *actions
+	// run is set for the actions the server provides itself, which
+	// have no plugin client to send the action to.
+	run func(*RequestTracker, *models.Action) (interface{}, error)
 
 	lock      sync.Mutex
 	inflight  int
@@ -41,13 +44,32 @@ type actions struct {
 }
 
 func newActions() *actions {
-	return &actions{actions: make(objectsCommands, 0)}
+	res := &actions{actions: make(objectsCommands, 0)}
+	addBMCActions(res)
+	return res
 }
 
 func (ma *actions) add(model_aa models.AvailableAction, plugin *RunningPlugin) error {
 	aa := &availableAction{}
 	aa.AvailableAction = model_aa
 	aa.plugin = plugin
+	return ma.insert(aa)
+}
+
+// addBuiltin adds an action that the server runs itself.  The
+// provider stands in for the plugin name wherever actions are listed
+// or picked by plugin.
+func (ma *actions) addBuiltin(model_aa models.AvailableAction,
+	run func(*RequestTracker, *models.Action) (interface{}, error)) error {
+	aa := &availableAction{}
+	aa.AvailableAction = model_aa
+	aa.Fill()
+	aa.plugin = &RunningPlugin{Plugin: &models.Plugin{Name: model_aa.Provider}}
+	aa.run = run
+	return ma.insert(aa)
+}
+
+func (ma *actions) insert(aa *availableAction) error {
 	aa.ma = ma
 
 	ma.lock.Lock()
@@ -105,7 +127,7 @@ func (ma *actions) remove(aa models.AvailableAction, plugin *RunningPlugin) erro
 	} else {
 		newlist := make(AvailableActions, 0, 0)
 		for _, laa := range list {
-			if pn == laa.plugin.Plugin.Name {
+			if pn == laa.plugin.Plugin.Name && laa.run == nil {
 				the_aa = laa
 			} else {
 				newlist = append(newlist, laa)
@@ -203,7 +225,13 @@ func (ma *actions) run(rt *RequestTracker, maa *models.Action) (interface{}, err
 	defer aa.release()
 
 	rt.Debugf("Starting action: %s on %v\n", maa.Command, maa.Model)
-	v, e := aa.plugin.Client.Action(rt, maa)
+	var v interface{}
+	var e error
+	if aa.run != nil {
+		v, e = aa.run(rt, maa)
+	} else {
+		v, e = aa.plugin.Client.Action(rt, maa)
+	}
 	rt.Debugf("Finished action: %s on %v: %v, %v\n", maa.Command, maa.Model, v, e)
 	return v, e
 }
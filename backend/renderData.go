@@ -140,7 +140,11 @@ func newRenderedTemplate(r *RenderData,
 				"machines",
 				"profiles",
 				"params",
-				"preferences")
+				"preferences",
+				"workflows",
+				"subnets",
+				"leases",
+				"reservations")
 			rd := &RenderData{rt: rt}
 			rd.rt.Do(func(d Stores) {
 				for i, prefix := range prefixes {
@@ -177,10 +181,11 @@ func newRenderedTemplate(r *RenderData,
 			rd.remoteIP = remoteIP
 			rd.tmplKey = tmplKey
 			rd.tmplPath = path
+			rd.setLimits()
 			buf := bytes.Buffer{}
 			tmpl := rd.target.templates().Lookup(tmplKey)
 			rd.rt.Do(func(d Stores) {
-				err = tmpl.Execute(&buf, rd)
+				err = tmpl.Execute(rd.limit(&buf), rd)
 			})
 			if err != nil {
 				return nil, err
@@ -498,6 +503,48 @@ type RenderData struct {
 	target            renderable
 	tmplKey, tmplPath string
 	remoteIP          net.IP
+	deadline          time.Time
+	maxSize           int64
+	depth, maxDepth   int
+}
+
+// setLimits arms the render limits from the DataTracker.
+func (r *RenderData) setLimits() {
+	timeout, size, depth := r.rt.dt.renderLimits()
+	r.deadline = time.Now().Add(timeout)
+	r.maxSize = size
+	r.maxDepth = depth
+}
+
+func (r *RenderData) checkDeadline() error {
+	if !r.deadline.IsZero() && time.Now().After(r.deadline) {
+		return fmt.Errorf("Rendering %s ran out of time", r.tmplKey)
+	}
+	return nil
+}
+
+// limitWriter makes template execution fail once the render deadline
+// passes or too much output has been generated.  text/template cannot
+// be interrupted, so this is checked every time it writes output.
+type limitWriter struct {
+	io.Writer
+	r       *RenderData
+	written int64
+}
+
+func (l *limitWriter) Write(buf []byte) (int, error) {
+	if err := l.r.checkDeadline(); err != nil {
+		return 0, err
+	}
+	l.written += int64(len(buf))
+	if l.r.maxSize > 0 && l.written > l.r.maxSize {
+		return 0, fmt.Errorf("Rendering %s generated more than %d bytes", l.r.tmplKey, l.r.maxSize)
+	}
+	return l.Writer.Write(buf)
+}
+
+func (r *RenderData) limit(w io.Writer) io.Writer {
+	return &limitWriter{Writer: w, r: r}
 }
 
 func (r *RenderData) fetchRepos(test func(*Repo) bool) (res []*Repo) {
@@ -720,7 +767,8 @@ func (r *RenderData) GenerateToken() string {
 			ttl = time.Second * time.Duration(mttl)
 		}
 		t, _ = NewClaim(r.Machine.Key(), grantor, ttl).
-			AddRawClaim("machines", "get, actions, update, patch, action, getSecure, updateSecure", r.Machine.Key()).
+			AddRawClaim("machines", "get, actions, update, patch, action, getSecure, updateSecure, coordinate, heartbeat, inventory", r.Machine.Key()).
+			AddRawClaim("inventories", "get", r.Machine.Key()).
 			AddRawClaim("params", "get", "*").
 			AddRawClaim("stages", "get", "*").
 			AddRawClaim("jobs", "create", r.Machine.Key()).
@@ -760,7 +808,8 @@ func (r *RenderData) GenerateInfiniteToken() string {
 
 	ttl := time.Hour * 24 * 7 * 52 * 3
 	t, _ := NewClaim(r.Machine.Key(), grantor, ttl).
-		AddRawClaim("machines", "get, actions, update, patch, action, getSecure, updateSecure", r.Machine.Key()).
+		AddRawClaim("machines", "get, actions, update, patch, action, getSecure, updateSecure, coordinate, heartbeat, inventory", r.Machine.Key()).
+		AddRawClaim("inventories", "get", r.Machine.Key()).
 		AddRawClaim("params", "get", "*").
 		AddRawClaim("stages", "get", "*").
 		AddRawClaim("jobs", "create", r.Machine.Key()).
@@ -860,6 +909,9 @@ func (r *RenderData) ParseUrl(segment, rawUrl string) (string, error) {
 
 // Param is a helper function for extracting a parameter from Machine.Params
 func (r *RenderData) Param(key string) (interface{}, error) {
+	if err := r.checkDeadline(); err != nil {
+		return nil, err
+	}
 	if r.Machine != nil {
 		v, ok := r.rt.GetParam(r.Machine, key, true, r.Task != nil)
 		if ok {
@@ -891,7 +943,7 @@ func (r *RenderData) ParamExpand(key string) (interface{}, error) {
 		return nil, fmt.Errorf("Error compiling parameter %s: %v", key, err)
 	}
 	tmpl = tmpl.Option("missingkey=error")
-	if err := tmpl.Execute(res, r); err != nil {
+	if err := tmpl.Execute(r.limit(res), r); err != nil {
 		return nil, fmt.Errorf("Error rendering parameter %s: %v", key, err)
 	}
 	return res.String(), nil
@@ -935,11 +987,19 @@ func (r *RenderData) ParamExists(key string) bool {
 // template function.
 func (r *RenderData) CallTemplate(name string, data interface{}) (ret interface{}, err error) {
 	buf := bytes.NewBuffer([]byte{})
+	if r.target == nil {
+		return nil, fmt.Errorf("Missing template: %s", name)
+	}
 	tmpl := r.target.templates().Lookup(name)
 	if tmpl == nil {
 		return nil, fmt.Errorf("Missing template: %s", name)
 	}
-	err = tmpl.Execute(buf, data)
+	if r.maxDepth > 0 && r.depth >= r.maxDepth {
+		return nil, fmt.Errorf("CallTemplate %s nested more than %d deep", name, r.maxDepth)
+	}
+	r.depth++
+	defer func() { r.depth-- }()
+	err = tmpl.Execute(r.limit(buf), data)
 	if err == nil {
 		ret = buf.String()
 	}
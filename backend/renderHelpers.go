@@ -0,0 +1,269 @@
+package backend
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// lookupClaims are the claims that templates rendered for a machine
+// have when looking up other objects.  They grant read-only access
+// to the objects a machine needs to know about to configure itself,
+// and to nothing that holds secrets or credentials.
+func (r *RenderData) lookupClaims() *DrpCustomClaims {
+	return NewClaim(r.Machine.Key(), "system", time.Minute).
+		AddRawClaim("machines", "get, list", "*").
+		AddRawClaim("profiles", "get, list", "*").
+		AddRawClaim("params", "get, list", "*").
+		AddRawClaim("stages", "get, list", "*").
+		AddRawClaim("bootenvs", "get, list", "*").
+		AddRawClaim("tasks", "get, list", "*").
+		AddRawClaim("workflows", "get, list", "*").
+		AddRawClaim("subnets", "get, list", "*").
+		AddRawClaim("leases", "get, list", "*").
+		AddRawClaim("reservations", "get, list", "*")
+}
+
+func (r *RenderData) lookupStore(prefix, action, key string) (*Store, error) {
+	if err := r.checkDeadline(); err != nil {
+		return nil, err
+	}
+	if r.Machine == nil {
+		return nil, fmt.Errorf("Object lookups require a machine")
+	}
+	if !r.lookupClaims().match(r.rt, models.MakeRole("", prefix, action, key)) {
+		return nil, fmt.Errorf("Templates may not %s %s", action, prefix)
+	}
+	s := r.rt.stores(prefix)
+	if s == nil {
+		return nil, fmt.Errorf("%s are not available while rendering %s", prefix, r.tmplKey)
+	}
+	return s, nil
+}
+
+// lookupCopy returns a copy of obj that is safe to hand to a
+// template.
+func lookupCopy(obj models.Model) models.Model {
+	res := models.Clone(obj)
+	if m, ok := res.(*models.Machine); ok {
+		m.Secret = ""
+	}
+	return res
+}
+
+// Object returns a read-only copy of the object of type prefix with
+// the passed key, or an error if it does not exist or may not be
+// accessed from a template.  Objects with secure params only return
+// the encrypted values.
+func (r *RenderData) Object(prefix, key string) (models.Model, error) {
+	if _, err := r.lookupStore(prefix, "get", key); err != nil {
+		return nil, err
+	}
+	obj := r.rt.find(prefix, key)
+	if obj == nil {
+		return nil, fmt.Errorf("No such %s %s", prefix, key)
+	}
+	return lookupCopy(obj), nil
+}
+
+// Objects returns read-only copies of all the objects of type prefix
+// that have field set to value.  If field refers to a list, objects
+// whose list contains value are returned.  Passing an empty field
+// returns all the objects of that type.  For example, all the machines
+// with the rack-7 profile can be found with
+//
+//	{{ .Objects "machines" "Profiles" "rack-7" }}
+func (r *RenderData) Objects(prefix, field, value string) ([]models.Model, error) {
+	s, err := r.lookupStore(prefix, "list", "")
+	if err != nil {
+		return nil, err
+	}
+	res := []models.Model{}
+	for _, item := range s.Items() {
+		if field != "" {
+			fields := map[string]interface{}{}
+			if err := models.Remarshal(item, &fields); err != nil {
+				return nil, err
+			}
+			matched := false
+			switch v := fields[field].(type) {
+			case []interface{}:
+				for i := range v {
+					if fmt.Sprintf("%v", v[i]) == value {
+						matched = true
+						break
+					}
+				}
+			case nil:
+			default:
+				matched = fmt.Sprintf("%v", v) == value
+			}
+			if !matched {
+				continue
+			}
+		}
+		res = append(res, lookupCopy(item))
+	}
+	return res, nil
+}
+
+func (r *RenderData) machineAddress() (net.IP, error) {
+	if r.Machine == nil {
+		return nil, fmt.Errorf("Missing machine")
+	}
+	if r.Machine.Address == nil || r.Machine.Address.IsUnspecified() {
+		return nil, fmt.Errorf("Machine %s has no address", r.Machine.Key())
+	}
+	return r.Machine.Address, nil
+}
+
+// MachineSubnet returns the Subnet that contains the machine's
+// address.
+func (r *RenderData) MachineSubnet() (*models.Subnet, error) {
+	addr, err := r.machineAddress()
+	if err != nil {
+		return nil, err
+	}
+	s, err := r.lookupStore("subnets", "list", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range s.Items() {
+		subnet := AsSubnet(item)
+		if _, network, err := net.ParseCIDR(subnet.Subnet.Subnet); err == nil && network.Contains(addr) {
+			return models.Clone(subnet.Subnet).(*models.Subnet), nil
+		}
+	}
+	return nil, fmt.Errorf("No subnet contains %s", addr)
+}
+
+// MachineLease returns the Lease for the machine's address.
+func (r *RenderData) MachineLease() (*models.Lease, error) {
+	addr, err := r.machineAddress()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := r.Object("leases", models.Hexaddr(addr))
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*models.Lease), nil
+}
+
+// MachineReservation returns the Reservation for the machine's
+// address.
+func (r *RenderData) MachineReservation() (*models.Reservation, error) {
+	addr, err := r.machineAddress()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := r.Object("reservations", models.Hexaddr(addr))
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*models.Reservation), nil
+}
+
+// SubnetGateway returns the default gateway (DHCP option 3) of the
+// subnet that contains the machine's address.
+func (r *RenderData) SubnetGateway() (string, error) {
+	subnet, err := r.MachineSubnet()
+	if err != nil {
+		return "", err
+	}
+	for _, opt := range subnet.Options {
+		if opt.Code != 3 {
+			continue
+		}
+		if gw := net.ParseIP(opt.Value); gw != nil {
+			return gw.String(), nil
+		}
+		return "", fmt.Errorf("Subnet %s gateway %s is not an IP address", subnet.Name, opt.Value)
+	}
+	return "", fmt.Errorf("Subnet %s has no gateway", subnet.Name)
+}
+
+// SubnetCIDR returns the CIDR of the subnet that contains the
+// machine's address.
+func (r *RenderData) SubnetCIDR() (string, error) {
+	subnet, err := r.MachineSubnet()
+	if err != nil {
+		return "", err
+	}
+	return subnet.Subnet, nil
+}
+
+func ipToInt(ip net.IP) (*big.Int, int) {
+	if v4 := ip.To4(); v4 != nil {
+		return big.NewInt(0).SetBytes(v4), net.IPv4len
+	}
+	return big.NewInt(0).SetBytes(ip.To16()), net.IPv6len
+}
+
+func intToIP(i *big.Int, size int) net.IP {
+	buf := i.Bytes()
+	res := make(net.IP, size)
+	copy(res[size-len(buf):], buf)
+	return res
+}
+
+// CidrHost returns the nth address in cidr.  Negative values of n
+// count back from the end of the network, so -1 is the broadcast
+// address of an IPv4 network and -2 is the last usable address.
+func (r *RenderData) CidrHost(cidr string, n int) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := network.Mask.Size()
+	size := big.NewInt(0).Lsh(big.NewInt(1), uint(bits-ones))
+	offset := big.NewInt(int64(n))
+	if n < 0 {
+		offset.Add(size, offset)
+	}
+	if offset.Sign() < 0 || offset.Cmp(size) >= 0 {
+		return "", fmt.Errorf("%s does not have a host number %d", cidr, n)
+	}
+	base, l := ipToInt(network.IP)
+	return intToIP(base.Add(base, offset), l).String(), nil
+}
+
+// CidrNetmask returns the netmask of cidr in dotted-quad form for
+// IPv4 networks and as a prefix length for IPv6 networks.
+func (r *RenderData) CidrNetmask(cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	if len(network.Mask) == net.IPv4len {
+		return net.IP(network.Mask).String(), nil
+	}
+	ones, _ := network.Mask.Size()
+	return fmt.Sprintf("%d", ones), nil
+}
+
+// CidrPrefixLen returns the prefix length of cidr.
+func (r *RenderData) CidrPrefixLen(cidr string) (int, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 0, err
+	}
+	ones, _ := network.Mask.Size()
+	return ones, nil
+}
+
+// CidrContains returns true if addr is in cidr.
+func (r *RenderData) CidrContains(cidr, addr string) (bool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false, fmt.Errorf("%s is not an IP address", addr)
+	}
+	return network.Contains(ip), nil
+}
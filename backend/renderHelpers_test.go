@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRenderHelpers(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger,
+		"stages:rw",
+		"bootenvs:rw",
+		"templates:rw",
+		"machines:rw",
+		"profiles:rw",
+		"params:rw",
+		"tasks:rw",
+		"subnets:rw",
+		"leases",
+		"reservations",
+		"preferences",
+		"workflows")
+	task := func(name, contents string) *models.Task {
+		return &models.Task{Name: name, Templates: []models.TemplateInfo{{Name: name, Contents: contents}}}
+	}
+	objs := []crudTest{
+		{"Create bootenv", rt.Create, &models.BootEnv{Name: "plain"}, true},
+		{"Create subnet", rt.Create, &models.Subnet{
+			Name:              "test",
+			Subnet:            "192.168.124.0/24",
+			ActiveStart:       net.ParseIP("192.168.124.80"),
+			ActiveEnd:         net.ParseIP("192.168.124.254"),
+			ActiveLeaseTime:   60,
+			ReservedLeaseTime: 7200,
+			Strategy:          "mac",
+			Options:           []models.DhcpOption{{Code: 3, Value: "192.168.124.1"}},
+		}, true},
+		{"Create net task", rt.Create, task("net", `{{.SubnetCIDR}} {{.SubnetGateway}} {{.CidrHost .SubnetCIDR -2}} {{.CidrNetmask "10.0.0.0/8"}} {{.CidrPrefixLen "fd00::/64"}} {{.CidrContains .SubnetCIDR "10.1.1.1"}}`), true},
+		{"Create lookup task", rt.Create, task("lookup", `{{range .Objects "machines" "Name" "helper"}}{{.Name}} [{{.Secret}}]{{end}} {{(.Object "subnets" "test").Subnet}}`), true},
+		{"Create denied task", rt.Create, task("denied", `{{.Object "users" "rocketskates"}}`), true},
+		{"Create recursive task", rt.Create, task("recurse", `{{.CallTemplate "recurse" .}}`), true},
+		{"Create big task", rt.Create, task("big", `{{range .Objects "machines" "" ""}}{{.Name}}{{.Name}}{{.Name}}{{end}}`), true},
+	}
+	for _, obj := range objs {
+		obj.Test(t, rt)
+	}
+	machine := &Machine{}
+	Fill(machine)
+	machine.Uuid = uuid.NewRandom()
+	machine.Name = "helper"
+	machine.Secret = "sekrit"
+	machine.Address = net.ParseIP("192.168.124.11")
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(machine); !created {
+			t.Errorf("Failed to create test machine: %v", err)
+		}
+	})
+	render := func(name string) *models.RenderResult {
+		res, err := RenderPreview(rt, machine.UUID(), "plain", "", name)
+		if err != nil {
+			t.Fatalf("Unexpected error rendering %s: %v", name, err)
+		}
+		return res[len(res)-1]
+	}
+	for _, c := range []struct{ task, content string }{
+		{"net", "192.168.124.0/24 192.168.124.1 192.168.124.254 255.0.0.0 64 false"},
+		{"lookup", "helper [] 192.168.124.0/24"},
+	} {
+		res := render(c.task)
+		if len(res.Errors) > 0 || len(res.Files) != 1 {
+			t.Errorf("Unexpected errors rendering %s: %v", c.task, res.Errors)
+		} else if res.Files[0].Content != c.content {
+			t.Errorf("Expected %s to render %q, not %q", c.task, c.content, res.Files[0].Content)
+		}
+	}
+	for _, c := range []struct {
+		task, err string
+		setup     func()
+	}{
+		{"denied", "Templates may not get users", func() {}},
+		{"recurse", "nested more than 32 deep", func() {}},
+		{"big", "generated more than 10 bytes", func() { dt.RenderMaxSize = 10 }},
+		{"net", "ran out of time", func() { dt.RenderTimeout = time.Nanosecond }},
+	} {
+		c.setup()
+		res := render(c.task)
+		if len(res.Files) != 0 || len(res.Errors) != 1 || !strings.Contains(res.Errors[0], c.err) {
+			t.Errorf("Expected %s to fail with %s, got %v", c.task, c.err, res.Errors)
+		}
+	}
+}
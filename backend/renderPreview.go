@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// RenderPreview renders the templates for a hypothetical combination
+// of a Machine with a BootEnv, Stage, and Task without saving the
+// Machine or registering anything in the dynamic file tree.  If
+// bootEnv or stage are empty, the Machine's current ones are used.
+// The task is only rendered if one is passed in.  Missing params and
+// template errors are returned as part of each RenderResult. The
+// returned error is only set when one of the objects could not be
+// found.
+//
+// rt must have read access to machines, bootenvs, stages, tasks,
+// templates, profiles, params, and preferences.
+func RenderPreview(rt *RequestTracker, machine, bootEnv, stage, task string) ([]*models.RenderResult, error) {
+	type preview struct {
+		res  *models.RenderResult
+		rnds renderers
+	}
+	var (
+		m        *Machine
+		previews []preview
+	)
+	err := &models.Error{
+		Code:  http.StatusNotFound,
+		Type:  ValidationError,
+		Model: "machines",
+		Key:   machine,
+	}
+	rt.Do(func(d Stores) {
+		mo := rt.find("machines", machine)
+		if mo == nil {
+			err.Errorf("Machine %s does not exist", machine)
+			return
+		}
+		m = AsMachine(mo)
+		if bootEnv == "" {
+			bootEnv = m.BootEnv
+		}
+		if stage == "" {
+			stage = m.Stage
+		}
+		var (
+			env *BootEnv
+			stg *Stage
+			tsk *Task
+		)
+		if obj := rt.find("bootenvs", bootEnv); obj == nil {
+			err.Errorf("BootEnv %s does not exist", bootEnv)
+		} else {
+			env = AsBootEnv(obj)
+		}
+		if stage != "" {
+			if obj := rt.find("stages", stage); obj == nil {
+				err.Errorf("Stage %s does not exist", stage)
+			} else {
+				stg = AsStage(obj)
+			}
+		}
+		if task != "" {
+			if obj := rt.find("tasks", task); obj == nil {
+				err.Errorf("Task %s does not exist", task)
+			} else {
+				tsk = AsTask(obj)
+			}
+		}
+		if err.ContainsError() {
+			return
+		}
+		targets := []renderable{env}
+		if stg != nil {
+			targets = append(targets, stg)
+		}
+		if tsk != nil {
+			targets = append(targets, tsk)
+		}
+		for _, target := range targets {
+			rd := newRenderData(rt, m, target)
+			rd.Env = &rBootEnv{BootEnv: env, renderData: rd}
+			if stg != nil {
+				rd.Stage = &rStage{Stage: stg, renderData: rd}
+			}
+			e := &models.Error{}
+			p := preview{res: &models.RenderResult{
+				Prefix: target.Prefix(),
+				Name:   target.Key(),
+				Files:  models.JobActions{},
+			}}
+			switch target.Prefix() {
+			case "bootenvs":
+				p.rnds = env.renderWith(rd, e)
+			default:
+				p.rnds = rd.makeRenderers(e)
+			}
+			p.res.Errors = append([]string{}, e.Messages...)
+			previews = append(previews, p)
+		}
+	})
+	if err.ContainsError() {
+		return nil, err
+	}
+	res := make([]*models.RenderResult, len(previews))
+	for i, p := range previews {
+		res[i] = p.res
+		for _, r := range p.rnds {
+			rr, err := writePanicSafe(r.name, r.write, m.Address)
+			if err != nil {
+				p.res.Errors = append(p.res.Errors, err.Error())
+				continue
+			}
+			buf, err := ioutil.ReadAll(rr)
+			if err != nil {
+				p.res.Errors = append(p.res.Errors, fmt.Sprintf("Failed to read %s: %v", r.name, err))
+				continue
+			}
+			p.res.Files = append(p.res.Files, &models.JobAction{
+				Name:    r.name,
+				Path:    r.path,
+				Meta:    r.meta,
+				Content: string(buf),
+			})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"net"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRenderPreview(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger,
+		"stages:rw",
+		"bootenvs:rw",
+		"templates:rw",
+		"machines:rw",
+		"profiles:rw",
+		"params:rw",
+		"tasks:rw",
+		"preferences",
+		"workflows")
+	objs := []crudTest{
+		{"Create env template", rt.Create, &models.Template{ID: "env", Contents: "env {{.Env.Name}} stage {{.Stage.Name}}"}, true},
+		{"Create current bootenv", rt.Create, &models.BootEnv{Name: "current", Templates: []models.TemplateInfo{{Name: "ipxe", Path: "machines/{{.Machine.UUID}}/file", ID: "env"}}}, true},
+		{"Create other bootenv", rt.Create, &models.BootEnv{Name: "other", Templates: []models.TemplateInfo{{Name: "ipxe", Path: "machines/{{.Machine.UUID}}/file", ID: "env"}}}, true},
+		{"Create stage", rt.Create, &models.Stage{Name: "needy", RequiredParams: []string{"needed"}, Templates: []models.TemplateInfo{{Name: "needy", Path: "machines/{{.Machine.UUID}}/needy", Contents: "{{.Param \"needed\"}}"}}}, true},
+		{"Create task", rt.Create, &models.Task{Name: "task", Templates: []models.TemplateInfo{{Name: "script", Contents: "echo {{.Machine.Name}} {{.Env.Name}}"}}}, true},
+	}
+	for _, obj := range objs {
+		obj.Test(t, rt)
+	}
+	machine := &Machine{}
+	Fill(machine)
+	machine.Uuid = uuid.NewRandom()
+	machine.Name = "preview"
+	machine.Address = net.ParseIP("192.168.124.11")
+	machine.BootEnv = "current"
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(machine); !created {
+			t.Errorf("Failed to create test machine: %v", err)
+		}
+	})
+	res, err := RenderPreview(rt, machine.UUID(), "other", "needy", "task")
+	if err != nil {
+		t.Fatalf("Unexpected error rendering preview: %v", err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("Expected 3 results, not %d", len(res))
+	}
+	if res[0].Prefix != "bootenvs" || res[0].Name != "other" || len(res[0].Files) != 1 {
+		t.Errorf("Unexpected bootenv result: %#v", res[0])
+	} else if res[0].Files[0].Content != "env other stage needy" {
+		t.Errorf("Unexpected bootenv content: %s", res[0].Files[0].Content)
+	}
+	if res[1].Prefix != "stages" || len(res[1].Errors) == 0 {
+		t.Errorf("Expected missing param errors for stage, got %#v", res[1])
+	}
+	if res[2].Prefix != "tasks" || len(res[2].Files) != 1 {
+		t.Errorf("Unexpected task result: %#v", res[2])
+	} else if res[2].Files[0].Content != "echo preview other" {
+		t.Errorf("Unexpected task content: %s", res[2].Files[0].Content)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.find("machines", machine.UUID()))
+		if m.BootEnv != "current" {
+			t.Errorf("Preview changed machine bootenv to %s", m.BootEnv)
+		}
+	})
+	if _, err := RenderPreview(rt, machine.UUID(), "missing", "", ""); err == nil {
+		t.Errorf("Expected an error rendering a missing bootenv")
+	}
+	if _, err := RenderPreview(rt, uuid.NewRandom().String(), "", "", ""); err == nil {
+		t.Errorf("Expected an error rendering a missing machine")
+	}
+}
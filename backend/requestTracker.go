@@ -809,6 +809,25 @@ func (rt *RequestTracker) MachineForMac(mac string) *Machine {
 	return nil
 }
 
+// MachineForAddress looks up a Machine by an IP address it is using.
+// Machines are found by their Address first, and then by a Lease for
+// the address that was handed out by MAC address.  It needs the
+// machines and leases locks.
+func (rt *RequestTracker) MachineForAddress(addr net.IP) *Machine {
+	if addr == nil {
+		return nil
+	}
+	if m := rt.FindByIndex("machines", (&Machine{}).Indexes()["Address"], addr.String()); m != nil {
+		return AsMachine(m)
+	}
+	if l := rt.Find("leases", models.Hexaddr(addr)); l != nil {
+		if lease := AsLease(l); lease.Strategy == "MAC" {
+			return rt.MachineForMac(lease.Token)
+		}
+	}
+	return nil
+}
+
 // Prefs returns the current Prefs in the data tracker.
 func (rt *RequestTracker) Prefs() map[string]string {
 	return rt.dt.Prefs()
@@ -0,0 +1,257 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/store"
+)
+
+// Rollout is the backend model wrapper for Rollout.
+type Rollout struct {
+	*models.Rollout
+	validate
+	// set when the rollout runner is the one saving the Rollout, so
+	// that its read only fields are allowed to change.
+	fromRunner bool
+}
+
+// SetReadOnly is a helper function to set the ReadOnly flag.
+func (r *Rollout) SetReadOnly(b bool) {
+	r.ReadOnly = b
+}
+
+// SaveClean clears validation fields and returns a KeySaver
+// object for use by the backing store.
+func (r *Rollout) SaveClean() store.KeySaver {
+	mod := *r.Rollout
+	mod.ClearValidation()
+	return toBackend(&mod, r.rt)
+}
+
+// AsRollout converts a models.Model into a *Rollout.
+func AsRollout(o models.Model) *Rollout {
+	return o.(*Rollout)
+}
+
+// AsRollouts converts a list of models.Model into a list of *Rollout.
+func AsRollouts(o []models.Model) []*Rollout {
+	res := make([]*Rollout, len(o))
+	for i := range o {
+		res[i] = AsRollout(o[i])
+	}
+	return res
+}
+
+// New returns a new empty Rollout with the RT field from the caller.
+func (r *Rollout) New() store.KeySaver {
+	res := &Rollout{Rollout: &models.Rollout{}}
+	if r.Rollout != nil && r.ChangeForced() {
+		res.ForceChange()
+	}
+	res.rt = r.rt
+	res.Fill()
+	return res
+}
+
+// Indexes returns the valid Indexes on Rollout.
+func (r *Rollout) Indexes() map[string]index.Maker {
+	fix := AsRollout
+	res := index.MakeBaseIndexes(r)
+	res["Name"] = index.Maker{
+		Unique: true,
+		Type:   "string",
+		Less:   func(i, j models.Model) bool { return fix(i).Name < fix(j).Name },
+		Eq:     func(i, j models.Model) bool { return fix(i).Name == fix(j).Name },
+		Match:  func(i models.Model, re *regexp.Regexp) bool { return re.MatchString(fix(i).Name) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			name := fix(ref).Name
+			return func(rr models.Model) bool {
+					return fix(rr).Name >= name
+				},
+				func(rr models.Model) bool {
+					return fix(rr).Name > name
+				}
+		},
+		Fill: func(rr string) (models.Model, error) {
+			res := fix(r.New())
+			res.Name = rr
+			return res, nil
+		},
+	}
+	res["State"] = index.Maker{
+		Unique: false,
+		Type:   "string",
+		Less:   func(i, j models.Model) bool { return fix(i).State < fix(j).State },
+		Eq:     func(i, j models.Model) bool { return fix(i).State == fix(j).State },
+		Match:  func(i models.Model, re *regexp.Regexp) bool { return re.MatchString(fix(i).State) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			state := fix(ref).State
+			return func(rr models.Model) bool {
+					return fix(rr).State >= state
+				},
+				func(rr models.Model) bool {
+					return fix(rr).State > state
+				}
+		},
+		Fill: func(rr string) (models.Model, error) {
+			res := fix(r.New())
+			res.State = rr
+			return res, nil
+		},
+	}
+	res["Paused"] = index.MakeUnordered(
+		"boolean",
+		func(i, j models.Model) bool {
+			return fix(i).Paused == fix(j).Paused
+		},
+		func(rr string) (models.Model, error) {
+			res := fix(r.New())
+			switch rr {
+			case "true":
+				res.Paused = true
+			case "false":
+				res.Paused = false
+			default:
+				return nil, errors.New("Paused must be true or false")
+			}
+			return res, nil
+		})
+	return res
+}
+
+var rolloutLockMap = map[string][]string{
+	"get":     {"rollouts"},
+	"create":  {"rollouts:rw", "machines", "stages", "workflows", "profiles", "params"},
+	"update":  {"rollouts:rw", "machines", "stages", "workflows", "profiles", "params"},
+	"patch":   {"rollouts:rw", "machines", "stages", "workflows", "profiles", "params"},
+	"delete":  {"rollouts:rw"},
+	"actions": {"rollouts", "profiles", "params"},
+}
+
+// Locks returns a list of prefixes to lock for the specified action.
+func (r *Rollout) Locks(action string) []string {
+	return rolloutLockMap[action]
+}
+
+// Validate makes sure the Rollout is valid, and that everything it
+// puts on the Machines exists for it to be available.
+func (r *Rollout) Validate() {
+	r.Rollout.Validate()
+	r.AddError(index.CheckUnique(r, r.rt.stores("rollouts").Items()))
+	if _, err := machineFilters(r.rt, r.Filter); err != nil {
+		r.AddError(err)
+	}
+	if !r.SetValid() {
+		return
+	}
+	if r.Workflow != "" {
+		if wf := r.rt.find("workflows", r.Workflow); wf == nil {
+			r.Errorf("Workflow %s does not exist", r.Workflow)
+		} else if !AsWorkflow(wf).Available {
+			r.Errorf("Workflow %s is not available", r.Workflow)
+		}
+	}
+	for _, stage := range []string{r.Stage, r.TargetStage} {
+		if stage != "" && r.rt.find("stages", stage) == nil {
+			r.Errorf("Stage %s does not exist", stage)
+		}
+	}
+	for _, p := range r.AddProfiles {
+		if r.rt.find("profiles", p) == nil {
+			r.Errorf("Profile %s does not exist", p)
+		}
+	}
+	r.SetAvailable()
+}
+
+// BeforeSave returns an error if the Rollout is not valid.
+func (r *Rollout) BeforeSave() error {
+	r.Fill()
+	r.Validate()
+	if !r.Validated {
+		return r.MakeError(422, ValidationError, r)
+	}
+	return nil
+}
+
+// OnCreate picks the Machines the Rollout will change, in order of
+// their names.
+func (r *Rollout) OnCreate() error {
+	if r.fromRunner {
+		return nil
+	}
+	r.Fill()
+	r.State, r.Message, r.Wave = "running", "", 0
+	r.Machines = []models.RolloutMachine{}
+	filters, err := machineFilters(r.rt, r.Filter)
+	if err != nil {
+		// Validate will complain about this.
+		return nil
+	}
+	idx, err := index.All(filters...)(&r.rt.d("machines").Index)
+	if err != nil {
+		r.AddError(err)
+		return r.MakeError(http.StatusUnprocessableEntity, ValidationError, r)
+	}
+	machines := AsMachines(idx.Items())
+	sort.SliceStable(machines, func(i, j int) bool { return machines[i].Name < machines[j].Name })
+	for _, m := range machines {
+		r.Machines = append(r.Machines, models.RolloutMachine{
+			Machine: m.Uuid,
+			Name:    m.Name,
+			State:   "pending",
+		})
+	}
+	return nil
+}
+
+// OnChange keeps the read only fields of the Rollout from being
+// changed by anything but the rollout runner.  The change the
+// Rollout makes cannot be changed once it has been created.
+func (r *Rollout) OnChange(oldThing store.KeySaver) error {
+	if r.fromRunner {
+		return nil
+	}
+	old := AsRollout(oldThing)
+	r.State, r.Message = old.State, old.Message
+	r.Wave, r.WaveStarted = old.Wave, old.WaveStarted
+	r.Machines = old.Machines
+	e := &models.Error{
+		Code:  http.StatusUnprocessableEntity,
+		Type:  ValidationError,
+		Model: r.Prefix(),
+		Key:   r.Key(),
+	}
+	if !reflect.DeepEqual(r.Filter, old.Filter) {
+		e.Errorf("Cannot change the Filter of a Rollout")
+	}
+	if r.Workflow != old.Workflow ||
+		r.Stage != old.Stage ||
+		!reflect.DeepEqual(r.Params, old.Params) ||
+		!reflect.DeepEqual(r.AddProfiles, old.AddProfiles) ||
+		!reflect.DeepEqual(r.RemoveProfiles, old.RemoveProfiles) {
+		e.Errorf("Cannot change what a Rollout does to its Machines")
+	}
+	if e.ContainsError() {
+		return e
+	}
+	return nil
+}
+
+// AfterSave resets the transient fields of the Rollout.
+func (r *Rollout) AfterSave() {
+	r.fromRunner = false
+}
+
+// OnLoad initializes the Rollout when loaded from the data store.
+func (r *Rollout) OnLoad() error {
+	defer func() { r.rt = nil }()
+	r.Fill()
+	return r.BeforeSave()
+}
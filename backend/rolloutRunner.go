@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// check returns the state of a running Machine in the Rollout, and
+// why it failed if it did.  A Machine fails if it goes away or if a
+// Job that it started after the change was applied fails and will not
+// be retried.
+func (r *Rollout) check(rt *RequestTracker, rm *models.RolloutMachine) (string, string) {
+	mo := rt.find("machines", rm.Machine.String())
+	if mo == nil {
+		return "failed", "Machine was deleted"
+	}
+	m := AsMachine(mo)
+	if m.CurrentJob != nil && !uuid.Equal(m.CurrentJob, rm.Job) {
+		if jo := rt.find("jobs", m.CurrentJob.String()); jo != nil {
+			job := AsJob(jo)
+			retry := false
+			if to := rt.find("tasks", job.Task); to != nil {
+				retry = AsTask(to).ShouldRetry(job.Job)
+			}
+			if job.State == "failed" && !retry {
+				return "failed", fmt.Sprintf("Job %s for task %s failed", job.Key(), job.Task)
+			}
+		}
+	}
+	if r.TargetStage != "" {
+		if m.Stage == r.TargetStage {
+			return "succeeded", ""
+		}
+	} else if machineIdle(m) {
+		return "succeeded", ""
+	}
+	return "running", ""
+}
+
+// apply makes the change of the Rollout to one of its Machines.
+func (r *Rollout) apply(rt *RequestTracker, rm *models.RolloutMachine) error {
+	mo := rt.find("machines", rm.Machine.String())
+	if mo == nil {
+		return fmt.Errorf("Machine %s does not exist", rm.Machine)
+	}
+	m := ModelToBackend(models.Clone(AsMachine(mo).Machine)).(*Machine)
+	rm.Job = m.CurrentJob
+	if r.Workflow != "" {
+		m.Workflow = r.Workflow
+	}
+	if r.Stage != "" {
+		m.Stage = r.Stage
+	}
+	if len(r.Params) > 0 && m.Params == nil {
+		m.Params = map[string]interface{}{}
+	}
+	for k, v := range r.Params {
+		m.Params[k] = v
+	}
+	profiles := []string{}
+	for _, p := range m.Profiles {
+		remove := false
+		for _, rp := range r.RemoveProfiles {
+			remove = remove || p == rp
+		}
+		if !remove {
+			profiles = append(profiles, p)
+		}
+	}
+	for _, ap := range r.AddProfiles {
+		have := false
+		for _, p := range profiles {
+			have = have || p == ap
+		}
+		if !have {
+			profiles = append(profiles, ap)
+		}
+	}
+	m.Profiles = profiles
+	_, err := rt.Update(m)
+	return err
+}
+
+// run moves the Rollout along at now.  The running Machines are
+// checked, the Rollout halts if too many of them have failed, and the
+// next wave is started once the current one is done.
+func (r *Rollout) run(rt *RequestTracker, now time.Time) {
+	if r.State != "running" {
+		return
+	}
+	changed := false
+	timedOut := r.WaveTimeout > 0 && !now.Before(r.WaveStarted.Add(time.Duration(r.WaveTimeout)*time.Second))
+	for i := range r.Machines {
+		rm := &r.Machines[i]
+		if rm.State != "running" {
+			continue
+		}
+		state, msg := r.check(rt, rm)
+		if state == "running" && timedOut {
+			state, msg = "failed", fmt.Sprintf("Did not finish within %d seconds", r.WaveTimeout)
+		}
+		if state != rm.State {
+			rt.Infof("Rollout %s: machine %s %s", r.Name, rm.Name, state)
+			rm.State, rm.Message = state, msg
+			changed = true
+		}
+	}
+	counts := r.Counts()
+	done := counts["succeeded"] + counts["failed"]
+	switch {
+	case counts["failed"]*100 > r.MaxFailurePercent*done:
+		r.State = "halted"
+		r.Message = fmt.Sprintf("%d of %d machines failed, more than the %d%% allowed",
+			counts["failed"], done, r.MaxFailurePercent)
+		rt.Errorf("Rollout %s halted: %s", r.Name, r.Message)
+		rt.Publish("rollouts", "halt", r.Key(), r)
+		changed = true
+	case counts["running"] > 0:
+	case counts["pending"] == 0:
+		r.State = "finished"
+		rt.Infof("Rollout %s finished", r.Name)
+		rt.Publish("rollouts", "finish", r.Key(), r)
+		changed = true
+	case !r.Paused:
+		r.Wave++
+		r.WaveStarted = now
+		started := 0
+		for i := range r.Machines {
+			rm := &r.Machines[i]
+			if started == r.BatchSize {
+				break
+			}
+			if rm.State != "pending" {
+				continue
+			}
+			started++
+			rm.Wave = r.Wave
+			rm.State = "running"
+			if err := r.apply(rt, rm); err != nil {
+				rt.Errorf("Rollout %s failed to change machine %s: %v", r.Name, rm.Name, err)
+				rm.State, rm.Message = "failed", err.Error()
+			}
+		}
+		rt.Infof("Rollout %s started wave %d with %d machines", r.Name, r.Wave, started)
+		rt.Publish("rollouts", "wave", r.Key(), r)
+		changed = true
+	}
+	if changed {
+		r.fromRunner = true
+		if _, err := rt.Update(r); err != nil {
+			rt.Errorf("Failed to save rollout %s: %v", r.Name, err)
+		}
+	}
+}
+
+// RunRollouts moves every available running Rollout along at now.
+func (p *DataTracker) RunRollouts(now time.Time) {
+	rt := p.Request(p.Logger,
+		"rollouts:rw",
+		"machines:rw",
+		"stages",
+		"bootenvs",
+		"jobs",
+		"tasks",
+		"profiles",
+		"templates",
+		"workflows",
+		"params")
+	rt.Do(func(d Stores) {
+		for _, obj := range d("rollouts").Items() {
+			old := AsRollout(obj)
+			if !old.Available || old.State != "running" {
+				continue
+			}
+			ModelToBackend(models.Clone(old.Rollout)).(*Rollout).run(rt, now)
+		}
+	})
+}
+
+// RolloutRunner periodically calls RunRollouts until it is shut down.
+type RolloutRunner struct {
+	periodic
+	dt    *DataTracker
+	clock Clock
+}
+
+// NewRolloutRunner starts running the Rollouts every interval, using
+// clock to tell what time it is.
+func NewRolloutRunner(dt *DataTracker, clock Clock, interval time.Duration) *RolloutRunner {
+	r := &RolloutRunner{dt: dt, clock: clock}
+	r.start(interval, func(time.Time) { r.dt.RunRollouts(r.clock.Now()) }, nil)
+	return r
+}
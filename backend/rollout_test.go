@@ -0,0 +1,180 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRollouts(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "rollouts:rw", "stages:rw", "bootenvs", "templates", "tasks:rw", "machines:rw", "profiles:rw", "params", "jobs:rw", "workflows:rw")
+	start := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	webs := []*models.Machine{}
+	for _, name := range []string{"web1.fqdn", "web2.fqdn", "web3.fqdn", "web4.fqdn", "web5.fqdn"} {
+		webs = append(webs, &models.Machine{Uuid: uuid.NewRandom(), Name: name})
+	}
+	db := &models.Machine{Uuid: uuid.NewRandom(), Name: "db.fqdn"}
+	upgrade := &models.Rollout{
+		Name:              "upgrade-web",
+		Filter:            map[string]string{"Name": "Re(^web[1-4])"},
+		Workflow:          "upgrade",
+		AddProfiles:       []string{"upgraded"},
+		BatchSize:         2,
+		TargetStage:       "done",
+		MaxFailurePercent: 30,
+	}
+	tag := &models.Rollout{
+		Name:        "tag-db",
+		Filter:      map[string]string{"Name": "Eq(db.fqdn)"},
+		AddProfiles: []string{"upgraded"},
+		BatchSize:   1,
+		Paused:      true,
+	}
+	tests := []crudTest{
+		{"Create task", rt.Create, &models.Task{Name: "t1"}, true},
+		{"Create stage s1", rt.Create, &models.Stage{Name: "s1", Tasks: []string{"t1"}}, true},
+		{"Create stage done", rt.Create, &models.Stage{Name: "done"}, true},
+		{"Create workflow", rt.Create, &models.Workflow{Name: "upgrade", Stages: []string{"s1", "done"}}, true},
+		{"Create profile", rt.Create, &models.Profile{Name: "upgraded"}, true},
+		{"Create machine web1", rt.Create, webs[0], true},
+		{"Create machine web2", rt.Create, webs[1], true},
+		{"Create machine web3", rt.Create, webs[2], true},
+		{"Create machine web4", rt.Create, webs[3], true},
+		{"Create machine web5", rt.Create, webs[4], true},
+		{"Create machine db", rt.Create, db, true},
+		{"Create rollout that changes nothing", rt.Create, &models.Rollout{Name: "bad", BatchSize: 1}, false},
+		{"Create rollout with no BatchSize", rt.Create, &models.Rollout{Name: "bad", Workflow: "upgrade"}, false},
+		{"Create rollout with Workflow and Stage", rt.Create, &models.Rollout{Name: "bad", Workflow: "upgrade", Stage: "s1", BatchSize: 1}, false},
+		{"Create rollout with bad MaxFailurePercent", rt.Create, &models.Rollout{Name: "bad", Workflow: "upgrade", BatchSize: 1, MaxFailurePercent: 101}, false},
+		{"Create rollout", rt.Create, upgrade, true},
+		{"Create paused rollout", rt.Create, tag, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rollout := func(name string) (res *Rollout) {
+		rt.Do(func(d Stores) { res = AsRollout(rt.find("rollouts", name)) })
+		return
+	}
+	machine := func(key string) (res *Machine) {
+		rt.Do(func(d Stores) { res = AsMachine(rt.find("machines", key)) })
+		return
+	}
+	runner := func(key string, f func(*Machine)) {
+		rt.Do(func(d Stores) {
+			m := ModelToBackend(models.Clone(AsMachine(rt.find("machines", key)).Machine)).(*Machine)
+			m.InRunner()
+			f(m)
+			if _, err := rt.Update(m); err != nil {
+				t.Errorf("Runner failed to update machine %s: %v", key, err)
+			}
+		})
+	}
+	states := func(r *Rollout) string {
+		res := ""
+		for _, m := range r.Machines {
+			res += m.State[:1]
+		}
+		return res
+	}
+
+	r := rollout("upgrade-web")
+	if r.State != "running" || len(r.Machines) != 4 || r.Machines[0].Name != "web1.fqdn" {
+		t.Fatalf("Expected upgrade-web to pick web1 to web4, not %v", r.Machines)
+	}
+	changed := models.Clone(r.Rollout).(*models.Rollout)
+	changed.Workflow = "other"
+	crudTest{"Change what a rollout does", rt.Update, changed, false}.Test(t, rt)
+
+	// The first wave puts two machines on the workflow.
+	dt.RunRollouts(start)
+	if r = rollout("upgrade-web"); r.Wave != 1 || states(r) != "rrpp" {
+		t.Errorf("Expected wave 1 to be running, not wave %d with %s", r.Wave, states(r))
+	}
+	if m := machine(webs[0].Key()); m.Workflow != "upgrade" || m.Profiles[0] != "upgraded" {
+		t.Errorf("Expected web1 to be upgrading, not %s with %v", m.Workflow, m.Profiles)
+	}
+	if m := machine(webs[2].Key()); m.Workflow != "" {
+		t.Errorf("Expected web3 to wait for the next wave, not %s", m.Workflow)
+	}
+	dt.RunRollouts(start.Add(time.Minute))
+	if r = rollout("upgrade-web"); r.Wave != 1 || states(r) != "rrpp" {
+		t.Errorf("Expected wave 1 to wait for its machines, not wave %d with %s", r.Wave, states(r))
+	}
+
+	// Once they reach the done stage, the next wave starts.
+	for _, m := range webs[:2] {
+		runner(m.Key(), func(m *Machine) {
+			m.Stage = "done"
+			m.CurrentTask = 2
+		})
+	}
+	dt.RunRollouts(start.Add(2 * time.Minute))
+	if r = rollout("upgrade-web"); r.Wave != 2 || states(r) != "ssrr" {
+		t.Errorf("Expected wave 2 to be running, not wave %d with %s", r.Wave, states(r))
+	}
+
+	// A failed job on web3 is more than 30% of the machines so far.
+	job := &models.Job{Uuid: uuid.NewRandom(), Previous: uuid.NIL, Machine: webs[2].Uuid, Stage: "s1", Task: "t1", Workflow: "upgrade", State: "running"}
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(job); !created {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	})
+	runner(webs[2].Key(), func(m *Machine) { m.CurrentJob = job.Uuid })
+	rt.Do(func(d Stores) {
+		failed := models.Clone(job).(*models.Job)
+		failed.State = "failed"
+		failed.ExitState = "failed"
+		if _, err := rt.Update(failed); err != nil {
+			t.Errorf("Failed to fail job: %v", err)
+		}
+	})
+	dt.RunRollouts(start.Add(3 * time.Minute))
+	if r = rollout("upgrade-web"); r.State != "halted" || states(r) != "ssfr" || r.Message == "" {
+		t.Errorf("Expected upgrade-web to halt, not %s with %s", r.State, states(r))
+	}
+	dt.RunRollouts(start.Add(4 * time.Minute))
+	if r = rollout("upgrade-web"); r.Wave != 2 || states(r) != "ssfr" {
+		t.Errorf("Expected halted upgrade-web to stay put, not wave %d with %s", r.Wave, states(r))
+	}
+
+	// A paused rollout does not start until it is resumed.
+	if r = rollout("tag-db"); r.Wave != 0 || states(r) != "p" {
+		t.Errorf("Expected paused tag-db to not start, not wave %d with %s", r.Wave, states(r))
+	}
+	resumed := models.Clone(r.Rollout).(*models.Rollout)
+	resumed.Paused = false
+	crudTest{"Resume rollout", rt.Update, resumed, true}.Test(t, rt)
+	dt.RunRollouts(start.Add(5 * time.Minute))
+	if m := machine(db.Key()); len(m.Profiles) != 1 || m.Profiles[0] != "upgraded" {
+		t.Errorf("Expected db to get the upgraded profile, not %v", m.Profiles)
+	}
+	dt.RunRollouts(start.Add(6 * time.Minute))
+	if r = rollout("tag-db"); r.State != "finished" || states(r) != "s" {
+		t.Errorf("Expected tag-db to finish, not %s with %s", r.State, states(r))
+	}
+
+	// Machines that take too long fail the wave.
+	slow := &models.Rollout{
+		Name:        "slow",
+		Filter:      map[string]string{"Name": "Eq(web5.fqdn)"},
+		Workflow:    "upgrade",
+		BatchSize:   1,
+		TargetStage: "done",
+		WaveTimeout: 60,
+	}
+	crudTest{"Create rollout with a timeout", rt.Create, slow, true}.Test(t, rt)
+	dt.RunRollouts(start.Add(10 * time.Minute))
+	dt.RunRollouts(start.Add(10*time.Minute + 59*time.Second))
+	if r = rollout("slow"); states(r) != "r" {
+		t.Errorf("Expected slow to still be running, not %s", states(r))
+	}
+	dt.RunRollouts(start.Add(11 * time.Minute))
+	if r = rollout("slow"); r.State != "halted" || states(r) != "f" {
+		t.Errorf("Expected slow to time out and halt, not %s with %s", r.State, states(r))
+	}
+}
@@ -0,0 +1,205 @@
+package backend
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/store"
+)
+
+// Schedule is the backend model wrapper for Schedule.
+type Schedule struct {
+	*models.Schedule
+	validate
+	// set when the Scheduler is the one saving the Schedule, so that
+	// its read only fields are allowed to change.
+	fromScheduler bool
+}
+
+// SetReadOnly is a helper function to set the ReadOnly flag.
+func (s *Schedule) SetReadOnly(b bool) {
+	s.ReadOnly = b
+}
+
+// SaveClean clears validation fields and returns a KeySaver
+// object for use by the backing store.
+func (s *Schedule) SaveClean() store.KeySaver {
+	mod := *s.Schedule
+	mod.ClearValidation()
+	return toBackend(&mod, s.rt)
+}
+
+// AsSchedule converts a models.Model into a *Schedule.
+func AsSchedule(o models.Model) *Schedule {
+	return o.(*Schedule)
+}
+
+// AsSchedules converts a list of models.Model into a list of *Schedule.
+func AsSchedules(o []models.Model) []*Schedule {
+	res := make([]*Schedule, len(o))
+	for i := range o {
+		res[i] = AsSchedule(o[i])
+	}
+	return res
+}
+
+// New returns a new empty Schedule with the RT field from the caller.
+func (s *Schedule) New() store.KeySaver {
+	res := &Schedule{Schedule: &models.Schedule{}}
+	if s.Schedule != nil && s.ChangeForced() {
+		res.ForceChange()
+	}
+	res.rt = s.rt
+	res.Fill()
+	return res
+}
+
+// Indexes returns the valid Indexes on Schedule.
+func (s *Schedule) Indexes() map[string]index.Maker {
+	fix := AsSchedule
+	res := index.MakeBaseIndexes(s)
+	res["Name"] = index.Maker{
+		Unique: true,
+		Type:   "string",
+		Less:   func(i, j models.Model) bool { return fix(i).Name < fix(j).Name },
+		Eq:     func(i, j models.Model) bool { return fix(i).Name == fix(j).Name },
+		Match:  func(i models.Model, re *regexp.Regexp) bool { return re.MatchString(fix(i).Name) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			name := fix(ref).Name
+			return func(ss models.Model) bool {
+					return fix(ss).Name >= name
+				},
+				func(ss models.Model) bool {
+					return fix(ss).Name > name
+				}
+		},
+		Fill: func(ss string) (models.Model, error) {
+			res := fix(s.New())
+			res.Name = ss
+			return res, nil
+		},
+	}
+	res["Workflow"] = index.Maker{
+		Unique: false,
+		Type:   "string",
+		Less:   func(i, j models.Model) bool { return fix(i).Workflow < fix(j).Workflow },
+		Eq:     func(i, j models.Model) bool { return fix(i).Workflow == fix(j).Workflow },
+		Match:  func(i models.Model, re *regexp.Regexp) bool { return re.MatchString(fix(i).Workflow) },
+		Tests: func(ref models.Model) (gte, gt index.Test) {
+			workflow := fix(ref).Workflow
+			return func(ss models.Model) bool {
+					return fix(ss).Workflow >= workflow
+				},
+				func(ss models.Model) bool {
+					return fix(ss).Workflow > workflow
+				}
+		},
+		Fill: func(ss string) (models.Model, error) {
+			res := fix(s.New())
+			res.Workflow = ss
+			return res, nil
+		},
+	}
+	res["Paused"] = index.MakeUnordered(
+		"boolean",
+		func(i, j models.Model) bool {
+			return fix(i).Paused == fix(j).Paused
+		},
+		func(ss string) (models.Model, error) {
+			res := fix(s.New())
+			switch ss {
+			case "true":
+				res.Paused = true
+			case "false":
+				res.Paused = false
+			default:
+				return nil, errors.New("Paused must be true or false")
+			}
+			return res, nil
+		})
+	return res
+}
+
+var scheduleLockMap = map[string][]string{
+	"get":     {"schedules"},
+	"create":  {"schedules:rw", "workflows", "params"},
+	"update":  {"schedules:rw", "workflows", "params"},
+	"patch":   {"schedules:rw", "workflows", "params"},
+	"delete":  {"schedules:rw"},
+	"actions": {"schedules", "profiles", "params"},
+}
+
+// Locks returns a list of prefixes to lock for the specified action.
+func (s *Schedule) Locks(action string) []string {
+	return scheduleLockMap[action]
+}
+
+// Validate makes sure the Schedule is valid, and that its Workflow
+// exists for it to be available.
+func (s *Schedule) Validate() {
+	s.Schedule.Validate()
+	s.AddError(index.CheckUnique(s, s.rt.stores("schedules").Items()))
+	if _, err := machineFilters(s.rt, s.Filter); err != nil {
+		s.AddError(err)
+	}
+	if !s.SetValid() {
+		return
+	}
+	if wf := s.rt.find("workflows", s.Workflow); wf == nil {
+		s.Errorf("Workflow %s does not exist", s.Workflow)
+	} else if !AsWorkflow(wf).Available {
+		s.Errorf("Workflow %s is not available", s.Workflow)
+	}
+	s.SetAvailable()
+}
+
+// BeforeSave returns an error if the Schedule is not valid.
+func (s *Schedule) BeforeSave() error {
+	s.Fill()
+	s.Validate()
+	if !s.Validated {
+		return s.MakeError(422, ValidationError, s)
+	}
+	return nil
+}
+
+// OnChange keeps the read only fields of the Schedule from being
+// changed by anything but the Scheduler.  Changing when a Schedule
+// fires or unpausing it makes it work out when it should fire next.
+func (s *Schedule) OnChange(oldThing store.KeySaver) error {
+	if s.fromScheduler {
+		return nil
+	}
+	old := AsSchedule(oldThing)
+	s.LastRun, s.NextRun = old.LastRun, old.NextRun
+	s.Pending, s.Running = old.Pending, old.Running
+	if s.Cron != old.Cron || (old.Paused && !s.Paused) {
+		s.NextRun = time.Time{}
+	}
+	return nil
+}
+
+// OnCreate makes the Schedule work out when it should fire first.
+func (s *Schedule) OnCreate() error {
+	if !s.fromScheduler {
+		s.LastRun, s.NextRun = time.Time{}, time.Time{}
+		s.Pending, s.Running = nil, nil
+		s.Fill()
+	}
+	return nil
+}
+
+// AfterSave resets the transient fields of the Schedule.
+func (s *Schedule) AfterSave() {
+	s.fromScheduler = false
+}
+
+// OnLoad initializes the Schedule when loaded from the data store.
+func (s *Schedule) OnLoad() error {
+	defer func() { s.rt = nil }()
+	s.Fill()
+	return s.BeforeSave()
+}
@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// Clock tells the Scheduler what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// WallClock is the Clock that uses the system time.
+var WallClock Clock = wallClock{}
+
+// machineIdle returns whether the Machine has no Tasks left to run.
+func machineIdle(m *Machine) bool {
+	return len(m.Tasks) == 0 || m.CurrentTask >= len(m.Tasks)
+}
+
+// pick returns the idle Machines that the Schedule selects and that
+// it is not already running on.
+func (s *Schedule) pick(rt *RequestTracker) ([]uuid.UUID, error) {
+	filters, err := machineFilters(rt, s.Filter)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.All(filters...)(&rt.d("machines").Index)
+	if err != nil {
+		return nil, err
+	}
+	running := map[string]struct{}{}
+	for _, id := range s.Running {
+		running[id.String()] = struct{}{}
+	}
+	res := []uuid.UUID{}
+	for _, obj := range idx.Items() {
+		m := AsMachine(obj)
+		if _, ok := running[m.Key()]; ok || !machineIdle(m) {
+			continue
+		}
+		res = append(res, m.Uuid)
+	}
+	return res, nil
+}
+
+// run handles one Schedule at now.  Machines the Schedule started
+// that are done free up their slots, the Schedule fires if it is due,
+// and the Machines it picked are started while it is in one of its
+// windows and under its MaxConcurrent limit.  It returns whether the
+// Schedule fired.
+func (s *Schedule) run(rt *RequestTracker, now time.Time) (fired bool) {
+	changed := false
+	running := []uuid.UUID{}
+	for _, id := range s.Running {
+		if mo := rt.find("machines", id.String()); mo != nil {
+			m := AsMachine(mo)
+			if m.Runnable && m.Workflow == s.Workflow && !machineIdle(m) {
+				running = append(running, id)
+			}
+		}
+	}
+	if len(running) != len(s.Running) {
+		s.Running = running
+		changed = true
+	}
+	spec, err := models.ParseCron(s.Cron)
+	if err != nil {
+		return
+	}
+	switch {
+	case s.NextRun.IsZero():
+		s.NextRun = spec.Next(now)
+		changed = true
+	case !now.Before(s.NextRun):
+		s.NextRun = spec.Next(now)
+		changed = true
+		if s.Paused {
+			rt.Infof("Schedule %s is paused, skipping this run", s.Name)
+			rt.Publish("schedules", "skip", s.Key(), s)
+			break
+		}
+		pending, err := s.pick(rt)
+		if err != nil {
+			rt.Errorf("Schedule %s cannot pick machines: %v", s.Name, err)
+			break
+		}
+		rt.Infof("Schedule %s picked %d machines to run %s on", s.Name, len(pending), s.Workflow)
+		s.Pending = pending
+		s.LastRun = now
+		fired = true
+		rt.Publish("schedules", "fire", s.Key(), s)
+	}
+	if !s.Paused && len(s.Pending) > 0 && s.InWindow(now) {
+		for len(s.Pending) > 0 && (s.MaxConcurrent == 0 || len(s.Running) < s.MaxConcurrent) {
+			id := s.Pending[0]
+			s.Pending = s.Pending[1:]
+			changed = true
+			mo := rt.find("machines", id.String())
+			if mo == nil {
+				continue
+			}
+			m := ModelToBackend(models.Clone(AsMachine(mo).Machine)).(*Machine)
+			if !machineIdle(m) {
+				rt.Infof("Schedule %s: machine %s is busy, skipping it", s.Name, m.Key())
+				continue
+			}
+			m.Workflow = s.Workflow
+			m.Runnable = true
+			m.restartWorkflow = true
+			if _, err := rt.Update(m); err != nil {
+				rt.Errorf("Schedule %s failed to start %s on machine %s: %v", s.Name, s.Workflow, m.Key(), err)
+				continue
+			}
+			s.Running = append(s.Running, id)
+			rt.Publish("schedules", "start", s.Key(), m)
+		}
+	}
+	if changed {
+		s.fromScheduler = true
+		if _, err := rt.Update(s); err != nil {
+			rt.Errorf("Failed to save schedule %s: %v", s.Name, err)
+		}
+	}
+	return
+}
+
+// RunSchedules runs every available Schedule at now, and returns the
+// names of the ones that fired.
+func (p *DataTracker) RunSchedules(now time.Time) []string {
+	fired := []string{}
+	rt := p.Request(p.Logger,
+		"schedules:rw",
+		"machines:rw",
+		"stages",
+		"bootenvs",
+		"jobs",
+		"tasks",
+		"profiles",
+		"templates",
+		"workflows",
+		"params")
+	rt.Do(func(d Stores) {
+		for _, obj := range d("schedules").Items() {
+			if !AsSchedule(obj).Available {
+				continue
+			}
+			s := ModelToBackend(models.Clone(AsSchedule(obj).Schedule)).(*Schedule)
+			if s.run(rt, now) {
+				fired = append(fired, s.Key())
+			}
+		}
+	})
+	return fired
+}
+
+// Scheduler periodically calls RunSchedules until it is shut down.
+type Scheduler struct {
+	periodic
+	dt    *DataTracker
+	clock Clock
+}
+
+// NewScheduler starts running the Schedules every interval, using
+// clock to tell what time it is.
+func NewScheduler(dt *DataTracker, clock Clock, interval time.Duration) *Scheduler {
+	s := &Scheduler{dt: dt, clock: clock}
+	s.start(interval, func(time.Time) { s.dt.RunSchedules(s.clock.Now()) }, nil)
+	return s
+}
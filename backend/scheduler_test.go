@@ -0,0 +1,189 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func TestScheduler(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "schedules:rw", "stages:rw", "bootenvs", "templates", "tasks:rw", "machines:rw", "profiles", "params", "jobs", "workflows:rw")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2018, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+	webs := []*models.Machine{}
+	for _, name := range []string{"web1.fqdn", "web2.fqdn", "web3.fqdn"} {
+		webs = append(webs, &models.Machine{Uuid: uuid.NewRandom(), Name: name})
+	}
+	db := &models.Machine{Uuid: uuid.NewRandom(), Name: "db.fqdn"}
+	patch := &models.Schedule{
+		Name:          "patch-web",
+		Cron:          "0 2 * * *",
+		Filter:        map[string]string{"Name": "Re(^web)"},
+		Workflow:      "patch",
+		MaxConcurrent: 2,
+	}
+	backup := &models.Schedule{
+		Name:     "backup-db",
+		Cron:     "0 5 * * *",
+		Filter:   map[string]string{"Name": "Eq(db.fqdn)"},
+		Workflow: "patch",
+		Windows:  []models.ScheduleWindow{{Cron: "0 1 * * *", Duration: 180}},
+	}
+	tests := []crudTest{
+		{"Create task", rt.Create, &models.Task{Name: "t1"}, true},
+		{"Create stage", rt.Create, &models.Stage{Name: "s1", Tasks: []string{"t1"}}, true},
+		{"Create schedule with bad cron", rt.Create, &models.Schedule{Name: "bad", Cron: "0 25 * * *", Workflow: "patch"}, false},
+		{"Create schedule with bad filter", rt.Create, &models.Schedule{Name: "bad", Cron: "@daily", Workflow: "patch", Filter: map[string]string{"Name": "Foo(bar)"}}, false},
+		{"Create schedule with bad window", rt.Create, &models.Schedule{Name: "bad", Cron: "@daily", Workflow: "patch", Windows: []models.ScheduleWindow{{Cron: "@daily"}}}, false},
+		{"Create schedule with missing workflow", rt.Create, patch, true},
+		{"Create workflow", rt.Create, &models.Workflow{Name: "patch", Stages: []string{"s1"}}, true},
+		{"Update schedule once workflow exists", rt.Update, patch, true},
+		{"Create schedule with window", rt.Create, backup, true},
+		{"Create machine web1", rt.Create, webs[0], true},
+		{"Create machine web2", rt.Create, webs[1], true},
+		{"Create machine web3", rt.Create, webs[2], true},
+		{"Create machine db", rt.Create, db, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	schedule := func(name string) (res *Schedule) {
+		rt.Do(func(d Stores) { res = AsSchedule(rt.find("schedules", name)) })
+		return
+	}
+	machine := func(key string) (res *Machine) {
+		rt.Do(func(d Stores) { res = AsMachine(rt.find("machines", key)) })
+		return
+	}
+	finish := func(key string) {
+		rt.Do(func(d Stores) {
+			m := ModelToBackend(models.Clone(AsMachine(rt.find("machines", key)).Machine)).(*Machine)
+			m.InRunner()
+			m.CurrentTask = len(m.Tasks)
+			if _, err := rt.Update(m); err != nil {
+				t.Errorf("Failed to finish machine %s: %v", key, err)
+			}
+		})
+	}
+	running := func(s *Schedule) int {
+		n := 0
+		for _, m := range webs {
+			if machineIdle(machine(m.Key())) {
+				continue
+			}
+			n++
+		}
+		if len(s.Running) != n {
+			t.Errorf("Schedule %s thinks %d machines are running, not %d", s.Name, len(s.Running), n)
+		}
+		return n
+	}
+
+	if fired := dt.RunSchedules(at(1, 0, 0)); len(fired) != 0 {
+		t.Errorf("Expected nothing to fire at midnight, not %v", fired)
+	}
+	if s := schedule("patch-web"); !s.NextRun.Equal(at(1, 2, 0)) {
+		t.Errorf("Expected patch-web to fire next at %v, not %v", at(1, 2, 0), s.NextRun)
+	}
+
+	// patch-web fires at 2, and starts two of the three web machines.
+	if fired := dt.RunSchedules(at(1, 2, 0)); len(fired) != 1 || fired[0] != "patch-web" {
+		t.Errorf("Expected patch-web to fire at 2, not %v", fired)
+	}
+	s := schedule("patch-web")
+	if n := running(s); n != 2 || len(s.Pending) != 1 || !s.LastRun.Equal(at(1, 2, 0)) {
+		t.Errorf("Expected 2 machines running and 1 pending, not %d and %v", n, s.Pending)
+	}
+	if m := machine(db.Key()); m.Workflow != "" {
+		t.Errorf("Expected db machine to not be picked by patch-web, not %s", m.Workflow)
+	}
+	dt.RunSchedules(at(1, 2, 1))
+	if s = schedule("patch-web"); len(s.Pending) != 1 {
+		t.Errorf("Expected the last machine to wait for a free slot, not %v", s.Pending)
+	}
+
+	// Once a machine finishes, the last one is started.
+	finish(s.Running[0].String())
+	dt.RunSchedules(at(1, 2, 2))
+	if s = schedule("patch-web"); len(s.Pending) != 0 || running(s) != 2 {
+		t.Errorf("Expected the last machine to start, not %v pending", s.Pending)
+	}
+	for _, id := range s.Running {
+		finish(id.String())
+	}
+
+	// backup-db fires at 5, but waits for its window at 1 to start.
+	dt.RunSchedules(at(1, 5, 0))
+	if s = schedule("backup-db"); len(s.Pending) != 1 || len(s.Running) != 0 {
+		t.Errorf("Expected backup-db to wait for its window, not %v running", s.Running)
+	}
+	dt.RunSchedules(at(2, 1, 30))
+	if s = schedule("backup-db"); len(s.Pending) != 0 || len(s.Running) != 1 {
+		t.Errorf("Expected backup-db to start in its window, not %v pending", s.Pending)
+	}
+	if m := machine(db.Key()); m.Workflow != "patch" || machineIdle(m) {
+		t.Errorf("Expected db machine to be running patch, not %s", m.Workflow)
+	}
+
+	// A paused schedule skips its runs, and works out when to fire
+	// next once it is resumed.
+	s = schedule("patch-web")
+	rt.Do(func(d Stores) {
+		paused := ModelToBackend(models.Clone(s.Schedule)).(*Schedule)
+		paused.Paused = true
+		paused.NextRun = at(9, 9, 9)
+		if _, err := rt.Update(paused); err != nil {
+			t.Errorf("Failed to pause patch-web: %v", err)
+		}
+	})
+	if s = schedule("patch-web"); !s.NextRun.Equal(at(2, 2, 0)) {
+		t.Errorf("Expected NextRun to be read only, not %v", s.NextRun)
+	}
+	if fired := dt.RunSchedules(at(2, 2, 0)); len(fired) != 0 {
+		t.Errorf("Expected paused patch-web to not fire, not %v", fired)
+	}
+	if s = schedule("patch-web"); !s.LastRun.Equal(at(1, 2, 0)) || !s.NextRun.Equal(at(3, 2, 0)) {
+		t.Errorf("Expected paused patch-web to skip its run, not %v and %v", s.LastRun, s.NextRun)
+	}
+	rt.Do(func(d Stores) {
+		resumed := ModelToBackend(models.Clone(s.Schedule)).(*Schedule)
+		resumed.Paused = false
+		if _, err := rt.Update(resumed); err != nil {
+			t.Errorf("Failed to resume patch-web: %v", err)
+		}
+	})
+	dt.RunSchedules(at(2, 3, 0))
+	if s = schedule("patch-web"); !s.NextRun.Equal(at(3, 2, 0)) {
+		t.Errorf("Expected resumed patch-web to fire next at %v, not %v", at(3, 2, 0), s.NextRun)
+	}
+
+	// The Scheduler runs the schedules using its clock.
+	clock := &fakeClock{now: at(3, 2, 0)}
+	sched := NewScheduler(dt, clock, 10*time.Millisecond)
+	for i := 0; i < 100 && !schedule("patch-web").LastRun.Equal(at(3, 2, 0)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sched.Shutdown(context.Background()); err != nil {
+		t.Errorf("Failed to shut down the scheduler: %v", err)
+	}
+	if s = schedule("patch-web"); !s.LastRun.Equal(at(3, 2, 0)) {
+		t.Errorf("Expected the scheduler to fire patch-web at %v, not %v", at(3, 2, 0), s.LastRun)
+	}
+}
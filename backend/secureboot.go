@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// SecureBootParam is the param that marks a machine as having UEFI
+// Secure Boot enabled.  When it is true, the machine will be handed
+// the signed shim and grub chain from its BootEnv instead of the
+// unsigned loaders dr-provision ships with.  Unknown machines use the
+// value from the global profile.
+const SecureBootParam = "secure-boot"
+
+// shim looks for the grub it should chainload next to itself, under
+// a name that depends on the architecture.
+var secureBootGrubNames = map[string]string{
+	"amd64": "grubx64.efi",
+	"arm64": "grubaa64.efi",
+}
+
+// Signed grub builds look for grub.cfg in the directory they were
+// loaded from.  Hand them off to the regular grub config that the
+// BootEnvs render.
+const secureBootGrubCfg = `set prefix=(tftp)/grub
+configfile (tftp)/grub/grub.cfg
+`
+
+// SecureBoot returns whether the machine has Secure Boot enabled.
+// If m is nil, the global profile is consulted.
+func (rt *RequestTracker) SecureBoot(m *Machine) bool {
+	var obj models.Paramer
+	if m != nil {
+		obj = m
+	} else if p := rt.find("profiles", rt.dt.GlobalProfileName); p != nil {
+		obj = AsProfile(p)
+	} else {
+		return false
+	}
+	v, ok := rt.GetParam(obj, SecureBootParam, true, false)
+	if !ok {
+		return false
+	}
+	enabled, _ := v.(bool)
+	return enabled
+}
+
+func (b *BootEnv) secureBootDir(arch string) string {
+	return path.Join("/secure-boot", b.Name, arch)
+}
+
+// SecureBootLoader returns the file that a machine with Secure Boot
+// enabled should be told to boot for arch, or an empty string if
+// this BootEnv does not have a signed chain for arch.
+func (b *BootEnv) SecureBootLoader(arch string) string {
+	ourArch := b.ArchFor(arch)
+	if ourArch == "" || b.realArches[ourArch].Shim == "" {
+		return ""
+	}
+	return path.Join(b.secureBootDir(ourArch), "shim.efi")[1:]
+}
+
+// canSecureBoot checks that the signed chain for arch is present.
+func (b *BootEnv) canSecureBoot(rt *RequestTracker, arch string) error {
+	if !b.NetBoot() {
+		return nil
+	}
+	ret := &models.Error{
+		Code: http.StatusNotAcceptable,
+		Type: "bootenv",
+		Key:  b.Name,
+	}
+	ourArch := b.ArchFor(arch)
+	if ourArch == "" {
+		ret.Errorf("Cannot handle arch %s", arch)
+		return ret
+	}
+	archInfo := b.realArches[ourArch]
+	if archInfo.Shim == "" {
+		ret.Errorf("bootenv: %s: no Secure Boot chain for arch %s", b.Name, arch)
+		return ret
+	}
+	for _, f := range []string{archInfo.Shim, archInfo.Grub} {
+		fPath := b.localPathFor(rt, f, ourArch)
+		st, err := os.Stat(fPath)
+		if err != nil {
+			ret.Errorf("bootenv: %s: missing Secure Boot loader %s (%s) for arch %s",
+				b.Name,
+				f,
+				rt.dt.reportPath(fPath),
+				arch)
+		} else if !st.Mode().IsRegular() {
+			ret.Errorf("bootenv: %s: invalid Secure Boot loader %s (%s) for arch %s",
+				b.Name,
+				f,
+				rt.dt.reportPath(fPath),
+				arch)
+		}
+	}
+	return ret.HasError()
+}
+
+// secureBootRenderers serves the signed shim, the signed grub it
+// chainloads, and a grub.cfg for every arch that has a signed chain.
+func (b *BootEnv) secureBootRenderers(rt *RequestTracker) renderers {
+	res := renderers{}
+	for arch, archInfo := range b.realArches {
+		grubName, ok := secureBootGrubNames[arch]
+		if archInfo.Shim == "" || !ok {
+			continue
+		}
+		dir := b.secureBootDir(arch)
+		shim := b.localPathFor(rt, archInfo.Shim, arch)
+		grub := b.localPathFor(rt, archInfo.Grub, arch)
+		res = append(res,
+			renderer{
+				path:  path.Join(dir, "shim.efi"),
+				name:  "shim.efi",
+				write: func(net.IP) (io.Reader, error) { return os.Open(shim) },
+			},
+			renderer{
+				path:  path.Join(dir, grubName),
+				name:  grubName,
+				write: func(net.IP) (io.Reader, error) { return os.Open(grub) },
+			},
+			renderer{
+				path: path.Join(dir, "grub.cfg"),
+				name: "grub.cfg",
+				write: func(net.IP) (io.Reader, error) {
+					return bytes.NewReader([]byte(secureBootGrubCfg)), nil
+				},
+			})
+	}
+	return res
+}
@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestSecureBoot(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages", "templates:rw", "machines:rw", "tasks", "bootenvs:rw", "profiles", "params", "jobs", "workflows")
+	env := &models.BootEnv{
+		Name:      "signed",
+		OS:        models.OsInfo{Name: "signed-os"},
+		Templates: []models.TemplateInfo{{Name: "ipxe", Path: "{{ .Env.Name }}", Contents: "{{ .Env.Name }}"}},
+	}
+	env.OS.SupportedArchitectures = map[string]models.ArchInfo{
+		"amd64": {
+			Kernel: "vmlinuz",
+			Shim:   "EFI/BOOT/BOOTX64.EFI",
+			Grub:   "EFI/BOOT/grubx64.efi",
+		},
+	}
+	root := path.Join(dt.FileRoot, "signed-os")
+	for f, contents := range map[string]string{
+		"vmlinuz":              "kernel",
+		"EFI/BOOT/BOOTX64.EFI": "shim",
+		"EFI/BOOT/grubx64.efi": "grub",
+	} {
+		os.MkdirAll(path.Dir(path.Join(root, f)), 0755)
+		if err := ioutil.WriteFile(path.Join(root, f), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", f, err)
+		}
+	}
+	defer os.RemoveAll(root)
+	tests := []crudTest{
+		{"Create signed bootenv", rt.Create, env, true},
+		{"Create bootenv with Shim and no Grub", rt.Create, &models.BootEnv{
+			Name: "half-signed",
+			OS: models.OsInfo{
+				Name:                   "signed-os",
+				SupportedArchitectures: map[string]models.ArchInfo{"amd64": {Kernel: "vmlinuz", Shim: "EFI/BOOT/BOOTX64.EFI"}},
+			},
+		}, false},
+		{"Create unsigned bootenv", rt.Create, &models.BootEnv{
+			Name:      "unsigned",
+			OS:        models.OsInfo{Name: "signed-os"},
+			Kernel:    "vmlinuz",
+			Templates: []models.TemplateInfo{{Name: "ipxe", Path: "{{ .Env.Name }}-unsigned", Contents: "{{ .Env.Name }}"}},
+		}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var signed, unsigned *BootEnv
+	rt.Do(func(d Stores) {
+		signed = AsBootEnv(rt.find("bootenvs", "signed"))
+		unsigned = AsBootEnv(rt.find("bootenvs", "unsigned"))
+	})
+	if l := signed.SecureBootLoader("x86_64"); l != "secure-boot/signed/amd64/shim.efi" {
+		t.Errorf("Unexpected Secure Boot loader %s", l)
+	}
+	if l := unsigned.SecureBootLoader("amd64"); l != "" {
+		t.Errorf("Unsigned bootenv should not have a Secure Boot loader, not %s", l)
+	}
+	for f, contents := range map[string]string{
+		"shim.efi":    "shim",
+		"grubx64.efi": "grub",
+		"grub.cfg":    "configfile (tftp)/grub/grub.cfg",
+	} {
+		rdr, err := dt.FS.Open("/secure-boot/signed/amd64/"+f, nil)
+		if err != nil || rdr == nil {
+			t.Errorf("Failed to open %s: %v", f, err)
+			continue
+		}
+		buf, _ := ioutil.ReadAll(rdr)
+		if !strings.Contains(string(buf), contents) {
+			t.Errorf("Expected %s to contain %s, not %s", f, contents, string(buf))
+		}
+	}
+	machine := &models.Machine{
+		Uuid:   uuid.NewRandom(),
+		Name:   "secure.fqdn",
+		Arch:   "amd64",
+		Params: map[string]interface{}{SecureBootParam: true},
+	}
+	errorsFor := func(bootEnv string) string {
+		var err error
+		rt.Do(func(d Stores) {
+			m := models.Clone(AsMachine(rt.find("machines", machine.UUID())).Machine).(*models.Machine)
+			m.BootEnv = bootEnv
+			_, err = rt.Update(m)
+		})
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+	crudTest{"Create Secure Boot machine", rt.Create, machine, true}.Test(t, rt)
+	if errs := errorsFor("unsigned"); !strings.Contains(errs, "cannot Secure Boot") {
+		t.Errorf("Expected an error moving to unsigned bootenv, not %q", errs)
+	}
+	grub := path.Join(root, "EFI/BOOT/grubx64.efi")
+	os.Rename(grub, grub+".bak")
+	if errs := errorsFor("signed"); !strings.Contains(errs, "missing Secure Boot loader") {
+		t.Errorf("Expected a missing loader error, not %q", errs)
+	}
+	os.Rename(grub+".bak", grub)
+	if errs := errorsFor("signed"); errs != "" {
+		t.Errorf("Unexpected errors moving to signed bootenv: %s", errs)
+	}
+}
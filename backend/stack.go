@@ -36,6 +36,32 @@ is at https://www.syslinux.org/wiki/index.php?title=Comboot/chain.c32`,
 				"default": "localboot 0",
 			},
 		}
+		bmcParams = []*models.Param{
+			{
+				Name:        BMCDriverParam,
+				Description: "How the server talks to the BMC of the machine to control its power",
+				Schema: map[string]interface{}{
+					"type": "string",
+					"enum": []string{"redfish", "ipmi"},
+				},
+			},
+			{
+				Name:        BMCAddressParam,
+				Description: "The address of the BMC of the machine, with an optional port or Redfish URL",
+				Schema:      map[string]string{"type": "string"},
+			},
+			{
+				Name:        BMCUsernameParam,
+				Description: "The user to log in to the BMC of the machine as",
+				Schema:      map[string]string{"type": "string"},
+			},
+			{
+				Name:        BMCPasswordParam,
+				Description: "The password to log in to the BMC of the machine with",
+				Secure:      true,
+				Schema:      map[string]string{"type": "string"},
+			},
+		}
 		ignoreBoot = &models.BootEnv{
 			Name:        `ignore`,
 			Description: "The boot environment you should use to have unknown machines boot off their local hard drive",
@@ -282,6 +308,10 @@ fi
 	superUser.Fill()
 	localBootParam.Fill()
 	params.Save("pxelinux-local-boot", localBootParam)
+	for _, param := range bmcParams {
+		param.Fill()
+		params.Save(param.Name, param)
+	}
 	bootEnvs.Save("local", localBoot)
 	bootEnvs.Save("ignore", ignoreBoot)
 	stages.Save("none", noneStage)
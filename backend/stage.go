@@ -305,6 +305,12 @@ func (s *Stage) Validate() {
 				}
 			case "action":
 				continue
+			case "parallel":
+				for _, name := range models.ParallelTasks(ent) {
+					if tasks.Find(name) == nil {
+						s.Errorf("Task %s (at %d) does not exist", name, i)
+					}
+				}
 			case "chroot":
 			default:
 				s.Errorf("%s (at %d) is malformed", ent, i)
@@ -366,18 +372,15 @@ func (s *Stage) Validate() {
 	if workflows != nil {
 		for _, i := range workflows.Items() {
 			workflow := AsWorkflow(i)
-			for _, stageName := range workflow.Stages {
-				if stageName != s.Name {
-					continue
-				}
-				func() {
-					workflow.rt = s.rt
-					defer func() { workflow.rt = nil }()
-					workflow.ClearValidation()
-					workflow.Validate()
-				}()
+			if !workflow.usesStage(s.Name) {
+				continue
 			}
-			break
+			func() {
+				workflow.rt = s.rt
+				defer func() { workflow.rt = nil }()
+				workflow.ClearValidation()
+				workflow.Validate()
+			}()
 		}
 	}
 }
@@ -429,10 +432,7 @@ func (s *Stage) BeforeDelete() error {
 	workflows := s.rt.stores("workflows")
 	for _, i := range workflows.Items() {
 		workflow := AsWorkflow(i)
-		for _, stageName := range workflow.Stages {
-			if stageName != s.Name {
-				continue
-			}
+		if workflow.usesStage(s.Name) {
 			e.Errorf("Stage %s in use by Workflow %s", s.Name, workflow.Name)
 		}
 	}
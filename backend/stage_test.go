@@ -78,3 +78,27 @@ func TestStageCrud(t *testing.T) {
 		test.Test(t, rt)
 	}
 }
+
+func TestStageParallelTasks(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "tasks:rw", "machines", "profiles", "workflows")
+	tests := []crudTest{
+		{"Create Task wipe-a", rt.Create, &models.Task{Name: "wipe-a"}, true},
+		{"Create Task wipe-b", rt.Create, &models.Task{Name: "wipe-b"}, true},
+		{"Create Stage with parallel tasks", rt.Create, &models.Stage{Name: "wipe", Tasks: []string{"parallel:wipe-a,wipe-b"}}, true},
+		{"Create Stage with missing parallel task", rt.Create, &models.Stage{Name: "missing", Tasks: []string{"parallel:wipe-a,wipe-c"}}, true},
+		{"Create Stage with one parallel task", rt.Create, &models.Stage{Name: "single", Tasks: []string{"parallel:wipe-a"}}, false},
+		{"Create Stage with repeated parallel task", rt.Create, &models.Stage{Name: "repeated", Tasks: []string{"parallel:wipe-a,wipe-a"}}, false},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		if !AsStage(rt.find("stages", "wipe")).Available {
+			t.Errorf("Stage wipe should be available")
+		}
+		if AsStage(rt.find("stages", "missing")).Available {
+			t.Errorf("Stage missing should not be available")
+		}
+	})
+}
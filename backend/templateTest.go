@@ -0,0 +1,302 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/store"
+	"github.com/pborman/uuid"
+)
+
+var templateRefRE = regexp.MustCompile(`(?:template|\.CallTemplate)\s+"([^"]+)"`)
+
+// lineDiff returns a minimal line-oriented diff between want and got,
+// with lines only in want prefixed by - and lines only in got
+// prefixed by +.
+func lineDiff(want, got string) string {
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	res := []string{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			res = append(res, "  "+a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			res = append(res, "+ "+b[j])
+			j++
+		default:
+			res = append(res, "- "+a[i])
+			i++
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+func checkTemplateExpect(res *models.TemplateTestResult, exp *models.TemplateTestExpect, files models.JobActions) {
+	what := exp.Path
+	if what == "" {
+		what = exp.Name
+	}
+	var found *models.JobAction
+	for _, f := range files {
+		if (exp.Path == "" || exp.Path == f.Path) && (exp.Name == "" || exp.Name == f.Name) {
+			found = f
+			break
+		}
+	}
+	if found == nil {
+		res.Failures = append(res.Failures, fmt.Sprintf("%s was not rendered", what))
+		return
+	}
+	if exp.Content != "" && exp.Content != found.Content {
+		res.Failures = append(res.Failures,
+			fmt.Sprintf("%s did not render as expected:\n%s", what, lineDiff(exp.Content, found.Content)))
+	}
+	for _, m := range exp.Matches {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s: invalid regex %s: %v", what, m, err))
+		} else if !re.MatchString(found.Content) {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s does not match %s", what, m))
+		}
+	}
+	for _, m := range exp.NotMatches {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s: invalid regex %s: %v", what, m, err))
+		} else if re.MatchString(found.Content) {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s matches %s", what, m))
+		}
+	}
+}
+
+func (p *DataTracker) runTemplateTest(test *models.TemplateTest, rendered map[string]struct{}) *models.TemplateTestResult {
+	res := &models.TemplateTestResult{Name: test.Name}
+	rt := p.Request(p.Logger,
+		"stages",
+		"bootenvs",
+		"templates",
+		"tasks",
+		"machines:rw",
+		"profiles:rw",
+		"params",
+		"preferences",
+		"workflows",
+		"jobs:rw",
+		"inventories:rw")
+	machine := &Machine{}
+	Fill(machine)
+	if test.Machine != nil {
+		if err := models.Remarshal(test.Machine, machine.Machine); err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("Invalid fixture machine: %v", err))
+			return res
+		}
+	}
+	if machine.Uuid == nil {
+		machine.Uuid = uuid.NewRandom()
+	}
+	if machine.Name == "" {
+		machine.Name = strings.Replace(test.Name, " ", "-", -1)
+	}
+	if machine.Params == nil {
+		machine.Params = map[string]interface{}{}
+	}
+	for k, v := range test.Params {
+		machine.Params[k] = v
+	}
+	profiles := []*Profile{}
+	rt.Do(func(d Stores) {
+		for _, prof := range test.Profiles {
+			profile := AsProfile(toBackend(prof, rt))
+			if _, err := rt.Create(profile); err != nil {
+				res.Failures = append(res.Failures, fmt.Sprintf("Failed to create profile %s: %v", prof.Name, err))
+				continue
+			}
+			profiles = append(profiles, profile)
+			machine.Profiles = append(machine.Profiles, prof.Name)
+		}
+		if len(res.Failures) > 0 {
+			return
+		}
+		if _, err := rt.Create(machine); err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("Failed to create fixture machine: %v", err))
+		}
+	})
+	defer rt.Do(func(d Stores) {
+		rt.Remove(machine)
+		for _, profile := range profiles {
+			rt.Remove(profile)
+		}
+	})
+	if len(res.Failures) > 0 {
+		return res
+	}
+	results, err := RenderPreview(rt, machine.UUID(), test.BootEnv, test.Stage, test.Task)
+	if err != nil {
+		res.Failures = append(res.Failures, err.Error())
+		return res
+	}
+	files := models.JobActions{}
+	errs := []string{}
+	for _, r := range results {
+		files = append(files, r.Files...)
+		errs = append(errs, r.Errors...)
+	}
+	for _, f := range files {
+		rendered[f.Name] = struct{}{}
+	}
+	for i := range test.Expect {
+		checkTemplateExpect(res, &test.Expect[i], files)
+	}
+	for _, e := range errs {
+		matched := false
+		for _, m := range test.ExpectErrors {
+			if re, err := regexp.Compile(m); err == nil && re.MatchString(e) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			res.Failures = append(res.Failures, fmt.Sprintf("Unexpected render error: %s", e))
+		}
+	}
+	for _, m := range test.ExpectErrors {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("Invalid error regex %s: %v", m, err))
+			continue
+		}
+		matched := false
+		for _, e := range errs {
+			if re.MatchString(e) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			res.Failures = append(res.Failures, fmt.Sprintf("Expected a render error matching %s", m))
+		}
+	}
+	res.Passed = len(res.Failures) == 0
+	return res
+}
+
+// RunTemplateTests loads content into a scratch in-memory DataStack
+// and runs tests against it using the same renderers that
+// dr-provision uses to serve files and job actions.  Coverage is
+// reported against the templates in content.
+func RunTemplateTests(content store.Store, tests []*models.TemplateTest, l logger.Logger) (*models.TemplateTestReport, error) {
+	fileRoot, err := ioutil.TempDir("", "drp-template-test-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(fileRoot)
+	secrets, _ := store.Open("memory:///")
+	stack, err := DefaultDataStack("", "memory:///", "", "", "", fileRoot, l, map[string]store.Store{})
+	if err != nil {
+		return nil, err
+	}
+	name := "template-test"
+	if ms, ok := content.(store.MetaSaver); ok && ms.MetaData()["Name"] != "" {
+		name = ms.MetaData()["Name"]
+	}
+	stack, hard, _ := stack.AddReplaceSAAS(name, content, secrets, l, nil)
+	if hard != nil {
+		return nil, hard
+	}
+	info := &models.Info{ApiPort: 8092, FilePort: 8091, Id: "template-test"}
+	info.Fill()
+	dt := NewDataTracker(stack,
+		secrets,
+		fileRoot,
+		fileRoot,
+		"127.0.0.1",
+		true,
+		info,
+		l,
+		map[string]string{
+			"systemGrantorSecret": models.RandString(32),
+			"defaultStage":        "none",
+			"defaultBootEnv":      "local",
+			"unknownBootEnv":      "ignore",
+		},
+		NewPublishers(log.New(ioutil.Discard, "", 0)),
+		nil)
+
+	report := &models.TemplateTestReport{}
+	rendered := map[string]struct{}{}
+	for _, test := range tests {
+		res := dt.runTemplateTest(test, rendered)
+		if res.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, res)
+	}
+
+	// Work out coverage of the templates in the bundle.  Templates
+	// pulled in from a rendered template count as rendered too.
+	contents := map[string]string{}
+	if sub := content.GetSub("templates"); sub != nil {
+		keys, _ := sub.Keys()
+		for _, k := range keys {
+			tmpl := &models.Template{}
+			if sub.Load(k, tmpl) == nil {
+				contents[tmpl.ID] = tmpl.Contents
+			}
+		}
+	}
+	todo := []string{}
+	for k := range rendered {
+		todo = append(todo, k)
+	}
+	for len(todo) > 0 {
+		k := todo[0]
+		todo = todo[1:]
+		for _, m := range templateRefRE.FindAllStringSubmatch(contents[k], -1) {
+			if _, ok := rendered[m[1]]; !ok {
+				rendered[m[1]] = struct{}{}
+				todo = append(todo, m[1])
+			}
+		}
+	}
+	report.Covered, report.Uncovered = []string{}, []string{}
+	for k := range contents {
+		if _, ok := rendered[k]; ok {
+			report.Covered = append(report.Covered, k)
+		} else {
+			report.Uncovered = append(report.Uncovered, k)
+		}
+	}
+	sort.Strings(report.Covered)
+	sort.Strings(report.Uncovered)
+	if len(contents) > 0 {
+		report.Coverage = float64(len(report.Covered)) * 100 / float64(len(contents))
+	}
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/store"
+)
+
+func TestRunTemplateTests(t *testing.T) {
+	content := &models.Content{
+		Meta: models.ContentMetaData{Name: "tmpltest", Version: "v1.0.0"},
+		Sections: models.Sections{
+			"templates": map[string]interface{}{
+				"top.tmpl":     &models.Template{ID: "top.tmpl", Contents: "hello {{.Param \"who\"}}\n{{template \"inc.tmpl\" .}}"},
+				"inc.tmpl":     &models.Template{ID: "inc.tmpl", Contents: "from {{.Env.Name}}"},
+				"unused.tmpl":  &models.Template{ID: "unused.tmpl", Contents: "nobody renders me"},
+				"unused2.tmpl": &models.Template{ID: "unused2.tmpl", Contents: "nor me"},
+			},
+			"bootenvs": map[string]interface{}{
+				"greeter": &models.BootEnv{
+					Name: "greeter",
+					Templates: []models.TemplateInfo{
+						{Name: "greeting", Path: "machines/{{.Machine.UUID}}/greeting", ID: "top.tmpl"},
+					},
+				},
+			},
+		},
+	}
+	s, _ := store.Open("memory:///")
+	if err := content.ToStore(s); err != nil {
+		t.Fatalf("Failed to build content store: %v", err)
+	}
+	tests := []*models.TemplateTest{
+		{
+			Name:    "pass",
+			BootEnv: "greeter",
+			Params:  map[string]interface{}{"who": "world"},
+			Expect: []models.TemplateTestExpect{
+				{Name: "top.tmpl", Content: "hello world\nfrom greeter"},
+				{Name: "top.tmpl", Matches: []string{"^hello w"}, NotMatches: []string{"goodbye"}},
+			},
+		},
+		{
+			Name:    "fail",
+			BootEnv: "greeter",
+			Params:  map[string]interface{}{"who": "there"},
+			Expect: []models.TemplateTestExpect{
+				{Name: "top.tmpl", Content: "hello world\nfrom greeter"},
+				{Path: "missing"},
+			},
+		},
+	}
+	dt := mkDT()
+	report, err := RunTemplateTests(s, tests, dt.Logger)
+	if err != nil {
+		t.Fatalf("Failed to run template tests: %v", err)
+	}
+	if report.Passed != 1 || report.Failed != 1 {
+		t.Errorf("Expected 1 pass and 1 fail, got %d and %d", report.Passed, report.Failed)
+	}
+	if len(report.Results) == 2 {
+		if !report.Results[0].Passed {
+			t.Errorf("Test pass failed: %v", report.Results[0].Failures)
+		}
+		fails := report.Results[1].Failures
+		if len(fails) != 2 {
+			t.Errorf("Expected 2 failures, got %v", fails)
+		} else if !strings.Contains(fails[0], "- hello world\n+ hello there\n  from greeter") {
+			t.Errorf("Expected a diff in the failure, got %s", fails[0])
+		}
+	}
+	if len(report.Covered) != 2 || report.Coverage != 50 {
+		t.Errorf("Expected 50%% coverage of 2 templates, got %v%%: %v", report.Coverage, report.Covered)
+	}
+}
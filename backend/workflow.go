@@ -126,7 +126,7 @@ func (w *Workflow) Validate() {
 	if !w.SetValid() {
 		return
 	}
-	for _, stageName := range w.Stages {
+	for _, stageName := range w.stageNames() {
 		if stage := w.rt.find("stages", stageName); stage == nil {
 			w.Errorf("Stage %s does not exist", stageName)
 		} else if !stage.(*Stage).Available {
@@ -136,6 +136,59 @@ func (w *Workflow) Validate() {
 	w.SetAvailable()
 }
 
+// stageNames returns the names of all the Stages the Workflow can
+// send a Machine to, including the ones only reachable through its
+// Transitions.
+func (w *Workflow) stageNames() []string {
+	res := append([]string{}, w.Stages...)
+	seen := map[string]struct{}{}
+	for _, name := range res {
+		seen[name] = struct{}{}
+	}
+	others := []string{w.OnFailure}
+	for _, t := range w.Transitions {
+		others = append(others, t.From, t.To)
+	}
+	for _, name := range others {
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		res = append(res, name)
+	}
+	return res
+}
+
+// usesStage returns whether the Workflow refers to the named Stage.
+func (w *Workflow) usesStage(name string) bool {
+	for _, stageName := range w.stageNames() {
+		if stageName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStage returns the Stage that m should go to when it leaves from
+// with result ("success" or "failure"), or an empty string if it
+// should carry on through the Workflow as usual.
+func (w *Workflow) nextStage(rt *RequestTracker, m *Machine, from, result string) string {
+	for i := range w.Transitions {
+		t := &w.Transitions[i]
+		var param interface{}
+		if t.Param != "" {
+			param, _ = rt.GetParam(m, t.Param, true, false)
+		}
+		if t.Matches(from, result, param) {
+			return t.To
+		}
+	}
+	if result == "failure" {
+		return w.OnFailure
+	}
+	return ""
+}
+
 // BeforeSave validates the state of the Workflow.
 // This is used generally before saving but also
 // when an object needs to initialized and
@@ -1,9 +1,12 @@
 package backend
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/provision/utils"
+	"github.com/pborman/uuid"
 )
 
 func TestWorkflowCrud(t *testing.T) {
@@ -22,3 +25,104 @@ func TestWorkflowCrud(t *testing.T) {
 		test.Test(t, rt)
 	}
 }
+
+func TestWorkflowTransitions(t *testing.T) {
+	dt := mkDT()
+	rt := dt.Request(dt.Logger, "stages:rw", "bootenvs", "templates", "tasks:rw", "machines:rw", "profiles", "params", "jobs:rw", "workflows:rw")
+	wf := &models.Workflow{
+		Name:   "burnin",
+		Stages: []string{"s1", "s2"},
+		Transitions: []models.WorkflowTransition{
+			{From: "s1", To: "dell", Result: "success", Param: "hw-vendor", Value: "dell"},
+		},
+		OnFailure: "rma",
+	}
+	vendored := &models.Machine{Uuid: uuid.NewRandom(), Name: "vendored", Workflow: "burnin", Params: map[string]interface{}{
+		"hw-vendor":        "dell",
+		"change-stage/map": map[string]string{"s1": "s2:Reboot", "s2": "s3"},
+	}}
+	plain := &models.Machine{Uuid: uuid.NewRandom(), Name: "plain", Workflow: "burnin"}
+	tests := []crudTest{
+		{"Create task", rt.Create, &models.Task{Name: "t1"}, true},
+		{"Create Stage s1", rt.Create, &models.Stage{Name: "s1", Tasks: []string{"t1"}}, true},
+		{"Create Stage s2", rt.Create, &models.Stage{Name: "s2", Tasks: []string{"t1"}}, true},
+		{"Create Stage dell", rt.Create, &models.Stage{Name: "dell", Tasks: []string{"t1"}}, true},
+		{"Create Workflow with bad Result", rt.Create, &models.Workflow{
+			Name:        "bad",
+			Stages:      []string{"s1"},
+			Transitions: []models.WorkflowTransition{{From: "s1", To: "s2", Result: "maybe"}},
+		}, false},
+		{"Create Workflow with missing OnFailure Stage", rt.Create, wf, true},
+		{"Create Stage rma", rt.Create, &models.Stage{Name: "rma", Tasks: []string{"t1"}}, true},
+		{"Create vendored machine", rt.Create, vendored, true},
+		{"Create plain machine", rt.Create, plain, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var available bool
+	rt.Do(func(d Stores) { available = AsWorkflow(rt.find("workflows", "burnin")).Available })
+	if !available {
+		t.Errorf("Workflow should be available once its OnFailure Stage exists")
+	}
+	runner := func(key string, f func(*Machine)) *Machine {
+		var res *Machine
+		rt.Do(func(d Stores) {
+			m := ModelToBackend(models.Clone(AsMachine(rt.find("machines", key)).Machine)).(*Machine)
+			m.InRunner()
+			f(m)
+			if _, err := rt.Update(m); err != nil {
+				t.Errorf("Runner failed to update machine %s: %v", key, err)
+			}
+			res = AsMachine(rt.find("machines", key))
+		})
+		return res
+	}
+	leaveS1 := func(m *Machine) {
+		m.Stage = "s2"
+		m.CurrentTask = 2
+	}
+	if m := runner(plain.Key(), leaveS1); m.Stage != "s2" || m.CurrentTask != 2 {
+		t.Errorf("Expected plain machine to carry on to s2, not %s at %d", m.Stage, m.CurrentTask)
+	}
+	m := runner(vendored.Key(), leaveS1)
+	if m.Stage != "dell" || m.CurrentTask != -1 || strings.Join(m.Tasks, ",") != "stage:dell,t1" {
+		t.Errorf("Expected vendored machine to go to dell, not %s at %d with %v", m.Stage, m.CurrentTask, m.Tasks)
+	}
+	csMap := map[string]string{}
+	if err := utils.Remarshal(m.Params["change-stage/map"], &csMap); err != nil ||
+		csMap["s1"] != "dell:Reboot" || csMap["s2"] != "s3" || len(csMap) != 2 {
+		t.Errorf("Expected only the s1 change-stage/map entry to be redirected to dell, not %v: %v", csMap, err)
+	}
+	job := &models.Job{
+		Uuid:         uuid.NewRandom(),
+		Previous:     uuid.NIL,
+		Machine:      vendored.Uuid,
+		Stage:        "dell",
+		Task:         "t1",
+		CurrentIndex: 1,
+		State:        "running",
+	}
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(job); !created {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	})
+	runner(vendored.Key(), func(m *Machine) {
+		m.CurrentJob = job.Uuid
+		m.CurrentTask = 1
+		m.Runnable = false
+	})
+	rt.Do(func(d Stores) {
+		j := ModelToBackend(models.Clone(job)).(*Job)
+		j.State = "failed"
+		j.ExitState = "failed"
+		if _, err := rt.Update(j); err != nil {
+			t.Errorf("Failed to fail job: %v", err)
+		}
+		m = AsMachine(rt.find("machines", vendored.Key()))
+	})
+	if m.Stage != "rma" || !m.Runnable || strings.Join(m.Tasks, ",") != "stage:rma,t1" {
+		t.Errorf("Expected failed machine to go to rma and be runnable, not %s (%v) with %v", m.Stage, m.Runnable, m.Tasks)
+	}
+}
@@ -677,6 +677,84 @@ func registerContent(app *cobra.Command) {
 			return err
 		},
 	})
+	testsDir := ""
+	testCmd := &cobra.Command{
+		Use:   "test [bundle]",
+		Short: "Run the template tests for the content bundle [bundle]",
+		Long: `Test sends [bundle] and its template tests to dr-provision, which loads
+[bundle] into a scratch in-memory data stack and runs the tests using the
+renderers it uses to serve files and job actions.  Content already on the
+system is not used or changed.  [bundle] can either be a content bundle
+file or a directory laid out for 'drpcli contents bundle', and defaults to
+the current directory.
+
+Tests live in the tests directory alongside the templates, tasks, and
+stages in the bundle directory, with each file in it holding a single
+test.  'drpcli contents bundle' carries them in the tests section of the
+bundle, and 'drpcli contents unbundle' writes them back out, so a bundle
+file can be tested on its own.  --tests runs the tests in another
+directory instead.  The report includes diffs for any failed
+expectations and the template coverage of the tests.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("%v requires at most 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			src := "."
+			if len(args) == 1 {
+				src = args[0]
+			}
+			fi, err := os.Stat(src)
+			if err != nil {
+				return fmt.Errorf("Failed to open bundle %s: %v", src, err)
+			}
+			content := &models.Content{}
+			if fi.IsDir() {
+				s, _ := store.Open("memory:///")
+				defer s.Close()
+				cc := &api.Client{}
+				if err := cc.BundleContent(src, s, map[string]string{}); err != nil {
+					return fmt.Errorf("Failed to load: %v", err)
+				}
+				if err := content.FromStore(s); err != nil {
+					return fmt.Errorf("Failed to load: %v", err)
+				}
+			} else {
+				buf, err := ioutil.ReadFile(src)
+				if err != nil {
+					return fmt.Errorf("Failed to open store %s: %v", src, err)
+				}
+				if err := api.DecodeYaml(buf, content); err != nil {
+					return fmt.Errorf("Failed to unmarshal store content: %v", err)
+				}
+			}
+			tests, err := content.TemplateTests()
+			if err != nil {
+				return fmt.Errorf("Failed to load tests: %v", err)
+			}
+			if testsDir != "" {
+				if tests, err = api.ReadTemplateTests(testsDir); err != nil {
+					return err
+				}
+			}
+			delete(content.Sections, models.TemplateTestSection)
+			report, err := session.TestContent(content, tests)
+			if err != nil {
+				return generateError(err, "Failed to run template tests")
+			}
+			if err := prettyPrint(report); err != nil {
+				return err
+			}
+			if report.Failed > 0 {
+				return fmt.Errorf("%d of %d template tests failed", report.Failed, len(report.Results))
+			}
+			return nil
+		},
+	}
+	testCmd.Flags().StringVar(&testsDir, "tests", "", "Directory to read tests from instead of the tests in the bundle")
+	content.AddCommand(testCmd)
 	app.AddCommand(content)
 }
 
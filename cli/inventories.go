@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/agent"
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerInventory)
+}
+
+func registerInventory(app *cobra.Command) {
+	op := &ops{
+		name:       "inventories",
+		singleName: "inventory",
+		example:    func() models.Model { return &models.Inventory{} },
+	}
+	op.addCommand(&cobra.Command{
+		Use:   "gather",
+		Short: "Gather the hardware inventory of this system",
+		Long:  "Gather the hardware inventory of the system drpcli is running on and print it.",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("%v requires no arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			inv, err := agent.GatherInventory()
+			if err != nil {
+				return err
+			}
+			return prettyPrint(inv)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "submit [machine]",
+		Short: "Send the hardware inventory of this system for a machine",
+		Long:  "Gather the hardware inventory of the system drpcli is running on, and send it as the inventory of the machine.",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m := &models.Machine{}
+			if err := session.FillModel(m, args[0]); err != nil {
+				return generateError(err, "Failed to fetch machine %v", args[0])
+			}
+			inv, err := agent.GatherInventory()
+			if err != nil {
+				return err
+			}
+			if err := agent.SubmitInventory(session, m, inv); err != nil {
+				return generateError(err, "Failed to submit inventory for machine %v", args[0])
+			}
+			return prettyPrint(inv)
+		},
+	})
+	op.command(app)
+}
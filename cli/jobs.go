@@ -78,7 +78,8 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 	}
 	actionsCmd.Flags().StringVar(&actionsFor, "for-os", "", "OS to fetch actions for.  Defaults to fetching all actions")
 	op.addCommand(actionsCmd)
-	op.addCommand(&cobra.Command{
+	follow := false
+	logCmd := &cobra.Command{
 		Use:   "log [id] [- or string]",
 		Short: "Gets the log or appends to the log if a second argument or stream is given",
 		Args: func(c *cobra.Command, args []string) error {
@@ -92,6 +93,15 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 		},
 		RunE: func(c *cobra.Command, args []string) error {
 			uuid := args[0]
+			if follow {
+				if len(args) != 1 {
+					return fmt.Errorf("Cannot follow the log while appending to it")
+				}
+				if _, err := session.FollowJobLog(uuid, 0, os.Stdout); err != nil {
+					return generateError(err, "Error following log")
+				}
+				return nil
+			}
 			if len(args) == 1 {
 				if err := session.Req().UrlFor("jobs", uuid, "log").Do(os.Stdout); err != nil {
 					return generateError(err, "Error getting log")
@@ -109,6 +119,63 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 			}
 			return nil
 		},
+	}
+	logCmd.Flags().BoolVar(&follow, "follow", false, "Keep printing the log as it is written until the job is done")
+	op.addCommand(logCmd)
+	op.addCommand(&cobra.Command{
+		Use:   "artifacts [id]",
+		Short: "List the artifacts the job has uploaded",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res := []models.JobArtifact{}
+			if err := session.Req().UrlFor("jobs", args[0], "artifacts").Do(&res); err != nil {
+				return generateError(err, "Error listing artifacts")
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "artifact [id] [name] [- or file]",
+		Short: "Gets the named artifact, or uploads it if a file or stream is given",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("%v requires at least 2 arguments", c.UseLine())
+			}
+			if len(args) > 3 {
+				return fmt.Errorf("%v requires at most 3 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			uuid, name := args[0], args[1]
+			if len(args) == 2 {
+				if err := session.Req().UrlFor("jobs", uuid, "artifacts", name).Do(os.Stdout); err != nil {
+					return generateError(err, "Error getting artifact")
+				}
+				return nil
+			}
+			var src io.Reader
+			if args[2] == "-" {
+				src = os.Stdin
+			} else {
+				fi, err := os.Open(args[2])
+				if err != nil {
+					return fmt.Errorf("Error opening %s: %v", args[2], err)
+				}
+				defer fi.Close()
+				src = fi
+			}
+			res := &models.JobArtifact{}
+			if err := session.Req().Put(src).UrlFor("jobs", uuid, "artifacts", name).Do(res); err != nil {
+				return generateError(err, "Error uploading artifact")
+			}
+			return prettyPrint(res)
+		},
 	})
 	op.command(app)
 }
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"runtime"
@@ -178,7 +179,8 @@ func registerMachine(app *cobra.Command) {
 		},
 	})
 	op.addCommand(jobs)
-	op.addCommand(&cobra.Command{
+	followCurrent := false
+	currentLogCmd := &cobra.Command{
 		Use:   "currentlog [id]",
 		Short: "Get the log for the most recent job run on the machine",
 		Args: func(c *cobra.Command, args []string) error {
@@ -192,9 +194,208 @@ func registerMachine(app *cobra.Command) {
 			if err != nil {
 				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
 			}
-			return session.Req().UrlFor("jobs", m.(*models.Machine).CurrentJob.String(), "log").Do(os.Stdout)
+			if !followCurrent {
+				return session.Req().UrlFor("jobs", m.(*models.Machine).CurrentJob.String(), "log").Do(os.Stdout)
+			}
+			events, err := session.Events()
+			if err != nil {
+				return generateError(err, "Failed to open the event stream")
+			}
+			defer events.Close()
+			key := m.Key()
+			handle, ch, err := events.Register("machines.update."+key, "machines.save."+key)
+			if err != nil {
+				return generateError(err, "Failed to watch %v: %v", op.singleName, key)
+			}
+			defer events.Deregister(handle)
+			// Only the most recent CurrentJob matters, so keep just that
+			// while a log is being followed.
+			latest := make(chan string, 1)
+			go func() {
+				defer close(latest)
+				for evt := range ch {
+					machine := &models.Machine{}
+					if evt.Err != nil || models.Remarshal(evt.E.Object, machine) != nil {
+						continue
+					}
+					select {
+					case <-latest:
+					default:
+					}
+					latest <- machine.CurrentJob.String()
+				}
+			}()
+			// The machine may have moved on to another job before the
+			// events were registered.
+			if m, err = op.refOrFill(key); err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, key)
+			}
+			job, followed := m.(*models.Machine).CurrentJob.String(), ""
+			for {
+				if job != "" && job != followed {
+					if _, err := session.FollowJobLog(job, 0, os.Stdout); err != nil {
+						return generateError(err, "Error following log for job %s", job)
+					}
+					followed = job
+				}
+				var ok bool
+				if job, ok = <-latest; !ok {
+					return fmt.Errorf("Lost the event stream while following %v %v", op.singleName, key)
+				}
+			}
 		},
-	})
+	}
+	currentLogCmd.Flags().BoolVar(&followCurrent, "follow", false, "Keep printing the logs of the jobs the machine runs until interrupted")
+	op.addCommand(currentLogCmd)
+	renderBootEnv, renderStage, renderTask := "", "", ""
+	renderCmd := &cobra.Command{
+		Use:   "render [id]",
+		Short: "Render the templates for a machine without changing it",
+		Long: `Render the templates of a bootenv, stage, and task against the machine
+without saving anything.  The bootenv and stage default to the current ones
+for the machine, and the task is only rendered if one is specified.
+Every rendered file or job action is returned along with any missing
+param and template errors.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := []*models.RenderResult{}
+			if err := session.Req().UrlFor("machines", m.Key(), "render").
+				Params("bootenv", renderBootEnv, "stage", renderStage, "task", renderTask).
+				Do(&res); err != nil {
+				return generateError(err, "Failed to render %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	}
+	renderCmd.Flags().StringVar(&renderBootEnv, "bootenv", "", "BootEnv to render.  Defaults to the current one for the machine")
+	renderCmd.Flags().StringVar(&renderStage, "stage", "", "Stage to render.  Defaults to the current one for the machine")
+	renderCmd.Flags().StringVar(&renderTask, "task", "", "Task to render.  Defaults to none")
+	op.addCommand(renderCmd)
+	consoleSince, consoleUntil, consoleJob := "", "", ""
+	consoleCmd := &cobra.Command{
+		Use:   "console [id]",
+		Short: "Get the console output captured from the machine",
+		Long: `Print the console output captured from the machine over serial-over-LAN
+or netconsole, oldest first.  --since and --until take RFC3339 times to
+limit the output to, and --job limits it to the time that job was running.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := []models.ConsoleLine{}
+			if err := session.Req().UrlFor("machines", m.Key(), "console").
+				Params("since", consoleSince, "until", consoleUntil, "job", consoleJob).
+				Do(&res); err != nil {
+				return generateError(err, "Failed to get the console of %v: %v", op.singleName, args[0])
+			}
+			for _, line := range res {
+				fmt.Printf("%s %s: %s\n", line.Time.Format(time.RFC3339), line.Source, line.Line)
+			}
+			return nil
+		},
+	}
+	consoleCmd.Flags().StringVar(&consoleSince, "since", "", "Only print output received at or after this RFC3339 time")
+	consoleCmd.Flags().StringVar(&consoleUntil, "until", "", "Only print output received at or before this RFC3339 time")
+	consoleCmd.Flags().StringVar(&consoleJob, "job", "", "Only print output received while this job was running")
+	op.addCommand(consoleCmd)
+	coordScope, coordCount, coordTimeout := "", 1, 0
+	twoArgs := func(c *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("%v requires 2 arguments", c.UseLine())
+		}
+		return nil
+	}
+	barrierCmd := &cobra.Command{
+		Use:   "barrier [id] [name]",
+		Short: "Wait at a barrier until enough machines have arrived",
+		Long: `Have the machine arrive at the named barrier, and wait until --count
+machines in the same scope have arrived.  The scope defaults to the cluster
+in the cluster/name param of the machine, and can be set to profile:<name>
+to share the barrier between all the machines with that profile instead.`,
+		Args: twoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			if !c.Flags().Changed("count") || coordCount < 1 {
+				return fmt.Errorf("%v requires --count of at least 1", c.UseLine())
+			}
+			res := &models.Barrier{}
+			if err := session.Req().Meth("POST").UrlFor("machines", m.Key(), "barriers", args[1]).
+				Params("scope", coordScope, "count", strconv.Itoa(coordCount), "timeout", strconv.Itoa(coordTimeout)).
+				Do(res); err != nil {
+				return generateError(err, "Failed to wait at barrier %v", args[1])
+			}
+			return prettyPrint(res)
+		},
+	}
+	barrierCmd.Flags().StringVar(&coordScope, "scope", "", "Scope of the barrier.  Defaults to the cluster of the machine")
+	barrierCmd.Flags().IntVar(&coordCount, "count", 1, "Number of machines that must arrive at the barrier.  Required")
+	barrierCmd.Flags().IntVar(&coordTimeout, "timeout", 0, "Seconds to wait before giving up.  0 waits forever")
+	op.addCommand(barrierCmd)
+	lockCmd := &cobra.Command{
+		Use:   "lock [id] [name]",
+		Short: "Acquire a lock, waiting until it is free",
+		Long: `Have the machine acquire the named lock, waiting until fewer than
+--limit machines in the same scope hold it.  The scope works the same way
+as it does for barriers.  The lock is held until it is unlocked, a job on
+the machine fails, or the machine is deleted.`,
+		Args: twoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := &models.Lock{}
+			if err := session.Req().Meth("POST").UrlFor("machines", m.Key(), "locks", args[1]).
+				Params("scope", coordScope, "limit", strconv.Itoa(coordCount), "timeout", strconv.Itoa(coordTimeout)).
+				Do(res); err != nil {
+				return generateError(err, "Failed to acquire lock %v", args[1])
+			}
+			return prettyPrint(res)
+		},
+	}
+	lockCmd.Flags().StringVar(&coordScope, "scope", "", "Scope of the lock.  Defaults to the cluster of the machine")
+	lockCmd.Flags().IntVar(&coordCount, "limit", 1, "Number of machines that may hold the lock at once")
+	lockCmd.Flags().IntVar(&coordTimeout, "timeout", 0, "Seconds to wait before giving up.  0 waits forever")
+	op.addCommand(lockCmd)
+	unlockCmd := &cobra.Command{
+		Use:   "unlock [id] [name]",
+		Short: "Release a lock held by the machine",
+		Args:  twoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := &models.Lock{}
+			if err := session.Req().Del().UrlFor("machines", m.Key(), "locks", args[1]).
+				Params("scope", coordScope).
+				Do(res); err != nil {
+				return generateError(err, "Failed to release lock %v", args[1])
+			}
+			return prettyPrint(res)
+		},
+	}
+	unlockCmd.Flags().StringVar(&coordScope, "scope", "", "Scope of the lock.  Defaults to the cluster of the machine")
+	op.addCommand(unlockCmd)
 	op.addCommand(&cobra.Command{
 		Use:   "deletejobs [id]",
 		Short: "Delete all jobs associated with machine",
@@ -306,6 +507,11 @@ pass in more than one task.`,
 	var exitOnFailure = false
 	var oneShot = false
 	var runStateLoc string
+	var actionKey string
+	var requireSigned bool
+	var failGrace time.Duration
+	var heartbeatInterval time.Duration
+	var selfUpdate bool
 	processJobs := &cobra.Command{
 		Use:   "processjobs [id]",
 		Short: "For the given machine, process pending jobs until done.",
@@ -323,6 +529,20 @@ the stage runner wait flag.
 		},
 		RunE: func(c *cobra.Command, args []string) error {
 			uuid := args[0]
+			var pinned *[32]byte
+			if actionKey != "" {
+				buf, err := base64.StdEncoding.DecodeString(actionKey)
+				if err != nil || len(buf) != 32 {
+					return fmt.Errorf("Invalid action key %s", actionKey)
+				}
+				pinned = &[32]byte{}
+				copy(pinned[:], buf)
+			} else if requireSigned {
+				return fmt.Errorf("--require-signed-actions needs an --action-key to verify actions with")
+			}
+			if requireSigned && selfUpdate {
+				return fmt.Errorf("--self-update cannot be used with --require-signed-actions, as updates are not signed")
+			}
 			m := &models.Machine{}
 			if err := session.FillModel(m, uuid); err != nil {
 				return err
@@ -342,12 +562,17 @@ the stage runner wait flag.
 			if oneShot {
 				agent = agent.Timeout(time.Second)
 			}
-			return agent.StateLoc(runStateLoc).Run()
+			return agent.StateLoc(runStateLoc).ActionKey(pinned, requireSigned).FailGrace(failGrace).HeartbeatInterval(heartbeatInterval).SelfUpdate(selfUpdate).Run()
 		},
 	}
 	processJobs.Flags().BoolVar(&exitOnFailure, "exit-on-failure", false, "Exit on failure of a task")
 	processJobs.Flags().BoolVar(&oneShot, "oneshot", false, "Do not wait for additional tasks to appear")
 	processJobs.Flags().StringVar(&runStateLoc, "stateDir", "", "Location to save agent runtime state")
+	processJobs.Flags().StringVar(&actionKey, "action-key", "", "Base64 public key that job actions must be signed with")
+	processJobs.Flags().BoolVar(&requireSigned, "require-signed-actions", false, "Refuse to run job actions that are not signed")
+	processJobs.Flags().DurationVar(&failGrace, "fail-grace", time.Minute, "How long after the agent was last active to wait before failing an interrupted job")
+	processJobs.Flags().DurationVar(&heartbeatInterval, "heartbeat-interval", 30*time.Second, "How often to send a heartbeat to dr-provision.  0 turns heartbeats off")
+	processJobs.Flags().BoolVar(&selfUpdate, "self-update", false, "Update the agent to the version of dr-provision before processing jobs.  Not allowed with --require-signed-actions")
 	op.addCommand(processJobs)
 	op.command(app)
 }
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerSchedule)
+}
+
+func registerSchedule(app *cobra.Command) {
+	op := &ops{
+		name:       "schedules",
+		singleName: "schedule",
+		example:    func() models.Model { return &models.Schedule{} },
+	}
+	for _, cmd := range []struct {
+		use, short string
+		paused     bool
+	}{
+		{"pause", "Pause the schedule", true},
+		{"resume", "Resume the schedule", false},
+	} {
+		paused := cmd.paused
+		op.addCommand(&cobra.Command{
+			Use:   fmt.Sprintf("%s [id]", cmd.use),
+			Short: cmd.short,
+			Long:  fmt.Sprintf("Helper function to %s the schedule.", cmd.use),
+			Args: func(c *cobra.Command, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("%v requires 1 argument", c.UseLine())
+				}
+				return nil
+			},
+			RunE: func(c *cobra.Command, args []string) error {
+				s, err := op.refOrFill(args[0])
+				if err != nil {
+					return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+				}
+				clone := models.Clone(s).(*models.Schedule)
+				clone.Paused = paused
+				if err := session.Req().ParanoidPatch().PatchTo(s, clone).Do(&clone); err != nil {
+					return err
+				}
+				return prettyPrint(clone)
+			},
+		})
+	}
+	op.command(app)
+}
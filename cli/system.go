@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/base64"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -54,5 +55,27 @@ func addSystemCommands() (res *cobra.Command) {
 		},
 	})
 
+	res.AddCommand(&cobra.Command{
+		Use:   "actionkey",
+		Short: "Get the public key that job actions are signed with",
+		Long: `Get the base64 encoded public key that dr-provision signs job actions with.
+Pass it to the --action-key option of processjobs to have the agent
+verify the actions it runs.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return nil
+			}
+			return fmt.Errorf("%v takes no arguments", c.UseLine())
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			var key []byte
+			if err := session.Req().UrlFor("system", "actionkey").Do(&key); err != nil {
+				return generateError(err, "Failed to get the action key")
+			}
+			fmt.Println(base64.StdEncoding.EncodeToString(key))
+			return nil
+		},
+	})
+
 	return res
 }
@@ -38,6 +38,19 @@ type ContentBodyParameter struct {
 	Body *models.Content
 }
 
+// TemplateTestReportResponse returned on a successful test of a content
+// swagger:response
+type TemplateTestReportResponse struct {
+	// in: body
+	Body *models.TemplateTestReport
+}
+
+// swagger:parameters testContent
+type TemplateTestRunParameter struct {
+	// in: body
+	Body *models.TemplateTestRun
+}
+
 // swagger:parameters getContent deleteContent uploadContent
 type ContentParameter struct {
 	// in: path
@@ -45,6 +58,9 @@ type ContentParameter struct {
 }
 
 func (f *Frontend) buildNewStore(rt *backend.RequestTracker, content *models.Content) (newStore store.Store, err error) {
+	// Template tests are only used by drpcli contents test, so they
+	// are not loaded.
+	delete(content.Sections, models.TemplateTestSection)
 	// First, preprocess to secure all the params that should be secure.
 	paramCache := map[string]*models.Param{}
 	if len(content.Sections["params"]) > 0 {
@@ -305,6 +321,72 @@ func (f *Frontend) InitContentApi() {
 			}
 		})
 
+	// swagger:route POST /contents/test Contents testContent
+	//
+	// Run template tests against content
+	//
+	// The content is loaded into a scratch in-memory data stack
+	// with nothing else in it, and the tests are run against that.
+	// The content on the system is not changed.
+	//
+	//     Responses:
+	//       200: TemplateTestReportResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       415: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.POST("/contents/test",
+		func(c *gin.Context) {
+			run := &models.TemplateTestRun{}
+			if !assureDecode(c, run) {
+				return
+			}
+			res := &models.Error{
+				Model: "contents",
+				Type:  c.Request.Method,
+				Code:  http.StatusBadRequest,
+			}
+			if run.Content == nil {
+				res.Errorf("No content to test")
+				c.JSON(res.Code, res)
+				return
+			}
+			res.Key = run.Content.Meta.Name
+			rt := f.rt(c)
+			if !f.assureSimpleAuth(c, rt, "contents", "test", run.Content.AuthKey()) {
+				return
+			}
+			tests := run.Tests
+			if len(tests) == 0 {
+				var err error
+				if tests, err = run.Content.TemplateTests(); err != nil {
+					res.Errorf("Failed to load tests")
+					res.AddError(err)
+					c.JSON(res.Code, res)
+					return
+				}
+			}
+			delete(run.Content.Sections, models.TemplateTestSection)
+			s, _ := store.Open("memory:///")
+			defer s.Close()
+			if err := run.Content.ToStore(s); err != nil {
+				res.Errorf("Failed to load content")
+				res.AddError(err)
+				c.JSON(res.Code, res)
+				return
+			}
+			report, err := backend.RunTemplateTests(s, tests, f.Logger)
+			if err != nil {
+				res.Code = http.StatusInternalServerError
+				res.Errorf("Failed to load content for testing")
+				res.AddError(err)
+				c.JSON(res.Code, res)
+				return
+			}
+			c.JSON(http.StatusOK, report)
+		})
+
 	// swagger:route PUT /contents/{name} Contents uploadContent
 	//
 	// Replace content in Digital Rebar Provision
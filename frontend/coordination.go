@@ -0,0 +1,269 @@
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+)
+
+// BarrierResponse is returned when a Barrier releases the Machine waiting at it
+// swagger:response
+type BarrierResponse struct {
+	// in: body
+	Body *models.Barrier
+}
+
+// BarriersResponse is returned on a successful GET of all the Barriers
+// swagger:response
+type BarriersResponse struct {
+	// in: body
+	Body []*models.Barrier
+}
+
+// LockResponse is returned on a successful acquire or release of a Lock
+// swagger:response
+type LockResponse struct {
+	// in: body
+	Body *models.Lock
+}
+
+// LocksResponse is returned on a successful GET of all the Locks
+// swagger:response
+type LocksResponse struct {
+	// in: body
+	Body []*models.Lock
+}
+
+// CoordinationParameter is used to name a Barrier or Lock for a Machine
+// swagger:parameters waitMachineBarrier acquireMachineLock releaseMachineLock
+type CoordinationParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: path
+	// required: true
+	Name string `json:"name"`
+	// in: query
+	Scope string `json:"scope"`
+}
+
+// CoordinationWaitParameter is used to limit how long a Machine waits on a Barrier or Lock
+// swagger:parameters waitMachineBarrier acquireMachineLock
+type CoordinationWaitParameter struct {
+	// Count is the number of Machines that must arrive at a Barrier.
+	// It is required for Barriers and must be at least 1.
+	// in: query
+	Count int `json:"count"`
+	// in: query
+	Limit int `json:"limit"`
+	// in: query
+	Timeout int `json:"timeout"`
+}
+
+// coordinationContext returns a context for the request that is done
+// after the number of seconds in the timeout query parameter, or when
+// the client goes away if there is no timeout.
+func coordinationContext(c *gin.Context) (context.Context, context.CancelFunc, *models.Error) {
+	t := c.DefaultQuery("timeout", "0")
+	secs, err := strconv.Atoi(t)
+	if err != nil || secs < 0 {
+		res := &models.Error{Code: http.StatusBadRequest, Type: c.Request.Method}
+		res.Errorf("Invalid timeout %s", t)
+		return nil, nil, res
+	}
+	if secs == 0 {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(secs)*time.Second)
+	return ctx, cancel, nil
+}
+
+// queryCount returns the number in the name query parameter.  def is
+// used if it is missing, unless def is empty, in which case it must be
+// there and be at least 1.
+func queryCount(c *gin.Context, name, def string) (int, *models.Error) {
+	v, ok := c.GetQuery(name)
+	if !ok {
+		if def == "" {
+			be := &models.Error{Code: http.StatusBadRequest, Type: c.Request.Method}
+			be.Errorf("Missing %s", name)
+			return 0, be
+		}
+		v = def
+	}
+	res, err := strconv.Atoi(v)
+	if err != nil || (def == "" && res < 1) {
+		be := &models.Error{Code: http.StatusBadRequest, Type: c.Request.Method}
+		be.Errorf("Invalid %s %s", name, v)
+		return 0, be
+	}
+	return res, nil
+}
+
+func (f *Frontend) InitCoordinationApi() {
+	// swagger:route GET /barriers Machines listBarriers
+	//
+	// Lists the Barriers that Machines are waiting at
+	//
+	//     Responses:
+	//       200: BarriersResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	f.ApiGroup.GET("/barriers",
+		func(c *gin.Context) {
+			if !f.assureSimpleAuth(c, f.rt(c), "machines", "list", "") {
+				return
+			}
+			c.JSON(http.StatusOK, f.dt.Barriers())
+		})
+
+	// swagger:route GET /locks Machines listLocks
+	//
+	// Lists the Locks that Machines hold or are waiting on
+	//
+	//     Responses:
+	//       200: LocksResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	f.ApiGroup.GET("/locks",
+		func(c *gin.Context) {
+			if !f.assureSimpleAuth(c, f.rt(c), "machines", "list", "") {
+				return
+			}
+			c.JSON(http.StatusOK, f.dt.Locks())
+		})
+
+	coordinate := func(c *gin.Context) *backend.RequestTracker {
+		rt := f.rt(c, "machines", "profiles", "params")
+		var key string
+		rt.Do(func(d backend.Stores) {
+			if m := rt.Find("machines", c.Param(`uuid`)); m != nil {
+				key = backend.AsMachine(m).AuthKey()
+			}
+		})
+		if !f.assureSimpleAuth(c, rt, "machines", "coordinate", key) {
+			return nil
+		}
+		return rt
+	}
+
+	// swagger:route POST /machines/{uuid}/barriers/{name} Machines waitMachineBarrier
+	//
+	// Wait at a Barrier
+	//
+	// The Machine specified by {uuid} arrives at the Barrier {name},
+	// and the request does not return until count Machines in the
+	// same scope have arrived.  If timeout seconds pass first, the
+	// Machine leaves the Barrier again and a 408 is returned.
+	//
+	//     Responses:
+	//       200: BarrierResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       408: ErrorResponse
+	//       409: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/barriers/:name",
+		func(c *gin.Context) {
+			rt := coordinate(c)
+			if rt == nil {
+				return
+			}
+			count, be := queryCount(c, "count", "")
+			if be != nil {
+				c.JSON(be.Code, be)
+				return
+			}
+			ctx, cancel, be := coordinationContext(c)
+			if be != nil {
+				c.JSON(be.Code, be)
+				return
+			}
+			defer cancel()
+			res, err := rt.WaitBarrier(ctx, c.Param(`uuid`), c.Query("scope"), c.Param(`name`), count)
+			if err != nil {
+				be := err.(*models.Error)
+				c.JSON(be.Code, be)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route POST /machines/{uuid}/locks/{name} Machines acquireMachineLock
+	//
+	// Acquire a Lock
+	//
+	// The Machine specified by {uuid} takes the Lock {name}, waiting
+	// until fewer than limit Machines in the same scope hold it.  If
+	// timeout seconds pass first, a 408 is returned.
+	//
+	//     Responses:
+	//       200: LockResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       408: ErrorResponse
+	//       409: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/locks/:name",
+		func(c *gin.Context) {
+			rt := coordinate(c)
+			if rt == nil {
+				return
+			}
+			limit, be := queryCount(c, "limit", "1")
+			if be != nil {
+				c.JSON(be.Code, be)
+				return
+			}
+			ctx, cancel, be := coordinationContext(c)
+			if be != nil {
+				c.JSON(be.Code, be)
+				return
+			}
+			defer cancel()
+			res, err := rt.AcquireLock(ctx, c.Param(`uuid`), c.Query("scope"), c.Param(`name`), limit)
+			if err != nil {
+				be := err.(*models.Error)
+				c.JSON(be.Code, be)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route DELETE /machines/{uuid}/locks/{name} Machines releaseMachineLock
+	//
+	// Release a Lock
+	//
+	// The Machine specified by {uuid} gives up the Lock {name}.
+	//
+	//     Responses:
+	//       200: LockResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.DELETE("/machines/:uuid/locks/:name",
+		func(c *gin.Context) {
+			rt := coordinate(c)
+			if rt == nil {
+				return
+			}
+			res, err := rt.ReleaseLock(c.Param(`uuid`), c.Query("scope"), c.Param(`name`))
+			if err != nil {
+				be := err.(*models.Error)
+				c.JSON(be.Code, be)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+}
@@ -165,6 +165,7 @@ type Frontend struct {
 	authSource AuthSource
 	pubs       *backend.Publishers
 	melody     *melody.Melody
+	logMelody  *melody.Melody
 	SaasDir    string
 	info       *models.Info
 }
@@ -631,6 +632,7 @@ func NewFrontend(
 	me.InitFileApi()
 	me.InitTemplateApi()
 	me.InitMachineApi()
+	me.InitCoordinationApi()
 	me.InitProfileApi()
 	me.InitLeaseApi()
 	me.InitReservationApi()
@@ -649,6 +651,9 @@ func NewFrontend(
 	me.InitEventApi()
 	me.InitContentApi()
 	me.InitTenantApi()
+	me.InitScheduleApi()
+	me.InitRolloutApi()
+	me.InitInventoryApi()
 	me.InitSystemApi()
 	me.InitObjectsApi()
 
@@ -799,65 +804,6 @@ func assureDecode(c *gin.Context, val interface{}) bool {
 	return false
 }
 
-// This processes the value into a function, if function not specified, assume Eq.
-// Supported Forms:
-//
-//   Eq(value)
-//   Lt(value)
-//   Lte(value)
-//   Gt(value)
-//   Gte(value)
-//   Ne(value)
-//   Between(valueLower, valueHigher)
-//   Except(valueLower, valueHigher)
-//
-func convertValueToFilter(v string) (index.Filter, error) {
-
-	args := strings.SplitN(v, "(", 2)
-	if len(args) == 1 || args[1] == "" || !strings.HasSuffix(args[1], ")") {
-		return index.Eq(v), nil
-	}
-	subargs := strings.TrimSuffix(args[1], ")")
-	switch args[0] {
-	case "Eq":
-		return index.Eq(subargs), nil
-	case "Re":
-		return index.Re(subargs), nil
-	case "Lt":
-		return index.Lt(subargs), nil
-	case "Lte":
-		return index.Lte(subargs), nil
-	case "Gt":
-		return index.Gt(subargs), nil
-	case "Gte":
-		return index.Gte(subargs), nil
-	case "Ne":
-		return index.Ne(subargs), nil
-	case "Between":
-		parts := strings.Split(subargs, ",")
-		return index.Between(parts[0], parts[1]), nil
-	case "Except":
-		parts := strings.Split(subargs, ",")
-		return index.Except(parts[0], parts[1]), nil
-	case "In":
-		parts := strings.Split(subargs, ",")
-		subf := make([]index.Filter, len(parts))
-		for i := range parts {
-			subf[i] = index.Eq(parts[i])
-		}
-		return index.Uniq(index.Any(subf...)), nil
-	case "Nin":
-		parts := strings.Split(subargs, ",")
-		subf := make([]index.Filter, len(parts))
-		for i := range parts {
-			subf[i] = index.Ne(parts[i])
-		}
-		return index.Uniq(index.All(subf...)), nil
-	default:
-		return index.Eq(v), nil
-	}
-}
-
 type dynParameter interface {
 	ParameterMaker(*backend.RequestTracker, string) (index.Maker, error)
 }
@@ -973,7 +919,7 @@ func (f *Frontend) processFilters(rt *backend.RequestTracker, d backend.Stores,
 			filters = append(filters, index.Use(maker))
 			subfilters := []index.Filter{}
 			for _, v := range vs {
-				f, err := convertValueToFilter(v)
+				f, err := index.ParseFilter(v)
 				if err != nil {
 					return nil, err
 				}
@@ -1048,6 +994,7 @@ func (f *Frontend) processItem(c *gin.Context, rt *backend.RequestTracker, obj m
 	if f, ok := obj.(models.Filler); ok {
 		f.Fill()
 	}
+	rt.MergeHeartbeat(obj)
 	if d, ok := obj.(models.Paramer); ok {
 		if f.wantDecodeSecure(c) {
 			tp := rt.GetParams(d, false, true)
@@ -0,0 +1,377 @@
+package frontend
+
+import (
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+)
+
+// InventoryResponse returned on a successful GET, PUT, PATCH, or POST of a single inventory
+// swagger:response
+type InventoryResponse struct {
+	// in: body
+	Body *models.Inventory
+}
+
+// InventoriesResponse returned on a successful GET of all the inventories
+// swagger:response
+type InventoriesResponse struct {
+	//in: body
+	Body []*models.Inventory
+}
+
+// InventoryBodyParameter used to inject an Inventory
+// swagger:parameters createInventory putInventory
+type InventoryBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.Inventory
+}
+
+// InventoryPatchBodyParameter used to patch an Inventory
+// swagger:parameters patchInventory
+type InventoryPatchBodyParameter struct {
+	// in: body
+	// required: true
+	Body jsonpatch2.Patch
+}
+
+// InventoryPathParameter used to find an Inventory in the path
+// swagger:parameters putInventories getInventory putInventory patchInventory deleteInventory headInventory
+type InventoryPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+}
+
+// InventoryListPathParameter used to limit lists of Inventory by path options
+// swagger:parameters listInventories listStatsInventories
+type InventoryListPathParameter struct {
+	// in: query
+	Offest int `json:"offset"`
+	// in: query
+	Limit int `json:"limit"`
+	// in: query
+	Available string
+	// in: query
+	Valid string
+	// in: query
+	ReadOnly string
+	// in: query
+	Machine string
+	// in: query
+	Manufacturer string
+	// in: query
+	ProductName string
+	// in: query
+	SerialNumber string
+	// in: query
+	BIOSVersion string
+	// in: query
+	CPUModel string
+	// in: query
+	Cores string
+	// in: query
+	Memory string
+	// in: query
+	MACs string
+}
+
+// InventoryActionsPathParameter used to find an Inventory / Actions in the path
+// swagger:parameters getInventoryActions
+type InventoryActionsPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: query
+	Plugin string `json:"plugin"`
+}
+
+// InventoryActionPathParameter used to find an Inventory / Action in the path
+// swagger:parameters getInventoryAction
+type InventoryActionPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: path
+	// required: true
+	Cmd string `json:"cmd"`
+	// in: query
+	Plugin string `json:"plugin"`
+}
+
+// InventoryActionBodyParameter used to post an Inventory / Action in the path
+// swagger:parameters postInventoryAction
+type InventoryActionBodyParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: path
+	// required: true
+	Cmd string `json:"cmd"`
+	// in: query
+	Plugin string `json:"plugin"`
+	// in: body
+	// required: true
+	Body map[string]interface{}
+}
+
+func (f *Frontend) InitInventoryApi() {
+	// swagger:route GET /inventories Inventories listInventories
+	//
+	// Lists Inventories filtered by some parameters.
+	//
+	// This will show all Inventories by default.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//
+	// Functional Indexs:
+	//    Machine = UUID string
+	//    Manufacturer = string
+	//    ProductName = string
+	//    SerialNumber = string
+	//    BIOSVersion = string
+	//    CPUModel = string
+	//    Cores = integer
+	//    Memory = integer
+	//    MACs = list
+	//    Available = boolean
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    Manufacturer=Dell - returns the inventories of machines made by Dell
+	//    Cores=Gte(16) - returns the inventories of machines with at least 16 cores
+	//    MACs=52:54:00:12:34:56 - returns the inventory with a NIC that has that MAC address
+	//
+	// Responses:
+	//    200: InventoriesResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.GET("/inventories",
+		func(c *gin.Context) {
+			f.List(c, &backend.Inventory{})
+		})
+
+	// swagger:route HEAD /inventories Inventories listStatsInventories
+	//
+	// Stats of the List Inventories filtered by some parameters.
+	//
+	// This will return headers with the stats of the list.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//
+	// Functional Indexs:
+	//    Machine = UUID string
+	//    Manufacturer = string
+	//    ProductName = string
+	//    SerialNumber = string
+	//    BIOSVersion = string
+	//    CPUModel = string
+	//    Cores = integer
+	//    Memory = integer
+	//    MACs = list
+	//    Available = boolean
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    Manufacturer=Dell - returns the inventories of machines made by Dell
+	//    Cores=Gte(16) - returns the inventories of machines with at least 16 cores
+	//    MACs=52:54:00:12:34:56 - returns the inventory with a NIC that has that MAC address
+	//
+	// Responses:
+	//    200: NoContentResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.HEAD("/inventories",
+		func(c *gin.Context) {
+			f.ListStats(c, &backend.Inventory{})
+		})
+
+	// swagger:route POST /inventories Inventories createInventory
+	//
+	// Create an Inventory
+	//
+	// Create an Inventory from the provided object
+	//
+	//     Responses:
+	//       201: InventoryResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/inventories",
+		func(c *gin.Context) {
+			b := &backend.Inventory{}
+			f.Create(c, b)
+		})
+	// swagger:route GET /inventories/{uuid} Inventories getInventory
+	//
+	// Get an Inventory
+	//
+	// Get the Inventory specified by {uuid} or return NotFound.
+	//
+	//     Responses:
+	//       200: InventoryResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/inventories/:uuid",
+		func(c *gin.Context) {
+			f.Fetch(c, &backend.Inventory{}, c.Param(`uuid`))
+		})
+
+	// swagger:route HEAD /inventories/{uuid} Inventories headInventory
+	//
+	// See if an Inventory exists
+	//
+	// Return 200 if the Inventory specifiec by {uuid} exists, or return NotFound.
+	//
+	//     Responses:
+	//       200: NoContentResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: NoContentResponse
+	f.ApiGroup.HEAD("/inventories/:uuid",
+		func(c *gin.Context) {
+			f.Exists(c, &backend.Inventory{}, c.Param(`uuid`))
+		})
+
+	// swagger:route PATCH /inventories/{uuid} Inventories patchInventory
+	//
+	// Patch an Inventory
+	//
+	// Update an Inventory specified by {uuid} using a RFC6902 Patch structure
+	//
+	//     Responses:
+	//       200: InventoryResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       406: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PATCH("/inventories/:uuid",
+		func(c *gin.Context) {
+			f.Patch(c, &backend.Inventory{}, c.Param(`uuid`))
+		})
+
+	// swagger:route PUT /inventories/{uuid} Inventories putInventory
+	//
+	// Put an Inventory
+	//
+	// Update an Inventory specified by {uuid} using a JSON Inventory
+	//
+	//     Responses:
+	//       200: InventoryResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PUT("/inventories/:uuid",
+		func(c *gin.Context) {
+			f.Update(c, &backend.Inventory{}, c.Param(`uuid`))
+		})
+
+	// swagger:route DELETE /inventories/{uuid} Inventories deleteInventory
+	//
+	// Delete an Inventory
+	//
+	// Delete an Inventory specified by {uuid}
+	//
+	//     Responses:
+	//       200: InventoryResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.DELETE("/inventories/:uuid",
+		func(c *gin.Context) {
+			f.Remove(c, &backend.Inventory{}, c.Param(`uuid`))
+		})
+
+	inventory := &backend.Inventory{}
+	pActions, pAction, pRun := f.makeActionEndpoints(inventory.Prefix(), inventory, "uuid")
+
+	// swagger:route GET /inventories/{uuid}/actions Inventories getInventoryActions
+	//
+	// List inventory actions Inventory
+	//
+	// List Inventory actions for an Inventory specified by {uuid}
+	//
+	// Optionally, a query parameter can be used to limit the scope to a specific plugin.
+	//   e.g. ?plugin=fred
+	//
+	//     Responses:
+	//       200: ActionsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/inventories/:uuid/actions", pActions)
+
+	// swagger:route GET /inventories/{uuid}/actions/{cmd} Inventories getInventoryAction
+	//
+	// List specific action for a inventory Inventory
+	//
+	// List specific {cmd} action for an Inventory specified by {uuid}
+	//
+	// Optionally, a query parameter can be used to limit the scope to a specific plugin.
+	//   e.g. ?plugin=fred
+	//
+	//     Responses:
+	//       200: ActionResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/inventories/:uuid/actions/:cmd", pAction)
+
+	// swagger:route POST /inventories/{uuid}/actions/{cmd} Inventories postInventoryAction
+	//
+	// Call an action on the node.
+	//
+	// Optionally, a query parameter can be used to limit the scope to a specific plugin.
+	//   e.g. ?plugin=fred
+	//
+	//
+	//     Responses:
+	//       400: ErrorResponse
+	//       200: ActionPostResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	f.ApiGroup.POST("/inventories/:uuid/actions/:cmd", pRun)
+}
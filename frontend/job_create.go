@@ -218,6 +218,7 @@ func realCreateJob(f *Frontend,
 	// Figure out what task to run next.  This is almost always the same as the current
 	// task
 	taskToRun := m.CurrentTask
+	attempt := 1
 	if cj.CurrentIndex != m.CurrentTask {
 		if !(cj.State == "finished" || cj.State == "failed") {
 			rt.Infof("Machine %s Task list has been reset to %d from %d, failing current job %s",
@@ -244,8 +245,28 @@ func realCreateJob(f *Frontend,
 			rt.Infof("Machine %s task %s at %d is finished, advancing to %d",
 				cj.Machine.String(), cj.Task, m.CurrentTask, taskToRun)
 		case "failed":
-			rt.Infof("Machine %s task %s at %d is failed, retrying",
-				cj.Machine.String(), cj.Task, m.CurrentTask)
+			to := rt.Find("tasks", cj.Task)
+			if to == nil || !backend.AsTask(to).ShouldRetry(cj.Job) {
+				rt.Infof("Machine %s task %s at %d is failed, retrying",
+					cj.Machine.String(), cj.Task, m.CurrentTask)
+				break
+			}
+			// The Task's RetryPolicy wants this retried, but it may
+			// need to back off first.
+			retryAt := cj.EndTime.Add(backend.AsTask(to).RetryDelay(cj.Job))
+			if time.Now().Before(retryAt) {
+				err.Code = http.StatusConflict
+				err.Type = "Conflict"
+				err.Messages = []string{fmt.Sprintf("Machine %s cannot retry task %s until %s",
+					b.Machine.String(), cj.Task, retryAt.Format(time.RFC3339))}
+				return nil, nil
+			}
+			attempt = cj.Attempt + 1
+			if cj.Attempt < 1 {
+				attempt = 2
+			}
+			rt.Infof("Machine %s task %s at %d is failed, starting attempt %d",
+				cj.Machine.String(), cj.Task, m.CurrentTask, attempt)
 		default:
 			rt.Warnf("Machine %s task %s at %d is %s, conflict",
 				cj.Machine.String(), cj.Task, m.CurrentTask, cj.State)
@@ -269,7 +290,9 @@ func realCreateJob(f *Frontend,
 	// Check for stage and bootenv changes.
 	// These generate fake server side job logs as needed, and any stage or bootenv changes
 	// are gathered to be committed all at once.
-	for ; taskToRun < len(m.Tasks) && strings.Contains(m.Tasks[taskToRun], ":"); taskToRun++ {
+	for ; taskToRun < len(m.Tasks) &&
+		strings.Contains(m.Tasks[taskToRun], ":") &&
+		models.ParallelTasks(m.Tasks[taskToRun]) == nil; taskToRun++ {
 		rt.Infof("Machine %s ([%d]%s)is checking to see if it needs to change stage",
 			b.Machine.String(),
 			taskToRun,
@@ -353,6 +376,40 @@ func realCreateJob(f *Frontend,
 	b.NextIndex = m.CurrentTask + 1
 	b.Task = m.Tasks[m.CurrentTask]
 	b.State = "created"
+	b.Attempt = attempt
 	saveMachineAndCreateJob(rt, m, b, err)
+	if !err.ContainsError() {
+		createGroupJobs(rt, b, err)
+	}
 	return b, nil
 }
+
+// createGroupJobs creates a Job for each of the Tasks in a parallel
+// task group.  The agent runs them all at once, and reports the
+// result for the group in the group's Job.
+func createGroupJobs(rt *backend.RequestTracker, b *backend.Job, ret *models.Error) {
+	for _, name := range models.ParallelTasks(b.Task) {
+		nb := backend.ModelToBackend(&models.Job{}).(*backend.Job)
+		nb.Fill()
+		nb.Uuid = uuid.NewRandom()
+		nb.StartTime = time.Now()
+		nb.Previous = b.Previous
+		nb.Parent = b.Uuid
+		nb.Machine = b.Machine
+		nb.Stage = b.Stage
+		nb.BootEnv = b.BootEnv
+		nb.Workflow = b.Workflow
+		nb.CurrentIndex = b.CurrentIndex
+		nb.NextIndex = b.NextIndex
+		nb.Task = name
+		nb.State = "created"
+		// The group's Job is the current one for the Machine.
+		nb.Current = false
+		if _, err := rt.Create(nb); err != nil {
+			ret.Code = http.StatusInternalServerError
+			ret.AddError(err)
+			return
+		}
+		rt.Infof("Created job %s for task %s in group %s", nb.UUID(), name, b.UUID())
+	}
+}
@@ -2,7 +2,9 @@ package frontend
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/digitalrebar/provision/backend"
@@ -79,8 +81,50 @@ type JobLogPutBodyParameter struct {
 	Body interface{}
 }
 
+// JobArtifactsResponse returned on a successful GET of the artifacts of a Job
+// swagger:response
+type JobArtifactsResponse struct {
+	// in: body
+	Body []models.JobArtifact
+}
+
+// JobArtifactResponse returned on a successful PUT of an artifact of a Job
+// swagger:response
+type JobArtifactResponse struct {
+	// in: body
+	Body *models.JobArtifact
+}
+
+// JobArtifactDataResponse returned on a successful GET of an artifact of a Job
+// swagger:response
+type JobArtifactDataResponse struct {
+	// in: body
+	// format: binary
+	Body string
+}
+
+// JobArtifactPathParameter used to find an artifact of a Job in the path
+// swagger:parameters getJobArtifact putJobArtifact
+type JobArtifactPathParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: path
+	// required: true
+	Name string `json:"name"`
+}
+
+// JobArtifactBodyParameter used to upload an artifact of a Job
+// swagger:parameters putJobArtifact
+type JobArtifactBodyParameter struct {
+	// in: body
+	// required: true
+	Body interface{}
+}
+
 // JobPathParameter used to find a Job in the path
-// swagger:parameters putJobs getJob putJob patchJob deleteJob getJobParams postJobParams getJobActions getJobLog putJobLog headJob
+// swagger:parameters putJobs getJob putJob patchJob deleteJob getJobParams postJobParams getJobActions getJobLog putJobLog headJob getJobArtifacts getJobMembers
 type JobPathParameter struct {
 	// in: path
 	// required: true
@@ -138,6 +182,8 @@ type JobActionsPathParameter struct {
 	Plugin string `json:"plugin"`
 	// in: query
 	OS string `json:"os"`
+	// in: query
+	Signed string `json:"signed"`
 }
 
 // JobActionPathParameter used to find a Job / Action in the path
@@ -177,7 +223,6 @@ func logRead(f *Frontend) func(*gin.Context) {
 		j := &backend.Job{}
 		var bad bool
 		var err *models.Error
-		var path string
 		rt := f.rt(c, j.Locks("get")...)
 		rt.Do(func(d backend.Stores) {
 			var jo models.Model
@@ -188,7 +233,6 @@ func logRead(f *Frontend) func(*gin.Context) {
 				return
 			}
 			j = backend.AsJob(jo)
-			path = j.LogPath(rt)
 		})
 		if bad {
 			c.JSON(err.Code, err)
@@ -197,9 +241,58 @@ func logRead(f *Frontend) func(*gin.Context) {
 		if !f.assureSimpleAuth(c, rt, "jobs", "log", j.AuthKey()) {
 			return
 		}
+		src, openErr := j.OpenLog(rt)
+		if openErr != nil {
+			jobFileError(c, openErr)
+			return
+		}
+		defer src.Close()
 		c.Writer.Header().Set("Content-Type", "application/octet-stream")
-		c.File(path)
+		c.Status(http.StatusOK)
+		if c.Request.Method != "HEAD" {
+			io.Copy(c.Writer, src)
+		}
+	}
+}
+
+// logJob finds the Job in the path that the caller may read the log
+// and use the artifacts of.  If it returns nil, the error has already
+// been sent.
+func logJob(f *Frontend, c *gin.Context) (*backend.Job, *backend.RequestTracker) {
+	uuid := c.Param(`uuid`)
+	var j *backend.Job
+	rt := f.rt(c, (&backend.Job{}).Locks("get")...)
+	rt.Do(func(d backend.Stores) {
+		if jo := rt.Find("jobs", uuid); jo != nil {
+			j = backend.AsJob(jo)
+		}
+	})
+	if j == nil {
+		err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+			Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+		c.JSON(err.Code, err)
+		return nil, nil
+	}
+	if !f.assureSimpleAuth(c, rt, "jobs", "log", j.AuthKey()) {
+		return nil, nil
 	}
+	return j, rt
+}
+
+// jobFileError sends err from reading or writing the log or the
+// artifacts of a Job.
+func jobFileError(c *gin.Context, err error) {
+	if e, ok := err.(*models.Error); ok {
+		c.JSON(e.Code, e)
+		return
+	}
+	code := http.StatusInternalServerError
+	if os.IsNotExist(err) {
+		code = http.StatusNotFound
+	}
+	e := &models.Error{Code: code, Type: "Server ERROR",
+		Messages: []string{err.Error()}}
+	c.JSON(e.Code, e)
 }
 
 func (f *Frontend) InitJobApi() {
@@ -446,12 +539,52 @@ func (f *Frontend) InitJobApi() {
 			f.Remove(c, &backend.Job{}, c.Param(`uuid`))
 		})
 
+	// swagger:route GET /jobs/{uuid}/members Jobs getJobMembers
+	//
+	// List the members of a parallel task group
+	//
+	// List the Jobs that run the Tasks of the parallel task group
+	// whose Job is specified by {uuid}.  Anything that may get the
+	// group's Job may list them.
+	//
+	//     Responses:
+	//       200: JobsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/members",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			var j *backend.Job
+			rt := f.rt(c, (&backend.Job{}).Locks("get")...)
+			rt.Do(func(d backend.Stores) {
+				if jo := rt.Find("jobs", uuid); jo != nil {
+					j = backend.AsJob(jo)
+				}
+			})
+			if j == nil {
+				err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+					Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+				c.JSON(err.Code, err)
+				return
+			}
+			if !f.assureSimpleAuth(c, rt, "jobs", "get", j.AuthKey()) {
+				return
+			}
+			var res []*models.Job
+			rt.Do(func(d backend.Stores) { res = j.Members(rt) })
+			c.JSON(http.StatusOK, res)
+		})
+
 	// swagger:route GET /jobs/{uuid}/actions Jobs getJobActions
 	//
 	// Get actions for this job
 	//
 	// Get actions for the Job specified by {uuid} or return NotFound.
 	//
+	// If signed is true, each action is signed with the action key
+	// of the server.
+	//
 	//     Responses:
 	//       200: JobActionsResponse
 	//       400: ErrorResponse
@@ -496,6 +629,13 @@ func (f *Frontend) InitJobApi() {
 				}
 				return
 			}
+			if c.Query("signed") == "true" {
+				if err := j.SignActions(rt, actions); err != nil {
+					c.JSON(http.StatusInternalServerError,
+						models.NewError("Server ERROR", http.StatusInternalServerError, err.Error()))
+					return
+				}
+			}
 			c.JSON(http.StatusOK, actions)
 
 		})
@@ -614,6 +754,113 @@ func (f *Frontend) InitJobApi() {
 			}
 		})
 
+	// swagger:route GET /jobs/{uuid}/artifacts Jobs getJobArtifacts
+	//
+	// List the artifacts of this job
+	//
+	// List the artifacts uploaded by the Job specified by {uuid},
+	// or return NotFound.
+	//
+	//     Responses:
+	//       200: JobArtifactsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/artifacts",
+		func(c *gin.Context) {
+			j, rt := logJob(f, c)
+			if j == nil {
+				return
+			}
+			res, err := j.Artifacts(rt)
+			if err != nil {
+				jobFileError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route GET /jobs/{uuid}/artifacts/{name} Jobs getJobArtifact
+	//
+	// Get an artifact of this job
+	//
+	// Get the artifact {name} of the Job specified by {uuid} or
+	// return NotFound.
+	//
+	//     Produces:
+	//       application/octet-stream
+	//       application/json
+	//
+	//     Responses:
+	//       200: JobArtifactDataResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/artifacts/:name",
+		func(c *gin.Context) {
+			j, rt := logJob(f, c)
+			if j == nil {
+				return
+			}
+			path, err := j.ArtifactFile(rt, c.Param(`name`))
+			if err != nil {
+				jobFileError(c, err)
+				return
+			}
+			c.Writer.Header().Set("Content-Type", "application/octet-stream")
+			c.File(path)
+		})
+
+	// swagger:route PUT /jobs/{uuid}/artifacts/{name} Jobs putJobArtifact
+	//
+	// Upload an artifact of this job
+	//
+	// Store the body as the artifact {name} of the Job specified by
+	// {uuid}, replacing any artifact that already has that name.
+	//
+	//     Consumes:
+	//       application/octet-stream
+	//
+	//     Produces:
+	//       application/json
+	//
+	//     Responses:
+	//       200: JobArtifactResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       413: ErrorResponse
+	//       415: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.PUT("/jobs/:uuid/artifacts/:name",
+		func(c *gin.Context) {
+			if c.Request.Body == nil {
+				err := &models.Error{Code: http.StatusBadRequest}
+				c.JSON(err.Code, err)
+				return
+			}
+			defer c.Request.Body.Close()
+			if c.Request.Header.Get(`Content-Type`) != `application/octet-stream` {
+				c.JSON(http.StatusUnsupportedMediaType,
+					models.NewError("API ERROR", http.StatusUnsupportedMediaType,
+						"job artifact put must have content-type application/octet-stream"))
+				return
+			}
+			j, rt := logJob(f, c)
+			if j == nil {
+				return
+			}
+			res, err := j.PutArtifact(rt, c.Param(`name`), c.Request.Body)
+			if err != nil {
+				jobFileError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
 	job := &backend.Job{}
 	pActions, pAction, pRun := f.makeActionEndpoints(job.Prefix(), job, "uuid")
 
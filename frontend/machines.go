@@ -1,6 +1,10 @@
 package frontend
 
 import (
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/digitalrebar/provision/backend"
 	"github.com/digitalrebar/provision/models"
@@ -181,6 +185,74 @@ type MachineActionBodyParameter struct {
 	Body map[string]interface{}
 }
 
+// MachineRenderResponse is returned on a successful dry-run render of a Machine
+// swagger:response
+type MachineRenderResponse struct {
+	// in: body
+	Body []*models.RenderResult
+}
+
+// MachineHeartbeatParameter used to send a heartbeat from the agent on a Machine
+// swagger:parameters postMachineHeartbeat
+type MachineHeartbeatParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: body
+	// required: true
+	Body *models.AgentHeartbeat
+}
+
+// MachineInventoryParameter used to send the Inventory gathered by the agent on a Machine
+// swagger:parameters postMachineInventory
+type MachineInventoryParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: body
+	// required: true
+	Body *models.Inventory
+}
+
+// MachineConsoleParameter used to pick the console output of a Machine to get
+// swagger:parameters getMachineConsole
+type MachineConsoleParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: query
+	Since string `json:"since"`
+	// in: query
+	Until string `json:"until"`
+	// in: query
+	Job string `json:"job"`
+}
+
+// MachineConsoleResponse is returned on a successful GET of the console output of a Machine
+// swagger:response
+type MachineConsoleResponse struct {
+	// in: body
+	Body []models.ConsoleLine
+}
+
+// MachineRenderParameter used to pick what to render for a Machine
+// swagger:parameters getMachineRender
+type MachineRenderParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: query
+	BootEnv string `json:"bootenv"`
+	// in: query
+	Stage string `json:"stage"`
+	// in: query
+	Task string `json:"task"`
+}
+
 // MachineListPathParameter used to limit lists of Machine by path options
 // swagger:parameters listMachines listStatsMachines
 type MachineListPathParameter struct {
@@ -212,6 +284,52 @@ type MachineListPathParameter struct {
 	Params bool `json:"params"`
 }
 
+// machinePost handles a POST of val to a subresource of the Machine
+// in the uuid path parameter.  It decodes the body into val, checks
+// that the caller may perform action on the Machine, and sends back
+// what submit returns when it is called on the Machine with locks
+// held.
+func (f *Frontend) machinePost(c *gin.Context, action string, val interface{}, locks []string,
+	submit func(*backend.RequestTracker, *backend.Machine) (interface{}, error)) {
+	if !assureDecode(c, val) {
+		return
+	}
+	rt := f.rt(c, locks...)
+	var key string
+	rt.Do(func(d backend.Stores) {
+		if m := rt.Find("machines", c.Param(`uuid`)); m != nil {
+			key = backend.AsMachine(m).AuthKey()
+		}
+	})
+	if !f.assureSimpleAuth(c, rt, "machines", action, key) {
+		return
+	}
+	var res interface{}
+	var err error
+	found := false
+	rt.Do(func(d backend.Stores) {
+		if m := rt.Find("machines", c.Param(`uuid`)); m != nil {
+			found = true
+			res, err = submit(rt, backend.AsMachine(m))
+		}
+	})
+	if !found {
+		err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+			Messages: []string{fmt.Sprintf("Machine %s does not exist", c.Param(`uuid`))}}
+		c.JSON(err.Code, err)
+		return
+	}
+	if err != nil {
+		be, ok := err.(*models.Error)
+		if !ok {
+			be = models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error())
+		}
+		c.JSON(be.Code, be)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
 func (f *Frontend) InitMachineApi() {
 	// swagger:route GET /machines Machines listMachines
 	//
@@ -575,4 +693,174 @@ func (f *Frontend) InitMachineApi() {
 	//       409: ErrorResponse
 	f.ApiGroup.POST("/machines/:uuid/actions/:cmd", pRun)
 
+	// swagger:route GET /machines/{uuid}/render Machines getMachineRender
+	//
+	// Dry-run the templates for a Machine
+	//
+	// Render the templates of the BootEnv, Stage, and (optionally)
+	// Task for the Machine specified by {uuid} without changing the
+	// Machine.  The bootenv and stage query parameters default to the
+	// current ones for the Machine.  Missing params and template errors
+	// are returned as part of each result.
+	//
+	//     Responses:
+	//       200: MachineRenderResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/render",
+		func(c *gin.Context) {
+			rt := f.rt(c, "machines", "bootenvs", "stages", "tasks", "templates", "profiles", "params", "preferences")
+			var key string
+			rt.Do(func(d backend.Stores) {
+				if m := rt.Find("machines", c.Param(`uuid`)); m != nil {
+					key = backend.AsMachine(m).AuthKey()
+				}
+			})
+			if !f.assureSimpleAuth(c, rt, "machines", "render", key) {
+				return
+			}
+			res, err := backend.RenderPreview(rt, c.Param(`uuid`), c.Query("bootenv"), c.Query("stage"), c.Query("task"))
+			if err != nil {
+				be := err.(*models.Error)
+				c.JSON(be.Code, be)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route POST /machines/{uuid}/heartbeat Machines postMachineHeartbeat
+	//
+	// Send a heartbeat from the agent on a Machine
+	//
+	// Record that the agent on the Machine specified by {uuid} is
+	// alive, along with what it reports about itself.  This updates
+	// LastSeen, Liveness, and Heartbeat on the Machine.
+	//
+	//     Responses:
+	//       200: MachineResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/heartbeat",
+		func(c *gin.Context) {
+			hb := &models.AgentHeartbeat{}
+			f.machinePost(c, "heartbeat", hb,
+				[]string{"machines:rw", "stages", "bootenvs", "tasks", "templates", "profiles", "params", "workflows"},
+				func(rt *backend.RequestTracker, m *backend.Machine) (interface{}, error) {
+					res, err := m.Heartbeat(rt, hb, time.Now())
+					if err != nil {
+						return nil, err
+					}
+					return res.Machine, nil
+				})
+		})
+
+	// swagger:route POST /machines/{uuid}/inventory Machines postMachineInventory
+	//
+	// Send the hardware Inventory gathered by the agent on a Machine
+	//
+	// Create or replace the Inventory of the Machine specified by
+	// {uuid}.  If the hardware differs from the last Inventory, the
+	// change is added to its History and an inventories changed
+	// event is published.
+	//
+	//     Responses:
+	//       200: InventoryResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/inventory",
+		func(c *gin.Context) {
+			inv := &models.Inventory{}
+			f.machinePost(c, "inventory", inv, []string{"machines", "inventories:rw"},
+				func(rt *backend.RequestTracker, m *backend.Machine) (interface{}, error) {
+					res, err := m.SubmitInventory(rt, inv)
+					if err != nil {
+						return nil, err
+					}
+					return res.Inventory, nil
+				})
+		})
+
+	// swagger:route GET /machines/{uuid}/console Machines getMachineConsole
+	//
+	// Get the console output of a Machine
+	//
+	// Return the console output captured from the Machine specified
+	// by {uuid} over serial-over-LAN or netconsole, oldest first.
+	// The output can be limited to what was received from since up
+	// to until, both in RFC3339 format, or to the time the Job
+	// specified by job was running.
+	//
+	//     Responses:
+	//       200: MachineConsoleResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/console",
+		func(c *gin.Context) {
+			var since, until time.Time
+			for _, q := range []struct {
+				name string
+				dest *time.Time
+			}{{"since", &since}, {"until", &until}} {
+				val := c.Query(q.name)
+				if val == "" {
+					continue
+				}
+				t, err := time.Parse(time.RFC3339, val)
+				if err != nil {
+					c.JSON(http.StatusBadRequest,
+						models.NewError(c.Request.Method, http.StatusBadRequest,
+							fmt.Sprintf("%s is not a valid time: %v", q.name, err)))
+					return
+				}
+				*q.dest = t
+			}
+			rt := f.rt(c, "machines", "jobs")
+			var key, machineKey string
+			var job *backend.Job
+			rt.Do(func(d backend.Stores) {
+				if m := rt.Find("machines", c.Param(`uuid`)); m != nil {
+					key = backend.AsMachine(m).AuthKey()
+					machineKey = m.Key()
+				}
+				if jobKey := c.Query("job"); jobKey != "" {
+					if j := rt.Find("jobs", jobKey); j != nil {
+						job = backend.AsJob(j)
+					}
+				}
+			})
+			if !f.assureSimpleAuth(c, rt, "machines", "console", key) {
+				return
+			}
+			if machineKey == "" {
+				err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+					Messages: []string{fmt.Sprintf("Machine %s does not exist", c.Param(`uuid`))}}
+				c.JSON(err.Code, err)
+				return
+			}
+			if c.Query("job") != "" {
+				if job == nil || job.Machine.String() != machineKey {
+					err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+						Messages: []string{fmt.Sprintf("Job %s for Machine %s does not exist", c.Query("job"), c.Param(`uuid`))}}
+					c.JSON(err.Code, err)
+					return
+				}
+				since, until = job.ConsoleWindow()
+			}
+			res, err := f.dt.ReadConsole(machineKey, since, until)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+					models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
 }
@@ -101,6 +101,37 @@ func (f *Frontend) InitSystemApi() {
 	//       409: ErrorResponse
 	f.ApiGroup.POST("/system/actions/:cmd", pRun)
 
+	// swagger:route GET /system/actionkey System getSystemActionKey
+	//
+	// Get the public key that job actions are signed with
+	//
+	// Agents can pin this key to verify the job actions they get
+	// with signed=true.
+	//
+	//     Responses:
+	//       200: PubKeyResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       500: ErrorResponse
+	f.ApiGroup.GET("/system/actionkey",
+		func(c *gin.Context) {
+			rt := f.rt(c)
+			if !f.assureSimpleAuth(c, rt, "jobs", "actions", "") {
+				return
+			}
+			pk, err := rt.ActionPublicKey()
+			if err != nil {
+				ret := &models.Error{
+					Code: http.StatusInternalServerError,
+					Type: "Bad Secret",
+				}
+				ret.AddError(err)
+				c.JSON(ret.Code, ret)
+				return
+			}
+			c.JSON(http.StatusOK, pk)
+		})
+
 	// swagger:route POST /system/upgrade System systemUpdate
 	//
 	// Upload a file to upgrade the DRP system
@@ -2,12 +2,18 @@ package frontend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
 	"github.com/digitalrebar/provision/models"
 	"github.com/gin-gonic/gin"
 	"gopkg.in/olahol/melody.v1"
@@ -29,6 +35,89 @@ func (fe *Frontend) InitWebSocket() {
 	})
 
 	fe.melody.HandleMessage(websocketHandler)
+
+	fe.logMelody = melody.New()
+
+	// swagger:route GET /jobs/{uuid}/log/ws Jobs followJobLog
+	//
+	// Follow the log for this job
+	//
+	// Upgrades to a websocket that sends the log for the Job
+	// specified by {uuid} as JobLogChunks, starting at offset, as it
+	// is written.  The last chunk has Done set, and is sent once the
+	// Job has finished or failed.
+	//
+	//     Responses:
+	//       101: NoContentResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	fe.ApiGroup.GET("/jobs/:uuid/log/ws", func(c *gin.Context) {
+		var offset int64
+		if val := c.Query("offset"); val != "" {
+			o, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || o < 0 {
+				c.JSON(http.StatusBadRequest,
+					models.NewError("API ERROR", http.StatusBadRequest,
+						fmt.Sprintf("Invalid log offset %s", val)))
+				return
+			}
+			offset = o
+		}
+		j, rt := logJob(fe, c)
+		if j == nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		keys := map[string]interface{}{
+			"job":    j,
+			"rt":     rt,
+			"offset": offset,
+			"ctx":    ctx,
+		}
+		fe.logMelody.HandleRequestWithKeys(c.Writer, c.Request, keys)
+	})
+
+	fe.logMelody.HandleConnect(followJobLog)
+}
+
+// followJobLog sends the log of the Job to the session until the Job
+// is done or the session is closed.  Errors are sent as a
+// models.Error before closing the session.
+func followJobLog(s *melody.Session) {
+	j := s.MustGet("job").(*backend.Job)
+	rt := s.MustGet("rt").(*backend.RequestTracker)
+	stream := j.FollowLog(rt, s.MustGet("offset").(int64))
+	ctx := s.MustGet("ctx").(context.Context)
+	go func() {
+		defer stream.Close()
+		defer s.Close()
+		for {
+			chunk, err := stream.Next(ctx)
+			if err == io.EOF || err == context.Canceled {
+				return
+			}
+			var msg []byte
+			if err != nil {
+				e, ok := err.(*models.Error)
+				if !ok {
+					e = models.NewError("Server ERROR", http.StatusInternalServerError, err.Error())
+				}
+				msg, _ = json.Marshal(e)
+			} else if msg, err = json.Marshal(chunk); err != nil {
+				rt.Errorf("Failed to marshal log chunk for job %s: %v", j.Key(), err)
+				return
+			}
+			if err := s.Write(msg); err != nil {
+				return
+			}
+			if chunk == nil {
+				return
+			}
+		}
+	}()
 }
 
 // Callers register or deregister values.
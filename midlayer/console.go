@@ -0,0 +1,57 @@
+package midlayer
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
+)
+
+// NetconsoleHandler receives netconsole output from Machines.
+type NetconsoleHandler struct {
+	conn *net.UDPConn
+	done chan struct{}
+}
+
+func (h *NetconsoleHandler) Shutdown(ctx context.Context) error {
+	h.conn.Close()
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ServeNetconsole listens for netconsole packets on listen.  The kernel
+// messages in each packet are saved for the Machine that sent it, which
+// is found by the address the packet came from.
+func ServeNetconsole(listen string, dt *backend.DataTracker, log logger.Logger) (Service, error) {
+	a, err := net.ResolveUDPAddr(OsUdpProtoCheck(), listen)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP(OsUdpProtoCheck(), a)
+	if err != nil {
+		return nil, err
+	}
+	h := &NetconsoleHandler{conn: conn, done: make(chan struct{})}
+	r := &logReceiver{dt: dt, l: log.Fork().SetPrincipal("netconsole")}
+	go func() {
+		defer close(h.done)
+		buf := make([]byte, 65536)
+		for {
+			n, remote, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				return
+			}
+			r.deliver(remote.IP, ParseNetconsole(buf[:n], time.Now()))
+		}
+	}()
+	return h, nil
+}
@@ -76,6 +76,7 @@ type DhcpRequest struct {
 	start                             time.Time
 	machine                           *backend.Machine
 	bootEnv                           *backend.BootEnv
+	secureBoot                        bool
 }
 
 func (dhr *DhcpRequest) Reply(p dhcp.Packet) {
@@ -242,6 +243,7 @@ func (dhr *DhcpRequest) checkMachine(l *backend.Lease) {
 				dhr.machine = backend.AsMachine(m2)
 			}
 		}
+		dhr.secureBoot = rt.SecureBoot(dhr.machine)
 		if dhr.machine == nil {
 			// No machine known for this MAC address or IP address.  It can
 			// PXE boot if it wants.
@@ -229,14 +229,20 @@ func (dhr *DhcpRequest) fillForPXE(l *backend.Lease) {
 	if inIPxe && dhr.ipxeIsSane(arch) {
 		fname = "default.ipxe"
 	} else if dhr.bootEnv != nil {
-		var archInfo models.ArchInfo
+		var archName string
 		switch arch {
 		case 7, 9:
-			archInfo = dhr.bootEnv.RealArch("amd64")
+			archName = "amd64"
 		case 11:
-			archInfo = dhr.bootEnv.RealArch("arm64")
+			archName = "arm64"
 		}
-		if archInfo.Loader != "" {
+		if archName != "" && dhr.secureBoot {
+			fname = dhr.bootEnv.SecureBootLoader(archName)
+			if fname == "" {
+				dhr.Errorf("BootEnv %s has no Secure Boot chain for %s", dhr.bootEnv.Name, archName)
+			}
+		}
+		if archInfo := dhr.bootEnv.RealArch(archName); fname == "" && archInfo.Loader != "" {
 			fname = archInfo.Loader
 		}
 	}
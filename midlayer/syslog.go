@@ -0,0 +1,408 @@
+package midlayer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+)
+
+// maxSyslogMessage is the largest syslog message that is accepted over
+// TCP.  Messages over UDP are limited by the size of a packet.
+const maxSyslogMessage = 65536
+
+// parsePri parses the <PRI> at the start of a syslog message.  Messages
+// without one are user.notice, as RFC 3164 says.
+func parsePri(buf []byte) (facility, severity int, rest []byte) {
+	if len(buf) > 2 && buf[0] == '<' {
+		head := buf
+		if len(head) > 5 {
+			head = head[:5]
+		}
+		if end := bytes.IndexByte(head, '>'); end > 1 {
+			if pri, err := strconv.Atoi(string(buf[1:end])); err == nil && pri >= 0 && pri < 192 {
+				return pri >> 3, pri & 7, buf[end+1:]
+			}
+		}
+	}
+	return 1, 5, buf
+}
+
+// nextField splits the next space separated field off of buf.  RFC 5424
+// uses - for fields that have no value, which is returned as empty.
+func nextField(buf string) (field, rest string) {
+	parts := strings.SplitN(buf, " ", 2)
+	field = parts[0]
+	if len(parts) == 2 {
+		rest = parts[1]
+	}
+	if field == "-" {
+		field = ""
+	}
+	return
+}
+
+// skipStructuredData returns what follows the RFC 5424 structured data
+// at the start of buf.  Values in the structured data are quoted, and
+// can have escaped quotes and brackets in them.
+func skipStructuredData(buf string) string {
+	if strings.HasPrefix(buf, "-") {
+		return buf[1:]
+	}
+	inElem, inValue := false, false
+	for i := 0; i < len(buf); i++ {
+		switch c := buf[i]; {
+		case inValue && c == '\\':
+			i++
+		case inValue:
+			inValue = c != '"'
+		case inElem && c == '"':
+			inValue = true
+		case inElem && c == ']':
+			inElem = false
+		case !inElem && c == '[':
+			inElem = true
+		case !inElem:
+			return buf[i:]
+		}
+	}
+	return ""
+}
+
+// parseTag splits the TAG of an RFC 3164 message, such as
+// anaconda[1234]: off of the start of msg.
+func parseTag(msg *models.SyslogMessage, rest string) string {
+	end := strings.IndexAny(rest, ":[ ")
+	if end < 1 || end > 48 || rest[end] == ' ' {
+		return rest
+	}
+	app, procID, tail := rest[:end], "", rest[end:]
+	if tail[0] == '[' {
+		pidEnd := strings.Index(tail, "]")
+		if pidEnd < 0 {
+			return rest
+		}
+		procID, tail = tail[1:pidEnd], tail[pidEnd+1:]
+	}
+	if !strings.HasPrefix(tail, ":") {
+		return rest
+	}
+	msg.App, msg.ProcID = app, procID
+	return strings.TrimPrefix(tail[1:], " ")
+}
+
+// ParseSyslog parses a syslog message in either RFC 5424 or RFC 3164
+// format, which was received at now.  RFC 3164 is loosely defined, so
+// whatever cannot be parsed is left as part of the text of the
+// message.
+func ParseSyslog(buf []byte, now time.Time) *models.SyslogMessage {
+	msg := &models.SyslogMessage{Source: "syslog", Time: now, Received: now}
+	var rest []byte
+	msg.Facility, msg.Severity, rest = parsePri(bytes.TrimRight(buf, "\r\n\x00"))
+	line := string(rest)
+	if strings.HasPrefix(line, "1 ") {
+		var stamp string
+		stamp, line = nextField(line[2:])
+		if t, err := time.Parse(time.RFC3339Nano, stamp); err == nil {
+			msg.Time = t
+		}
+		msg.Hostname, line = nextField(line)
+		msg.App, line = nextField(line)
+		msg.ProcID, line = nextField(line)
+		msg.MsgID, line = nextField(line)
+		line = strings.TrimPrefix(skipStructuredData(line), " ")
+		msg.Message = strings.TrimPrefix(line, "\ufeff")
+		return msg
+	}
+	if len(line) > len(time.Stamp) && line[len(time.Stamp)] == ' ' {
+		if t, err := time.ParseInLocation(time.Stamp, line[:len(time.Stamp)], now.Location()); err == nil {
+			// RFC 3164 timestamps have no year, so pick the one
+			// that puts the message closest to when it arrived.
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			msg.Time = t
+			line = line[len(time.Stamp)+1:]
+			// The hostname is optional in practice, so only take
+			// it when what follows is not the tag.
+			if host, tail := nextField(line); tail != "" && !strings.ContainsAny(host, ":[") {
+				msg.Hostname, line = host, tail
+			}
+		}
+	}
+	msg.Message = parseTag(msg, line)
+	return msg
+}
+
+// ParseNetconsole parses a netconsole packet received at now.  Packets
+// sent in the extended format have the kernel log level of the message
+// in them.  Plain packets can have several lines of kernel messages in
+// them, which are notice since their level is not sent.
+func ParseNetconsole(buf []byte, now time.Time) []*models.SyslogMessage {
+	res := []*models.SyslogMessage{}
+	text := string(buf)
+	if header := strings.SplitN(text, ";", 2); len(header) == 2 {
+		// level,sequence,timestamp,flags[,...];message
+		fields := strings.Split(header[0], ",")
+		if pri, err := strconv.Atoi(fields[0]); err == nil && len(fields) >= 4 && pri >= 0 && pri < 192 {
+			// Extended messages are one message per packet, and
+			// continuation lines that start with a space are the
+			// dictionary of the message, which is not kept.
+			line := strings.SplitN(header[1], "\n", 2)[0]
+			return append(res, &models.SyslogMessage{
+				Source:   "netconsole",
+				Facility: pri >> 3,
+				Severity: pri & 7,
+				Time:     now,
+				Received: now,
+				Message:  strings.TrimRight(line, "\r"),
+			})
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		res = append(res, &models.SyslogMessage{
+			Source:   "netconsole",
+			Severity: 5,
+			Time:     now,
+			Received: now,
+			Message:  line,
+		})
+	}
+	return res
+}
+
+// consoleText is how a message is saved in the console output and job
+// log of a Machine.
+func consoleText(msg *models.SyslogMessage) string {
+	if msg.App == "" {
+		return msg.Message
+	}
+	if msg.ProcID == "" {
+		return fmt.Sprintf("%s: %s", msg.App, msg.Message)
+	}
+	return fmt.Sprintf("%s[%s]: %s", msg.App, msg.ProcID, msg.Message)
+}
+
+// logReceiver saves messages received over syslog and netconsole for the
+// Machines that sent them.
+type logReceiver struct {
+	dt *backend.DataTracker
+	l  logger.Logger
+}
+
+// deliver saves msgs, which were received from addr, as part of the
+// console output of the Machine with that address.  If the Machine is
+// running a Job, they are added to the log of the Job as well.  An
+// event is published for each message that is an error.  Messages from
+// addresses that do not belong to a Machine are dropped.
+func (r *logReceiver) deliver(addr net.IP, msgs []*models.SyslogMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	var key string
+	rt := r.dt.Request(r.l, "machines", "leases", "jobs")
+	rt.Do(func(_ backend.Stores) {
+		m := rt.MachineForAddress(addr)
+		if m == nil {
+			return
+		}
+		key = m.Key()
+		if obj := rt.Find("jobs", m.CurrentJob.String()); obj != nil {
+			if job := backend.AsJob(obj); job.State == "running" {
+				buf := &bytes.Buffer{}
+				for _, msg := range msgs {
+					fmt.Fprintf(buf, "[%s] %s\n", msg.Source, consoleText(msg))
+				}
+				if err := job.Log(rt, buf); err != nil {
+					r.l.Errorf("Failed to add %s messages to the log of job %s: %v", msgs[0].Source, job.Key(), err)
+				}
+			}
+		}
+		for _, msg := range msgs {
+			if msg.IsError() {
+				rt.Publish("machines", "error", key, msg)
+			}
+		}
+	})
+	if key == "" {
+		r.l.Debugf("Dropping %s messages from unknown address %s", msgs[0].Source, addr)
+		return
+	}
+	for _, msg := range msgs {
+		if err := r.dt.AppendConsole(key, msg.Source, msg.Received, consoleText(msg)); err != nil {
+			r.l.Errorf("Failed to save %s messages of machine %s: %v", msg.Source, key, err)
+		}
+	}
+}
+
+// SyslogHandler receives syslog messages from Machines over UDP and
+// TCP.
+type SyslogHandler struct {
+	udp    *net.UDPConn
+	tcp    net.Listener
+	mux    *sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     *sync.WaitGroup
+}
+
+func (h *SyslogHandler) Shutdown(ctx context.Context) error {
+	h.udp.Close()
+	h.tcp.Close()
+	h.mux.Lock()
+	h.closed = true
+	for conn := range h.conns {
+		conn.Close()
+	}
+	h.mux.Unlock()
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readSyslogFrame reads the next message from a syslog TCP stream.
+// Messages are framed either by octet counting or by newlines, as
+// described in RFC 6587.
+func readSyslogFrame(rdr *bufio.Reader) ([]byte, error) {
+	first, err := rdr.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		count, err := rdr.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(count, " "))
+		if err != nil || size > maxSyslogMessage {
+			return nil, fmt.Errorf("invalid syslog frame length %q", count)
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(rdr, buf)
+		return buf, err
+	}
+	buf := []byte{}
+	for {
+		line, isPrefix, err := rdr.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(buf)+len(line) <= maxSyslogMessage {
+			buf = append(buf, line...)
+		}
+		if !isPrefix {
+			return buf, nil
+		}
+	}
+}
+
+// ServeSyslog listens for syslog messages on listen over both UDP and
+// TCP.  Each message is saved for the Machine that sent it, which is
+// found by the address the message came from.
+func ServeSyslog(listen string, dt *backend.DataTracker, log logger.Logger) (Service, error) {
+	a, err := net.ResolveUDPAddr(OsUdpProtoCheck(), listen)
+	if err != nil {
+		return nil, err
+	}
+	udp, err := net.ListenUDP(OsUdpProtoCheck(), a)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", listen)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	h := &SyslogHandler{
+		udp:   udp,
+		tcp:   tcp,
+		mux:   &sync.Mutex{},
+		conns: map[net.Conn]struct{}{},
+		wg:    &sync.WaitGroup{},
+	}
+	r := &logReceiver{dt: dt, l: log.Fork().SetPrincipal("syslog")}
+	h.wg.Add(2)
+	go func() {
+		defer h.wg.Done()
+		buf := make([]byte, maxSyslogMessage)
+		for {
+			n, remote, err := udp.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				return
+			}
+			r.deliver(remote.IP, []*models.SyslogMessage{ParseSyslog(buf[:n], time.Now())})
+		}
+	}()
+	go func() {
+		defer h.wg.Done()
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				return
+			}
+			h.mux.Lock()
+			if h.closed {
+				h.mux.Unlock()
+				conn.Close()
+				return
+			}
+			h.conns[conn] = struct{}{}
+			h.mux.Unlock()
+			h.wg.Add(1)
+			go func() {
+				defer h.wg.Done()
+				defer func() {
+					h.mux.Lock()
+					delete(h.conns, conn)
+					h.mux.Unlock()
+					conn.Close()
+				}()
+				remote := conn.RemoteAddr().(*net.TCPAddr).IP
+				rdr := bufio.NewReader(conn)
+				for {
+					frame, err := readSyslogFrame(rdr)
+					if err != nil {
+						if err != io.EOF {
+							r.l.Debugf("Syslog connection from %s closed: %v", remote, err)
+						}
+						return
+					}
+					if len(bytes.TrimSpace(frame)) == 0 {
+						continue
+					}
+					r.deliver(remote, []*models.SyslogMessage{ParseSyslog(frame, time.Now())})
+				}
+			}()
+		}
+	}()
+	return h, nil
+}
@@ -0,0 +1,123 @@
+package midlayer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want models.SyslogMessage
+	}{
+		{
+			"<165>1 2020-01-02T03:04:00.5Z host1 anaconda 1234 ID47 - Installing packages\n",
+			models.SyslogMessage{Facility: 20, Severity: 5, Time: time.Date(2020, 1, 2, 3, 4, 0, 500000000, time.UTC),
+				Hostname: "host1", App: "anaconda", ProcID: "1234", MsgID: "ID47", Message: "Installing packages"},
+		},
+		{
+			`<11>1 - - - - - [exampleSDID@32473 iut="3" eventSource="App\]lication"][other@1 a="b"] ` + "\ufeff" + "Disk failed",
+			models.SyslogMessage{Facility: 1, Severity: 3, Time: now, Message: "Disk failed"},
+		},
+		{
+			"<13>1 - host1 app - - -",
+			models.SyslogMessage{Facility: 1, Severity: 5, Time: now, Hostname: "host1", App: "app"},
+		},
+		{
+			"<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			models.SyslogMessage{Facility: 4, Severity: 2, Time: time.Date(2019, 10, 11, 22, 14, 15, 0, time.UTC),
+				Hostname: "mymachine", App: "su", Message: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			"<30>Jan  2 03:04:00 debconf[991]: preseed loaded",
+			models.SyslogMessage{Facility: 3, Severity: 6, Time: time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC),
+				App: "debconf", ProcID: "991", Message: "preseed loaded"},
+		},
+		{
+			"<27>anaconda: Traceback (most recent call last):",
+			models.SyslogMessage{Facility: 3, Severity: 3, Time: now, App: "anaconda", Message: "Traceback (most recent call last):"},
+		},
+		{
+			"no priority at all: really",
+			models.SyslogMessage{Facility: 1, Severity: 5, Time: now, Message: "no priority at all: really"},
+		},
+		{
+			"<999>bad priority",
+			models.SyslogMessage{Facility: 1, Severity: 5, Time: now, Message: "<999>bad priority"},
+		},
+	}
+	for _, test := range tests {
+		got := ParseSyslog([]byte(test.in), now)
+		test.want.Source, test.want.Received = "syslog", now
+		if *got != test.want {
+			t.Errorf("Parsing %q\n got: %+v\nwant: %+v", test.in, *got, test.want)
+		}
+	}
+}
+
+func TestParseNetconsole(t *testing.T) {
+	now := time.Now()
+	msgs := ParseNetconsole([]byte("[    1.234] Booting kernel\n[    1.300] Kernel panic - not syncing\n\n"), now)
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 messages, not %d", len(msgs))
+	}
+	if msgs[1].Message != "[    1.300] Kernel panic - not syncing" || msgs[1].Severity != 5 || msgs[1].Source != "netconsole" {
+		t.Errorf("Unexpected plain netconsole message %+v", msgs[1])
+	}
+	msgs = ParseNetconsole([]byte("3,1234,5678901,-;sd 0:0:0:0: I/O error\n SUBSYSTEM=scsi\n DEVICE=+scsi:0:0:0:0\n"), now)
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 extended message, not %d", len(msgs))
+	}
+	if msgs[0].Message != "sd 0:0:0:0: I/O error" || msgs[0].Severity != 3 || msgs[0].Facility != 0 || !msgs[0].IsError() {
+		t.Errorf("Unexpected extended netconsole message %+v", msgs[0])
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	rdr := bufio.NewReader(strings.NewReader("11 <13>counted<13>line one\n<13>line two\r\n99999999 too long"))
+	for _, want := range []string{"<13>counted", "<13>line one", "<13>line two"} {
+		got, err := readSyslogFrame(rdr)
+		if err != nil || string(got) != want {
+			t.Errorf("Expected frame %q, not %q: %v", want, got, err)
+		}
+	}
+	if _, err := readSyslogFrame(rdr); err == nil {
+		t.Errorf("Expected a frame that is too long to fail")
+	}
+}
+
+func TestSyslogDeliver(t *testing.T) {
+	l := dataTracker.Logger
+	rt := dataTracker.Request(l, "stages", "bootenvs", "machines:rw", "tasks", "profiles", "templates", "params", "workflows")
+	m := &models.Machine{Uuid: uuid.NewRandom(), Name: "syslog.fqdn", Address: net.ParseIP("192.168.124.60")}
+	var err error
+	rt.Do(func(d backend.Stores) {
+		_, err = rt.Create(m)
+	})
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	r := &logReceiver{dt: dataTracker, l: l}
+	now := time.Now()
+	r.deliver(net.ParseIP("192.168.124.60"), []*models.SyslogMessage{
+		ParseSyslog([]byte("<27>anaconda[12]: Traceback (most recent call last):"), now),
+	})
+	r.deliver(net.ParseIP("192.168.124.61"), []*models.SyslogMessage{
+		ParseSyslog([]byte("<27>anaconda[12]: not from a machine"), now),
+	})
+	lines, err := dataTracker.ReadConsole(m.Key(), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to read console output: %v", err)
+	}
+	if len(lines) != 1 || lines[0].Source != "syslog" || lines[0].Line != "anaconda[12]: Traceback (most recent call last):" {
+		t.Errorf("Expected the syslog message to be saved for the machine, not %v", lines)
+	}
+}
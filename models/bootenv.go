@@ -60,6 +60,16 @@ type ArchInfo struct {
 	// options, and it will also only be in effect when dr-provision is
 	// the DHCP server of record.
 	Loader string
+	// Shim is the partial path to a signed shim bootloader in the OS
+	// ISO or install archive.  Machines with the secure-boot param set
+	// to true will be handed Shim instead of Loader or ipxe when they
+	// PXE boot into this boot environment, and Shim will load Grub.
+	// Secure Boot is only supported on amd64 and arm64.
+	Shim string
+	// Grub is the partial path to the signed grub in the OS ISO or
+	// install archive that Shim should chainload.  It must be set if
+	// Shim is.
+	Grub string
 }
 
 func (a *ArchInfo) Fill() {
@@ -337,9 +347,20 @@ func (b *BootEnv) Validate() {
 			tmplNames[tmpl.Name] = i
 		}
 	}
-	for k := range b.OS.SupportedArchitectures {
-		if _, ok := SupportedArch(k); !ok {
+	for k, v := range b.OS.SupportedArchitectures {
+		arch, ok := SupportedArch(k)
+		if !ok {
 			b.Errorf("%s is not a supported architecture", k)
+			continue
+		}
+		if v.Shim == "" && v.Grub == "" {
+			continue
+		}
+		if v.Shim == "" || v.Grub == "" {
+			b.Errorf("Arch %s must have both Shim and Grub for Secure Boot", k)
+		}
+		if arch != "amd64" && arch != "arm64" {
+			b.Errorf("Arch %s does not support Secure Boot", k)
 		}
 	}
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ConsoleLine is a line of output captured from the console of a
+// Machine.
+// swagger:model
+type ConsoleLine struct {
+	// Time is when the line was received.
+	Time time.Time
+	// Source is where the line came from, such as sol for
+	// serial-over-LAN or netconsole.
+	Source string
+	// Line is the text of the line, without its line ending.
+	Line string
+}
@@ -93,6 +93,7 @@ type Content struct {
 		plugins      map[string]*models.Plugin
 		machines     map[string]*models.Machine
 		leases       map[string]*models.Lease
+		tests        map[string]*models.TemplateTest
 	*/
 	Sections Sections `json:"sections"`
 }
@@ -242,7 +243,12 @@ func (c *Content) FromStore(src store.Store) error {
 		}
 		c.Sections[section] = map[string]interface{}{}
 		for _, key := range keys {
-			val, _ := New(section)
+			var val interface{}
+			if section == TemplateTestSection {
+				val = &TemplateTest{}
+			} else {
+				val, _ = New(section)
+			}
 			if f, ok := val.(Filler); ok {
 				f.Fill()
 			}
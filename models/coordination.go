@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// Barrier is a named point that a set number of Machines in the same
+// scope wait at until all of them have arrived.  Once the last
+// Machine arrives, every waiting Machine is released and the Barrier
+// starts over empty, so the same name can be used again the next
+// time around.
+//
+// Barriers only live in memory on the server.  They are not saved,
+// and they will be forgotten if dr-provision restarts.
+// swagger:model
+type Barrier struct {
+	// Scope is what the Barrier is shared between.  It is either
+	// profile:<name> for the Machines that have the named Profile, or
+	// cluster:<name> for the Machines whose cluster/name param has that
+	// value.
+	//
+	// required: true
+	Scope string
+	// Name is the name of the Barrier in its Scope.
+	//
+	// required: true
+	Name string
+	// Count is how many Machines must arrive at the Barrier before
+	// any of them are released.
+	//
+	// required: true
+	Count int
+	// Arrived is the list of Machines waiting at the Barrier.
+	//
+	// required: true
+	Arrived []uuid.UUID
+}
+
+// LockHolder records a Machine that is holding a Lock.
+// swagger:model
+type LockHolder struct {
+	// Machine is the Machine that holds the Lock.
+	//
+	// required: true
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// Job is the CurrentJob of the Machine when it acquired the Lock.
+	//
+	// swagger:strfmt uuid
+	Job uuid.UUID
+	// Acquired is when the Machine acquired the Lock.
+	//
+	// required: true
+	// swagger:strfmt date-time
+	Acquired time.Time
+}
+
+// Lock is a named semaphore that at most Limit Machines in the same
+// scope may hold at once.  A Lock with a Limit of 1 is a mutex.  A
+// Machine holds a Lock until it releases it, one of its Jobs fails,
+// or it is deleted.
+//
+// Locks only live in memory on the server.  They are not saved, and
+// they will be forgotten if dr-provision restarts.
+// swagger:model
+type Lock struct {
+	// Scope is what the Lock is shared between.  It works the same
+	// way as the Scope of a Barrier.
+	//
+	// required: true
+	Scope string
+	// Name is the name of the Lock in its Scope.
+	//
+	// required: true
+	Name string
+	// Limit is how many Machines may hold the Lock at once.
+	//
+	// required: true
+	Limit int
+	// Holders are the Machines that currently hold the Lock.
+	//
+	// required: true
+	Holders []LockHolder
+	// Waiting is how many Machines are waiting to acquire the Lock.
+	//
+	// required: true
+	Waiting int
+}
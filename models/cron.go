@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSpec is a parsed cron expression.  Each field is a bitmask of
+// the values that match.
+type CronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// If either of the day fields was restricted, a day matches if
+	// either of them does, just like cron.
+	domStar, dowStar bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var cronDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func cronValue(s string, names []string) (int, error) {
+	for i, n := range names {
+		if n != "" && strings.ToLower(s) == n {
+			return i, nil
+		}
+	}
+	return strconv.Atoi(s)
+}
+
+// cronField parses one comma-separated field of a cron expression
+// into a bitmask.  It accepts *, single values, ranges, and steps.
+func cronField(field string, min, max int, names []string) (uint64, error) {
+	var res uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s", part)
+			}
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err1, err2 error
+			lo, err1 = cronValue(bounds[0], names)
+			hi, err2 = cronValue(bounds[1], names)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %s", rng)
+			}
+		default:
+			v, err := cronValue(rng, names)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %s", rng)
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%s is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+	return res, nil
+}
+
+// ParseCron parses a standard five field cron expression (minute,
+// hour, day of month, month, and day of week) or one of the @hourly,
+// @daily, @weekly, @monthly, and @yearly shortcuts.  Months and days
+// of the week may be given by their three letter names, and Sunday
+// may be either 0 or 7.
+func ParseCron(spec string) (*CronSpec, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, not %d", spec, len(fields))
+	}
+	res := &CronSpec{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	for _, f := range []struct {
+		val      *uint64
+		min, max int
+		names    []string
+	}{
+		{&res.minute, 0, 59, nil},
+		{&res.hour, 0, 23, nil},
+		{&res.dom, 1, 31, nil},
+		{&res.month, 1, 12, cronMonths},
+		{&res.dow, 0, 7, cronDays},
+	} {
+		if *f.val, err = cronField(fields[0], f.min, f.max, f.names); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", spec, err)
+		}
+		fields = fields[1:]
+	}
+	if res.dow&(1<<7) != 0 {
+		res.dow |= 1
+	}
+	return res, nil
+}
+
+func (c *CronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that matches the CronSpec, in
+// the location of t.  It returns the zero time if nothing matches in
+// the next five years.
+func (c *CronSpec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,342 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// maxInventoryChanges is how many hardware changes an Inventory
+// remembers.
+const maxInventoryChanges = 20
+
+// InventorySystem describes the system as a whole, as reported by
+// its firmware.
+//
+// swagger:model
+type InventorySystem struct {
+	Manufacturer string
+	ProductName  string
+	SerialNumber string
+	// UUID is the system UUID from the firmware, which is not
+	// always the same as the UUID of the Machine.
+	UUID string
+}
+
+// InventoryFirmware holds the versions of the system firmware.
+// Disks and NICs carry the versions of their own firmware.
+//
+// swagger:model
+type InventoryFirmware struct {
+	BIOSVendor  string
+	BIOSVersion string
+	BIOSDate    string
+}
+
+// InventoryCPU is one processor socket.
+//
+// swagger:model
+type InventoryCPU struct {
+	// Socket is the physical id of the processor.
+	Socket  int
+	Vendor  string
+	Model   string
+	Cores   int
+	Threads int
+	// MHz is the maximum speed of the processor, or 0 if it is not
+	// known.
+	MHz int
+}
+
+// InventoryDIMM is one populated memory slot.
+//
+// swagger:model
+type InventoryDIMM struct {
+	// Locator is the name of the slot the DIMM is in.
+	Locator string
+	// Size is in bytes.
+	Size int64
+	Type string
+	// Speed is in MT/s.
+	Speed        int
+	Manufacturer string
+	SerialNumber string
+	PartNumber   string
+}
+
+// InventoryDisk is one block device that is not a partition or a
+// virtual device.
+//
+// swagger:model
+type InventoryDisk struct {
+	Name         string
+	Model        string
+	SerialNumber string
+	Firmware     string
+	// Size is in bytes.
+	Size       int64
+	Rotational bool
+}
+
+// InventoryNIC is one physical network interface.
+//
+// swagger:model
+type InventoryNIC struct {
+	Name string
+	MAC  string
+	// Speed is the link speed in Mb/s.  It is 0 when the link is
+	// down or the speed is not known.
+	Speed    int
+	Link     bool
+	Driver   string
+	Firmware string
+	// PCIAddress is the address of the PCI device of the NIC, if it
+	// has one.
+	PCIAddress string
+}
+
+// InventoryPCIDevice is one device on a PCI bus.
+//
+// swagger:model
+type InventoryPCIDevice struct {
+	Address string
+	// Class, Vendor, Device, SubVendor, and SubDevice are the
+	// hexadecimal IDs of the device.
+	Class     string
+	Vendor    string
+	Device    string
+	SubVendor string
+	SubDevice string
+	Driver    string
+}
+
+// InventoryChange records a change in the hardware of a Machine
+// between two Inventory reports.
+//
+// swagger:model
+type InventoryChange struct {
+	// Time is when the change was reported.
+	Time time.Time
+	// Changes describes each thing that was added, removed, or
+	// changed, such as "NICs: removed 52:54:00:12:34:56".
+	Changes []string
+}
+
+// Inventory is the hardware of a Machine, as last reported by the
+// agent running on it.  There is one Inventory per Machine, and its
+// key is the UUID of the Machine.
+//
+// swagger:model
+type Inventory struct {
+	Validation
+	Access
+	Meta
+	Owned
+	Bundled
+	// Machine is the UUID of the Machine.
+	//
+	// required: true
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// Collected is when the agent gathered the Inventory.
+	Collected time.Time
+	// Boot is when the Machine booted the OS that gathered the
+	// Inventory.
+	Boot     time.Time
+	System   InventorySystem
+	Firmware InventoryFirmware
+	CPUs     []InventoryCPU
+	// Memory is the total memory in bytes.
+	Memory     int64
+	DIMMs      []InventoryDIMM
+	Disks      []InventoryDisk
+	NICs       []InventoryNIC
+	PCIDevices []InventoryPCIDevice
+	// History holds the last hardware changes of the Machine, oldest
+	// first.
+	//
+	// read only: true
+	History []InventoryChange
+}
+
+func (i *Inventory) GetMeta() Meta {
+	return i.Meta
+}
+
+func (i *Inventory) SetMeta(d Meta) {
+	i.Meta = d
+}
+
+func (i *Inventory) Prefix() string {
+	return "inventories"
+}
+
+func (i *Inventory) Key() string {
+	return i.Machine.String()
+}
+
+func (i *Inventory) KeyName() string {
+	return "Machine"
+}
+
+func (i *Inventory) AuthKey() string {
+	return i.Key()
+}
+
+func (i *Inventory) Fill() {
+	i.Validation.fill()
+	if i.Meta == nil {
+		i.Meta = Meta{}
+	}
+	if i.CPUs == nil {
+		i.CPUs = []InventoryCPU{}
+	}
+	if i.DIMMs == nil {
+		i.DIMMs = []InventoryDIMM{}
+	}
+	if i.Disks == nil {
+		i.Disks = []InventoryDisk{}
+	}
+	if i.NICs == nil {
+		i.NICs = []InventoryNIC{}
+	}
+	if i.PCIDevices == nil {
+		i.PCIDevices = []InventoryPCIDevice{}
+	}
+	if i.History == nil {
+		i.History = []InventoryChange{}
+	}
+}
+
+func (i *Inventory) SliceOf() interface{} {
+	s := []*Inventory{}
+	return &s
+}
+
+func (i *Inventory) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*Inventory)
+	res := make([]Model, len(*items))
+	for j, item := range *items {
+		res[j] = Model(item)
+	}
+	return res
+}
+
+func (i *Inventory) Validate() {
+	if i.Machine == nil {
+		i.Errorf("Inventory must have a Machine")
+	}
+	for _, nic := range i.NICs {
+		if _, err := net.ParseMAC(nic.MAC); err != nil {
+			i.Errorf("NIC %s has an invalid MAC %s", nic.Name, nic.MAC)
+		}
+	}
+	if i.Memory < 0 {
+		i.Errorf("Memory must not be negative")
+	}
+}
+
+// Cores is the number of cores in all of the CPUs.
+func (i *Inventory) Cores() int {
+	res := 0
+	for _, cpu := range i.CPUs {
+		res += cpu.Cores
+	}
+	return res
+}
+
+// MACs returns the MAC addresses of all the NICs.
+func (i *Inventory) MACs() []string {
+	res := make([]string, len(i.NICs))
+	for j := range i.NICs {
+		res[j] = i.NICs[j].MAC
+	}
+	return res
+}
+
+// diffItems compares two lists of hardware that are identified by
+// id, and describes what was added, removed, or changed.
+func diffItems(section string, old, cur map[string]interface{}) []string {
+	res := []string{}
+	for id, item := range cur {
+		if was, ok := old[id]; !ok {
+			res = append(res, fmt.Sprintf("%s: added %s", section, id))
+		} else if !reflect.DeepEqual(was, item) {
+			res = append(res, fmt.Sprintf("%s: changed %s", section, id))
+		}
+	}
+	for id := range old {
+		if _, ok := cur[id]; !ok {
+			res = append(res, fmt.Sprintf("%s: removed %s", section, id))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (i *Inventory) items() map[string]map[string]interface{} {
+	res := map[string]map[string]interface{}{
+		"CPUs":       {},
+		"DIMMs":      {},
+		"Disks":      {},
+		"NICs":       {},
+		"PCIDevices": {},
+	}
+	for _, v := range i.CPUs {
+		res["CPUs"][fmt.Sprintf("socket %d", v.Socket)] = v
+	}
+	for _, v := range i.DIMMs {
+		res["DIMMs"][v.Locator] = v
+	}
+	for _, v := range i.Disks {
+		id := v.SerialNumber
+		if id == "" {
+			id = v.Name
+		}
+		res["Disks"][id] = v
+	}
+	for _, v := range i.NICs {
+		res["NICs"][v.MAC] = v
+	}
+	for _, v := range i.PCIDevices {
+		res["PCIDevices"][v.Address] = v
+	}
+	return res
+}
+
+// Diff describes how the hardware in i differs from the hardware in
+// old.  CPUs are told apart by socket, DIMMs by slot, Disks by serial
+// number, NICs by MAC address, and PCI devices by address, so
+// reordering them is not a change.  Only the hardware is compared:
+// when the Inventory was collected and its History do not matter.
+// An empty result means the hardware did not change.
+func (i *Inventory) Diff(old *Inventory) []string {
+	res := []string{}
+	if !reflect.DeepEqual(i.System, old.System) {
+		res = append(res, "System: changed")
+	}
+	if !reflect.DeepEqual(i.Firmware, old.Firmware) {
+		res = append(res, "Firmware: changed")
+	}
+	if i.Memory != old.Memory {
+		res = append(res, fmt.Sprintf("Memory: changed from %d to %d", old.Memory, i.Memory))
+	}
+	cur, was := i.items(), old.items()
+	for _, section := range []string{"CPUs", "DIMMs", "Disks", "NICs", "PCIDevices"} {
+		res = append(res, diffItems(section, was[section], cur[section])...)
+	}
+	return res
+}
+
+// AddChange records a hardware change in the History of the
+// Inventory, forgetting the oldest changes as needed.
+func (i *Inventory) AddChange(when time.Time, changes []string) {
+	i.History = append(i.History, InventoryChange{Time: when, Changes: changes})
+	if over := len(i.History) - maxInventoryChanges; over > 0 {
+		i.History = i.History[over:]
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInventoryDiff(t *testing.T) {
+	old := &Inventory{
+		Firmware: InventoryFirmware{BIOSVersion: "1.0"},
+		DIMMs:    []InventoryDIMM{{Locator: "A1", Size: 16 << 30}, {Locator: "A2", Size: 16 << 30}},
+	}
+	cur := &Inventory{
+		Firmware: InventoryFirmware{BIOSVersion: "1.1"},
+		DIMMs:    []InventoryDIMM{{Locator: "A2", Size: 16 << 30}, {Locator: "B1", Size: 16 << 30}},
+	}
+	expected := []string{"Firmware: changed", "DIMMs: added B1", "DIMMs: removed A1"}
+	if changes := cur.Diff(old); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("ERROR: expected changes %v, got %v", expected, changes)
+	}
+	cur.Collected, cur.History = time.Now(), []InventoryChange{{}}
+	if changes := cur.Diff(cur); len(changes) != 0 {
+		t.Errorf("ERROR: expected no changes, got %v", changes)
+	}
+	for i := 0; i < maxInventoryChanges+5; i++ {
+		cur.AddChange(time.Unix(int64(i), 0), []string{"Firmware: changed"})
+	}
+	if len(cur.History) != maxInventoryChanges || cur.History[0].Time.Unix() != 5 {
+		t.Errorf("ERROR: expected the last %d changes, got %d starting at %s", maxInventoryChanges, len(cur.History), cur.History[0].Time)
+	}
+}
@@ -1,11 +1,13 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/pborman/uuid"
+	"golang.org/x/crypto/nacl/sign"
 )
 
 // Job Action is something that job runner will need to do.
@@ -21,6 +23,48 @@ type JobAction struct {
 	Content string
 	// required: true
 	Meta map[string]string
+	// Signature is the signature of the JobAction by the server's
+	// action key, if the agent asked for signed JobActions.
+	Signature []byte `json:",omitempty"`
+}
+
+// signedBytes is what gets signed for the JobAction.  It includes the
+// Job, so that a signed JobAction cannot be replayed for another Job,
+// and the index of the JobAction in the count JobActions rendered for
+// the Job, so that they cannot be dropped or reordered.
+func (ja *JobAction) signedBytes(job uuid.UUID, index, count int) []byte {
+	buf, _ := json.Marshal(struct {
+		Job     string
+		Index   int
+		Count   int
+		Name    string
+		Path    string
+		Content string
+		Meta    map[string]string
+	}{job.String(), index, count, ja.Name, ja.Path, ja.Content, ja.Meta})
+	return buf
+}
+
+// Sign signs the JobAction at index in the count JobActions for the
+// Job with key, a nacl/sign private key.
+func (ja *JobAction) Sign(job uuid.UUID, index, count int, key *[64]byte) {
+	ja.Signature = sign.Sign(nil, ja.signedBytes(job, index, count), key)[:sign.Overhead]
+}
+
+// Verify checks that the JobAction at index in the count JobActions
+// for the Job was signed by the private half of key.
+func (ja *JobAction) Verify(job uuid.UUID, index, count int, key *[32]byte) error {
+	if len(ja.Signature) == 0 {
+		return fmt.Errorf("Action %s is not signed", ja.Name)
+	}
+	if len(ja.Signature) != sign.Overhead {
+		return fmt.Errorf("Action %s has an invalid signature", ja.Name)
+	}
+	signed := append(append([]byte{}, ja.Signature...), ja.signedBytes(job, index, count)...)
+	if _, ok := sign.Open(nil, signed, key); !ok {
+		return fmt.Errorf("Action %s has an invalid signature", ja.Name)
+	}
+	return nil
 }
 
 func (ja *JobAction) ValidForOS(target string) bool {
@@ -60,6 +104,10 @@ func (ja JobActions) FilterOS(forOS string) JobActions {
 	return res
 }
 
+// JobTimeoutExitCode is the ExitCode of a Job that ran past its
+// Timeout, the same one that coreutils timeout exits with.
+const JobTimeoutExitCode = 124
+
 // Job contains information on a Job that is running for a specific
 // Task on a Machine.
 //
@@ -91,7 +139,7 @@ type Job struct {
 	// required: true
 	State string
 	// The final disposition of the job.
-	// Can be one of "reboot","poweroff","stop", or "complete"
+	// Can be one of "reboot","poweroff","stop","complete","failed","timeout", or "retry"
 	// Other substates may be added as time goes on
 	ExitState string
 	// The time the job started running.
@@ -126,6 +174,62 @@ type Job struct {
 	// The bootenv that the task was created in.
 	// read only: true
 	BootEnv string
+	// Timeout is the number of seconds the job may run before it is
+	// killed and marked as failed with an ExitState of "timeout" and
+	// an ExitCode of JobTimeoutExitCode.
+	// It is copied from the Task or the Stage when the job is
+	// created.  0 means the job may run forever.
+	// read only: true
+	Timeout int
+	// Attempt is how many times in a row the Task has been tried,
+	// counting this job.  It starts at 1 and goes up each time a
+	// failed job is retried.
+	// read only: true
+	Attempt int
+	// ExitCode is the exit code of the last script the job ran.
+	ExitCode int
+	// Parent is the UUID of the job for the parallel task group
+	// that this job runs in, if any.
+	// read only: true
+	// swagger:strfmt uuid
+	Parent uuid.UUID
+}
+
+// JobLogChunk is a piece of the log of a Job, sent to clients that
+// follow the log as it is written.
+//
+// swagger:model
+type JobLogChunk struct {
+	// Offset is where Data starts in the log.  Clients that lose
+	// their connection can resume from the Offset they have read up
+	// to.
+	//
+	// required: true
+	Offset int64
+	// Data is the next part of the log.
+	Data []byte
+	// Done is set on the last chunk, once the Job has finished or
+	// failed and all of its log has been sent.
+	Done bool
+}
+
+// JobArtifact describes a file that a Job uploaded, such as hardware
+// inventory output or benchmark results.
+//
+// swagger:model
+type JobArtifact struct {
+	// Name is the name of the artifact.
+	//
+	// required: true
+	Name string
+	// Size is the size of the artifact in bytes.
+	//
+	// required: true
+	Size int64
+	// Modified is when the artifact was last uploaded.
+	//
+	// required: true
+	Modified time.Time
 }
 
 func (j *Job) GetMeta() Meta {
@@ -149,13 +253,20 @@ func (j *Job) Validate() {
 	}
 	if j.ExitState != "" {
 		switch j.ExitState {
-		case "reboot", "poweroff", "stop", "complete", "failed":
+		case "reboot", "poweroff", "stop", "complete", "failed", "timeout", "retry":
 		default:
 			j.AddError(fmt.Errorf("Invalid ExitState `%s`", j.ExitState))
 		}
 	}
 }
 
+func (j *Job) attempt() int {
+	if j.Attempt < 1 {
+		return 1
+	}
+	return j.Attempt
+}
+
 func (j *Job) Prefix() string {
 	return "jobs"
 }
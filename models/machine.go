@@ -4,6 +4,7 @@ import (
 	"net"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/pborman/uuid"
 )
@@ -46,6 +47,23 @@ func ArchEqual(a, b string) bool {
 	return aok && bok && a1 == b1
 }
 
+// AgentHeartbeat is what the machine agent periodically reports
+// about itself to show that it is still alive.
+// swagger:model
+type AgentHeartbeat struct {
+	// Version is the version of the agent.
+	Version string
+	// State is the state the agent is in, such as RUN_TASK or
+	// WAIT_FOR_RUNNABLE.
+	State string
+	// Uptime is the number of seconds the agent has been running.
+	Uptime int64
+	// BootTime is when the Machine last booted.
+	//
+	// swagger:strfmt date-time
+	BootTime time.Time
+}
+
 // Machine represents a single bare-metal system that the provisioner
 // should manage the boot environment for.
 // swagger:model
@@ -145,6 +163,18 @@ type Machine struct {
 	//
 	// required: true
 	Locked bool
+	// LastSeen is when the agent on the Machine last sent a heartbeat.
+	// It is read-only.
+	//
+	// swagger:strfmt date-time
+	LastSeen time.Time
+	// Liveness is "alive" while the agent on the Machine keeps sending
+	// heartbeats, and "stale" once it has stopped.  It is empty if the
+	// agent has never sent one.  It is read-only.
+	Liveness string
+	// Heartbeat is the last heartbeat the agent on the Machine sent.
+	// It is read-only.
+	Heartbeat AgentHeartbeat
 }
 
 func (n *Machine) IsLocked() bool {
@@ -182,6 +212,8 @@ func (n *Machine) Validate() {
 				n.AddError(ValidName("Invalid Stage", parts[1]))
 			case "bootenv":
 				n.AddError(ValidName("Invalid BootEnv", parts[1]))
+			case "parallel":
+				n.AddError(ValidParallelTasks(t))
 			case "chroot":
 			case "action":
 				pparts := strings.SplitN(parts[1], ":", 2)
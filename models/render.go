@@ -0,0 +1,29 @@
+package models
+
+// RenderResult is the result of a dry-run render of the templates
+// of a BootEnv, Stage, or Task against a Machine.  Nothing is saved
+// or registered in the dynamic file tree when generating it.
+// swagger:model
+type RenderResult struct {
+	// Prefix is the type of object that was rendered.  It will be
+	// one of bootenvs, stages, or tasks.
+	//
+	// required: true
+	Prefix string
+	// Name is the name of the object that was rendered.
+	//
+	// required: true
+	Name string
+	// Files contains everything that rendered successfully.  For a
+	// BootEnv or a Stage, Path is where the file would be served
+	// from the static file server.  For a Task, these are the job
+	// actions that the agent would receive.
+	//
+	// required: true
+	Files JobActions
+	// Errors contains any missing parameters and any template
+	// errors encountered while rendering.
+	//
+	// required: true
+	Errors []string
+}
@@ -25,7 +25,7 @@ var (
 	basicActions     = csm("list, get, create, delete, actions")
 
 	extraScopes = map[string]string{
-		"contents":   "list, get, create, update, delete",
+		"contents":   "list, get, create, update, delete, test",
 		"files":      "list, get, post, delete",
 		"interfaces": "list, get",
 		"info":       "get",
@@ -37,7 +37,7 @@ var (
 	addedActions = map[string]string{
 		"users":     "token, password",
 		"jobs":      "log",
-		"machines":  "getSecure, updateSecure, updateTaskList",
+		"machines":  "getSecure, updateSecure, updateTaskList, render, coordinate, heartbeat, inventory, console",
 		"plugins":   "getSecure, updateSecure",
 		"profiles":  "getSecure, updateSecure",
 		"stages":    "getSecure, updateSecure",
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// RolloutMachine tracks how a Rollout is going on one Machine.
+//
+// swagger:model
+type RolloutMachine struct {
+	// Machine is the UUID of the Machine.
+	//
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// Name is the name of the Machine when the Rollout was created.
+	Name string
+	// Wave is the wave the Machine is changed in, starting at 1.
+	Wave int
+	// State is one of "pending", "running", "succeeded", or "failed".
+	State string
+	// Job is the current Job of the Machine when the change was
+	// applied.  Only Jobs that come after it can fail the Machine.
+	//
+	// swagger:strfmt uuid
+	Job uuid.UUID
+	// Message says why the Machine failed.
+	Message string
+}
+
+// Rollout applies the same change to a set of Machines a few at a
+// time.  The Machines that match Filter when the Rollout is created
+// are split into waves of BatchSize Machines.  Each wave is changed,
+// and the next one is not started until every Machine in it has
+// either reached TargetStage or failed.  The Rollout halts once more
+// than MaxFailurePercent of the Machines it has changed have failed.
+//
+// swagger:model
+type Rollout struct {
+	Validation
+	Access
+	Meta
+	Owned
+	Bundled
+	// Name is the unique name of the Rollout.
+	//
+	// required: true
+	Name string
+	// Description is a one-line description of the Rollout.
+	Description string
+	// Documentation of this Rollout.  This should tell what the
+	// Rollout is for, any special considerations that should be taken
+	// into account when using it, etc. in rich structured text (rst).
+	Documentation string
+	// Filter selects the Machines the Rollout changes.  The keys are
+	// Machine index or param names, and the values use the same
+	// syntax as list filters, such as Eq(value) or Re(regex).  An
+	// empty Filter selects every Machine.
+	Filter map[string]string
+	// Workflow is the Workflow to put the Machines on.
+	Workflow string
+	// Stage is the Stage to put the Machines in.  It cannot be used
+	// along with Workflow.
+	Stage string
+	// Params are set on each Machine.
+	Params map[string]interface{}
+	// AddProfiles are added to each Machine.
+	AddProfiles []string
+	// RemoveProfiles are removed from each Machine.
+	RemoveProfiles []string
+	// BatchSize is how many Machines are changed in each wave.
+	//
+	// required: true
+	BatchSize int
+	// TargetStage is the Stage a Machine must reach for the change to
+	// have succeeded on it.  If it is empty, the Machine must finish
+	// all of its Tasks instead.
+	TargetStage string
+	// WaveTimeout is how many seconds a wave may take before the
+	// Machines in it that are not done are marked as failed.  0 means
+	// the waves may take as long as they need.
+	WaveTimeout int
+	// MaxFailurePercent is the percent of the changed Machines that
+	// may fail before the Rollout halts.
+	MaxFailurePercent int
+	// Paused Rollouts finish the wave they are on, but do not start
+	// any more of them.
+	Paused bool
+	// State is one of "running", "halted", or "finished".
+	//
+	// read only: true
+	State string
+	// Message says why the Rollout halted.
+	//
+	// read only: true
+	Message string
+	// Wave is the wave the Rollout is on, starting at 1.  It is 0
+	// until the first wave starts.
+	//
+	// read only: true
+	Wave int
+	// WaveStarted is when the current wave started.
+	//
+	// read only: true
+	WaveStarted time.Time
+	// Machines tracks how the Rollout is going on each of the
+	// Machines it changes.
+	//
+	// read only: true
+	Machines []RolloutMachine
+}
+
+func (r *Rollout) GetMeta() Meta {
+	return r.Meta
+}
+
+func (r *Rollout) SetMeta(d Meta) {
+	r.Meta = d
+}
+
+func (r *Rollout) GetDocumentation() string {
+	return r.Documentation
+}
+
+func (r *Rollout) Prefix() string {
+	return "rollouts"
+}
+
+func (r *Rollout) Key() string {
+	return r.Name
+}
+
+func (r *Rollout) KeyName() string {
+	return "Name"
+}
+
+func (r *Rollout) AuthKey() string {
+	return r.Key()
+}
+
+func (r *Rollout) Fill() {
+	r.Validation.fill()
+	if r.Meta == nil {
+		r.Meta = Meta{}
+	}
+	if r.Filter == nil {
+		r.Filter = map[string]string{}
+	}
+	if r.Params == nil {
+		r.Params = map[string]interface{}{}
+	}
+	if r.AddProfiles == nil {
+		r.AddProfiles = []string{}
+	}
+	if r.RemoveProfiles == nil {
+		r.RemoveProfiles = []string{}
+	}
+	if r.Machines == nil {
+		r.Machines = []RolloutMachine{}
+	}
+}
+
+func (r *Rollout) SliceOf() interface{} {
+	rs := []*Rollout{}
+	return &rs
+}
+
+func (r *Rollout) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*Rollout)
+	res := make([]Model, len(*items))
+	for i, item := range *items {
+		res[i] = Model(item)
+	}
+	return res
+}
+
+func (r *Rollout) Validate() {
+	r.AddError(ValidName("Invalid Name", r.Name))
+	if r.Workflow != "" {
+		r.AddError(ValidName("Invalid Workflow", r.Workflow))
+		if r.Stage != "" {
+			r.Errorf("Rollout %s cannot set both a Workflow and a Stage", r.Name)
+		}
+	}
+	if r.Stage != "" {
+		r.AddError(ValidName("Invalid Stage", r.Stage))
+	}
+	if r.TargetStage != "" {
+		r.AddError(ValidName("Invalid TargetStage", r.TargetStage))
+	}
+	for _, p := range r.AddProfiles {
+		r.AddError(ValidName("Invalid Profile", p))
+	}
+	for _, p := range r.RemoveProfiles {
+		r.AddError(ValidName("Invalid Profile", p))
+	}
+	if r.Workflow == "" && r.Stage == "" && len(r.Params) == 0 &&
+		len(r.AddProfiles) == 0 && len(r.RemoveProfiles) == 0 {
+		r.Errorf("Rollout %s does not change anything", r.Name)
+	}
+	if r.BatchSize < 1 {
+		r.Errorf("BatchSize must be at least 1")
+	}
+	if r.WaveTimeout < 0 {
+		r.Errorf("WaveTimeout must not be negative")
+	}
+	if r.MaxFailurePercent < 0 || r.MaxFailurePercent > 100 {
+		r.Errorf("MaxFailurePercent must be between 0 and 100")
+	}
+}
+
+// Counts returns how many of the Machines in the Rollout are in each
+// state.
+func (r *Rollout) Counts() map[string]int {
+	res := map[string]int{}
+	for _, m := range r.Machines {
+		res[m.State]++
+	}
+	return res
+}
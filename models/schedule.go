@@ -0,0 +1,198 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// ScheduleWindow is a maintenance window that a Schedule may start
+// Machines in.  It opens whenever Cron matches, and stays open for
+// Duration minutes.
+//
+// swagger:model
+type ScheduleWindow struct {
+	// Cron is when the window opens.
+	//
+	// required: true
+	Cron string
+	// Duration is how many minutes the window stays open.
+	//
+	// required: true
+	Duration int
+}
+
+// Open returns whether the window is open at t.
+func (w *ScheduleWindow) Open(t time.Time) bool {
+	spec, err := ParseCron(w.Cron)
+	if err != nil {
+		return false
+	}
+	opened := spec.Next(t.Add(-time.Duration(w.Duration) * time.Minute))
+	return !opened.IsZero() && !opened.After(t)
+}
+
+// Schedule runs a Workflow on the Machines that match its Filter
+// whenever its Cron expression says it should.  Only Machines that
+// are idle when the Schedule fires are picked, and they are started
+// a few at a time if MaxConcurrent is set.
+//
+// swagger:model
+type Schedule struct {
+	Validation
+	Access
+	Meta
+	Owned
+	Bundled
+	// Name is the unique name of the Schedule.
+	//
+	// required: true
+	Name string
+	// Description is a one-line description of the Schedule.
+	Description string
+	// Documentation of this Schedule.  This should tell what the
+	// Schedule is for, any special considerations that should be
+	// taken into account when using it, etc. in rich structured text
+	// (rst).
+	Documentation string
+	// Cron is when the Schedule fires, as a five field cron
+	// expression (minute, hour, day of month, month, and day of week)
+	// in the local time of the server.  The @hourly, @daily, @weekly,
+	// @monthly, and @yearly shortcuts are also allowed.
+	//
+	// required: true
+	Cron string
+	// Filter selects the Machines the Schedule runs on.  The keys are
+	// Machine index or param names, and the values use the same
+	// syntax as list filters, such as Eq(value) or Re(regex).  An
+	// empty Filter selects every Machine.
+	Filter map[string]string
+	// Workflow is the Workflow that is run on the selected Machines.
+	//
+	// required: true
+	Workflow string
+	// MaxConcurrent is the most Machines that may be running the
+	// Workflow for this Schedule at once.  0 means there is no limit.
+	MaxConcurrent int
+	// Windows are the maintenance windows that Machines may be
+	// started in.  If there are none, Machines may be started at any
+	// time.
+	Windows []ScheduleWindow
+	// Paused Schedules do not fire or start Machines.
+	Paused bool
+	// LastRun is when the Schedule last fired.
+	//
+	// read only: true
+	LastRun time.Time
+	// NextRun is when the Schedule will fire next.
+	//
+	// read only: true
+	NextRun time.Time
+	// Pending are the Machines picked the last time the Schedule
+	// fired that have not been started yet.
+	//
+	// read only: true
+	Pending []uuid.UUID
+	// Running are the Machines the Schedule has started that have
+	// not finished the Workflow yet.
+	//
+	// read only: true
+	Running []uuid.UUID
+}
+
+func (s *Schedule) GetMeta() Meta {
+	return s.Meta
+}
+
+func (s *Schedule) SetMeta(d Meta) {
+	s.Meta = d
+}
+
+func (s *Schedule) GetDocumentation() string {
+	return s.Documentation
+}
+
+func (s *Schedule) Prefix() string {
+	return "schedules"
+}
+
+func (s *Schedule) Key() string {
+	return s.Name
+}
+
+func (s *Schedule) KeyName() string {
+	return "Name"
+}
+
+func (s *Schedule) AuthKey() string {
+	return s.Key()
+}
+
+func (s *Schedule) Fill() {
+	s.Validation.fill()
+	if s.Meta == nil {
+		s.Meta = Meta{}
+	}
+	if s.Filter == nil {
+		s.Filter = map[string]string{}
+	}
+	if s.Windows == nil {
+		s.Windows = []ScheduleWindow{}
+	}
+	if s.Pending == nil {
+		s.Pending = []uuid.UUID{}
+	}
+	if s.Running == nil {
+		s.Running = []uuid.UUID{}
+	}
+}
+
+func (s *Schedule) SliceOf() interface{} {
+	ss := []*Schedule{}
+	return &ss
+}
+
+func (s *Schedule) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*Schedule)
+	res := make([]Model, len(*items))
+	for i, item := range *items {
+		res[i] = Model(item)
+	}
+	return res
+}
+
+func (s *Schedule) Validate() {
+	s.AddError(ValidName("Invalid Name", s.Name))
+	if _, err := ParseCron(s.Cron); err != nil {
+		s.AddError(err)
+	}
+	if s.Workflow == "" {
+		s.Errorf("Schedule %s must have a Workflow", s.Name)
+	} else {
+		s.AddError(ValidName("Invalid Workflow", s.Workflow))
+	}
+	if s.MaxConcurrent < 0 {
+		s.Errorf("MaxConcurrent must not be negative")
+	}
+	for i, w := range s.Windows {
+		if _, err := ParseCron(w.Cron); err != nil {
+			s.Errorf("Window %d: %v", i, err)
+		}
+		if w.Duration < 1 {
+			s.Errorf("Window %d must last at least one minute", i)
+		}
+	}
+}
+
+// InWindow returns whether the Schedule may start Machines at t.
+func (s *Schedule) InWindow(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	for i := range s.Windows {
+		if s.Windows[i].Open(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package models
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // Stage encapsulates a set of tasks and profiles to apply
 // to a Machine in a BootEnv.
@@ -52,7 +55,10 @@ type Stage struct {
 	//
 	// required: true
 	BootEnv string
-	// The list of initial machine tasks that the stage should run
+	// The list of initial machine tasks that the stage should run.
+	// An entry of the form "parallel:task1,task2" is a group of
+	// Tasks that the agent runs at the same time, each with its own
+	// Job.  The group finishes when all of them have finished.
 	Tasks []string
 	// The list of profiles a machine should use while in this stage.
 	// These are used after machine profiles, but before global.
@@ -63,6 +69,10 @@ type Stage struct {
 	Reboot bool
 	// This flag is deprecated and will always be TRUE.
 	RunnerWait bool
+	// Timeout is the number of seconds a Job for a Task in this
+	// Stage may run if the Task does not set its own Timeout.  If it
+	// is 0, Jobs may run for as long as they like.
+	Timeout int
 }
 
 func (s *Stage) GetMeta() Meta {
@@ -79,6 +89,9 @@ func (s *Stage) GetDocumentation() string {
 
 func (s *Stage) Validate() {
 	s.AddError(ValidName("Invalid Name", s.Name))
+	if s.Timeout < 0 {
+		s.Errorf("Timeout must not be negative")
+	}
 	if s.BootEnv != "" {
 		s.AddError(ValidName("Invalid BootEnv", s.BootEnv))
 	}
@@ -115,6 +128,8 @@ func (s *Stage) Validate() {
 				}
 				s.AddError(ValidName("Invalid Plugin", pparts[0]))
 				s.AddError(ValidName("Invalid Action", pparts[1]))
+			case "parallel":
+				s.AddError(ValidParallelTasks(t))
 			case "chroot":
 			case "bootenv":
 			case "stage":
@@ -207,6 +222,39 @@ func (s *Stage) SetBootEnv(be string) {
 	s.BootEnv = be
 }
 
+// ParallelTasks returns the names of the Tasks in a "parallel:" task
+// list entry, or nil if ent is not a parallel task group.
+func ParallelTasks(ent string) []string {
+	if !strings.HasPrefix(ent, "parallel:") {
+		return nil
+	}
+	res := strings.Split(strings.TrimPrefix(ent, "parallel:"), ",")
+	for i := range res {
+		res[i] = strings.TrimSpace(res[i])
+	}
+	return res
+}
+
+// ValidParallelTasks checks that a "parallel:" task list entry names
+// at least two distinct, valid Tasks.
+func ValidParallelTasks(ent string) error {
+	names := ParallelTasks(ent)
+	if len(names) < 2 {
+		return fmt.Errorf("Parallel task group %s needs at least two Tasks", ent)
+	}
+	seen := map[string]struct{}{}
+	for _, name := range names {
+		if err := ValidName("Invalid Task", name); err != nil {
+			return err
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("Parallel task group %s has Task %s more than once", ent, name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
 // match TaskRunner interface
 func (s *Stage) GetTasks() []string {
 	return s.Tasks
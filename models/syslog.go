@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// SyslogMessage is a message received from a Machine over syslog or
+// netconsole.
+// swagger:model
+type SyslogMessage struct {
+	// Source is how the message was received, either syslog or
+	// netconsole.
+	Source string
+	// Facility is the syslog facility of the message.
+	Facility int
+	// Severity is the syslog severity of the message, from 0 for
+	// emergency to 7 for debug.  Messages that did not have one are
+	// notice (5).
+	Severity int
+	// Time is the timestamp the sender put in the message, or when
+	// it was received if it did not have one.
+	Time time.Time
+	// Received is when the message was received.
+	Received time.Time
+	// Hostname is the host name the sender put in the message.
+	Hostname string
+	// App is the name of the program that sent the message.
+	App string
+	// ProcID is the process ID of the program that sent the message.
+	ProcID string
+	// MsgID is the RFC 5424 type of the message.
+	MsgID string
+	// Message is the text of the message.
+	Message string
+}
+
+// IsError returns true if the Severity of the message is error or
+// worse.
+func (s *SyslogMessage) IsError() bool {
+	return s.Severity <= 3
+}
@@ -1,10 +1,156 @@
 package models
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// RetryPolicy describes how Jobs for a Task that fail are retried
+// before the Machine is marked as not Runnable.
+//
+// swagger:model
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a Job for the Task will be
+	// attempted in a row before giving up.  0 and 1 both mean that
+	// failed Jobs are not retried.
+	MaxAttempts int
+	// Backoff is the number of seconds to wait before each retry.
+	// The first entry is used before the second attempt, the second
+	// entry before the third attempt, and so on.  The last entry is
+	// used for all the attempts after that.  If it is empty, failed
+	// Jobs are retried right away.
+	Backoff []int
+	// ExitCodes are the exit codes from the Task's scripts that
+	// should be retried.
+	ExitCodes []int
+	// ExitStates are the Job ExitStates that should be retried,
+	// such as "failed" or "timeout".  If both ExitCodes and
+	// ExitStates are empty, every failure is retried.
+	ExitStates []string
+}
+
+// ExitCodeMapping maps exit codes from the scripts of a Task to what
+// they mean for the Job.
+//
+// swagger:model
+type ExitCodeMapping struct {
+	// Codes is the exit code, such as "3", or the inclusive range of
+	// exit codes, such as "100-199", that this mapping applies to.
+	//
+	// required: true
+	Codes string
+	// Outcomes is what the exit codes mean.  It is either one of
+	// success, failed, or retry, or one or more of incomplete and one
+	// of reboot, poweroff, or stop.  retry fails the Job and retries
+	// it according to the Retry policy of the Task, whatever its
+	// ExitCodes and ExitStates say.
+	//
+	// required: true
+	Outcomes []string
+}
+
+var exitOutcomes = map[string]struct{}{
+	"success":    struct{}{},
+	"failed":     struct{}{},
+	"retry":      struct{}{},
+	"incomplete": struct{}{},
+	"reboot":     struct{}{},
+	"poweroff":   struct{}{},
+	"stop":       struct{}{},
+}
+
+// Range returns the lowest and highest exit codes the mapping
+// applies to.
+func (e *ExitCodeMapping) Range() (lo, hi int, err error) {
+	parts := strings.SplitN(e.Codes, "-", 2)
+	if lo, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, fmt.Errorf("Invalid exit code %s", e.Codes)
+	}
+	hi = lo
+	if len(parts) == 2 {
+		if hi, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, fmt.Errorf("Invalid exit code range %s", e.Codes)
+		}
+	}
+	if lo < 0 || hi > 255 || lo > hi {
+		return 0, 0, fmt.Errorf("Invalid exit code range %s", e.Codes)
+	}
+	return lo, hi, nil
+}
+
+// validate checks that the mapping has a valid range and a sensible
+// combination of outcomes.
+func (e *ExitCodeMapping) validate() error {
+	if _, _, err := e.Range(); err != nil {
+		return err
+	}
+	if len(e.Outcomes) == 0 {
+		return fmt.Errorf("%s: no outcomes", e.Codes)
+	}
+	seen := map[string]bool{}
+	power := 0
+	for _, o := range e.Outcomes {
+		if _, ok := exitOutcomes[o]; !ok {
+			return fmt.Errorf("%s: invalid outcome %s", e.Codes, o)
+		}
+		if seen[o] {
+			return fmt.Errorf("%s: outcome %s given more than once", e.Codes, o)
+		}
+		seen[o] = true
+		switch o {
+		case "reboot", "poweroff", "stop":
+			power++
+		}
+	}
+	if (seen["success"] || seen["failed"] || seen["retry"]) && len(e.Outcomes) > 1 {
+		return fmt.Errorf("%s: success, failed, and retry cannot be combined with other outcomes", e.Codes)
+	}
+	if power > 1 {
+		return fmt.Errorf("%s: only one of reboot, poweroff, and stop can be given", e.Codes)
+	}
+	return nil
+}
+
+// TaskSandbox describes the limits the agent places on the scripts
+// of a Task.  Sandboxes are only supported by agents running on
+// Linux, and the resource limits need cgroup v2.  A Job for a Task
+// with a sandbox the agent cannot set up fails.
+//
+// swagger:model
+type TaskSandbox struct {
+	// MemoryMax is the number of bytes of memory the scripts of the
+	// Task may use together.  0 means no limit.
+	MemoryMax int64
+	// CPUPercent is how much CPU time the scripts of the Task may use
+	// together, as a percentage of one CPU.  200 lets them use two
+	// CPUs.  0 means no limit.
+	CPUPercent int
+	// PidsMax is the number of processes and threads the scripts of
+	// the Task may have at once.  0 means no limit.
+	PidsMax int
+	// PIDNamespace runs each script in its own PID namespace, so
+	// that everything it starts is killed when it exits.
+	PIDNamespace bool
+	// MountNamespace runs each script in its own mount namespace, so
+	// that what it mounts is not seen outside of it and goes away
+	// when it exits.
+	MountNamespace bool
+}
+
+// Limited returns whether the sandbox places any resource limits on
+// the scripts of the Task.
+func (s *TaskSandbox) Limited() bool {
+	return s.MemoryMax != 0 || s.CPUPercent != 0 || s.PidsMax != 0
+}
+
+// Enabled returns whether the Task needs a sandbox at all.
+func (s *TaskSandbox) Enabled() bool {
+	return s.Limited() || s.PIDNamespace || s.MountNamespace
+}
+
 // Task is a thing that can run on a Machine.
 //
 // swagger:model
@@ -39,6 +185,20 @@ type Task struct {
 	// Prerequisites are tasks that must have been run in the current
 	// BootEnv before this task can be run.
 	Prerequisites []string
+	// Timeout is the number of seconds a Job for this Task may run
+	// before the agent kills it and the Job is marked as failed.  If
+	// it is 0, the Timeout of the Stage the Job runs in is used.
+	Timeout int
+	// Retry controls whether failed Jobs for this Task are retried.
+	Retry RetryPolicy
+	// Sandbox limits the resources the scripts of the Task can use,
+	// and what they can see of the rest of the system.
+	Sandbox TaskSandbox
+	// ExitCodeMap overrides what the exit codes of the scripts of the
+	// Task mean.  The first mapping that has an exit code decides
+	// what it means.  Exit codes that none of them have keep their
+	// usual meaning.
+	ExitCodeMap []ExitCodeMapping
 }
 
 var (
@@ -75,6 +235,49 @@ func (t *Task) GetDocumentation() string {
 
 func (t *Task) Validate() {
 	t.AddError(ValidName("Invalid Name", t.Name))
+	if t.Timeout < 0 {
+		t.Errorf("Timeout must not be negative")
+	}
+	if t.Retry.MaxAttempts < 0 {
+		t.Errorf("Retry.MaxAttempts must not be negative")
+	}
+	for _, b := range t.Retry.Backoff {
+		if b < 0 {
+			t.Errorf("Retry.Backoff must not be negative")
+			break
+		}
+	}
+	for _, c := range t.Retry.ExitCodes {
+		if c < 0 || c > 255 {
+			t.Errorf("Retry.ExitCodes: invalid exit code %d", c)
+		}
+	}
+	for _, s := range t.Retry.ExitStates {
+		switch s {
+		case "failed", "timeout":
+		default:
+			t.Errorf("Retry.ExitStates: %s cannot be retried", s)
+		}
+	}
+	if t.Sandbox.MemoryMax < 0 {
+		t.Errorf("Sandbox.MemoryMax must not be negative")
+	}
+	if t.Sandbox.CPUPercent < 0 {
+		t.Errorf("Sandbox.CPUPercent must not be negative")
+	}
+	if t.Sandbox.PidsMax < 0 {
+		t.Errorf("Sandbox.PidsMax must not be negative")
+	}
+	for i := range t.ExitCodeMap {
+		m := &t.ExitCodeMap[i]
+		if err := m.validate(); err != nil {
+			t.Errorf("ExitCodeMap[%d]: %v", i, err)
+			continue
+		}
+		if m.Outcomes[0] == "retry" && t.Retry.MaxAttempts < 2 {
+			t.Errorf("ExitCodeMap[%d]: retry needs Retry.MaxAttempts to be at least 2", i)
+		}
+	}
 
 	for _, p := range t.RequiredParams {
 		t.AddError(ValidParamName("Invalid Required Param", p))
@@ -155,6 +358,77 @@ func (t *Task) Fill() {
 	if t.Prerequisites == nil {
 		t.Prerequisites = []string{}
 	}
+	if t.Retry.Backoff == nil {
+		t.Retry.Backoff = []int{}
+	}
+	if t.Retry.ExitCodes == nil {
+		t.Retry.ExitCodes = []int{}
+	}
+	if t.Retry.ExitStates == nil {
+		t.Retry.ExitStates = []string{}
+	}
+	if t.ExitCodeMap == nil {
+		t.ExitCodeMap = []ExitCodeMapping{}
+	}
+	for i := range t.ExitCodeMap {
+		if t.ExitCodeMap[i].Outcomes == nil {
+			t.ExitCodeMap[i].Outcomes = []string{}
+		}
+	}
+}
+
+// ExitOutcomes returns the Outcomes of the first mapping in the
+// ExitCodeMap of the Task that has code, and whether there was one.
+func (t *Task) ExitOutcomes(code int) ([]string, bool) {
+	for i := range t.ExitCodeMap {
+		lo, hi, err := t.ExitCodeMap[i].Range()
+		if err == nil && lo <= code && code <= hi {
+			return t.ExitCodeMap[i].Outcomes, true
+		}
+	}
+	return nil, false
+}
+
+// ShouldRetry returns whether j, a failed Job for this Task, should be
+// retried according to the Task's RetryPolicy.
+func (t *Task) ShouldRetry(j *Job) bool {
+	p := &t.Retry
+	if j.State != "failed" || j.attempt() >= p.MaxAttempts {
+		return false
+	}
+	if j.ExitState == "retry" {
+		return true
+	}
+	if len(p.ExitCodes) == 0 && len(p.ExitStates) == 0 {
+		return true
+	}
+	for _, s := range p.ExitStates {
+		if s == j.ExitState {
+			return true
+		}
+	}
+	if j.ExitState == "failed" {
+		for _, c := range p.ExitCodes {
+			if c == j.ExitCode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RetryDelay returns how long to wait after j, a failed Job for this
+// Task, before retrying it.
+func (t *Task) RetryDelay(j *Job) time.Duration {
+	backoff := t.Retry.Backoff
+	if len(backoff) == 0 {
+		return 0
+	}
+	i := j.attempt() - 1
+	if i >= len(backoff) {
+		i = len(backoff) - 1
+	}
+	return time.Duration(backoff[i]) * time.Second
 }
 
 func (t *Task) AuthKey() string {
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskRetryPolicy(t *testing.T) {
+	task := &Task{
+		Name: "flaky",
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     []int{10, 60},
+			ExitCodes:   []int{75},
+			ExitStates:  []string{"timeout"},
+		},
+	}
+	for _, c := range []struct {
+		state, exitState string
+		attempt, code    int
+		retry            bool
+		delay            time.Duration
+	}{
+		{"failed", "failed", 1, 75, true, 10 * time.Second},
+		{"failed", "failed", 0, 75, true, 10 * time.Second},
+		{"failed", "timeout", 2, 0, true, 60 * time.Second},
+		{"failed", "failed", 2, 1, false, 60 * time.Second},
+		{"failed", "failed", 3, 75, false, 60 * time.Second},
+		{"finished", "complete", 1, 0, false, 10 * time.Second},
+	} {
+		j := &Job{State: c.state, ExitState: c.exitState, Attempt: c.attempt, ExitCode: c.code}
+		if retry := task.ShouldRetry(j); retry != c.retry {
+			t.Errorf("ERROR: %s:%s attempt %d code %d: expected retry %v, got %v", c.state, c.exitState, c.attempt, c.code, c.retry, retry)
+		}
+		if delay := task.RetryDelay(j); delay != c.delay {
+			t.Errorf("ERROR: attempt %d: expected delay %s, got %s", c.attempt, c.delay, delay)
+		}
+	}
+	task.Retry.ExitCodes = nil
+	task.Retry.ExitStates = nil
+	if !task.ShouldRetry(&Job{State: "failed", ExitState: "failed", Attempt: 1, ExitCode: 1}) {
+		t.Errorf("ERROR: Expected an empty RetryPolicy filter to retry every failure")
+	}
+	task.Retry.ExitStates = []string{"reboot"}
+	task.Retry.Backoff = []int{-1}
+	task.Validate()
+	if len(task.Errors) != 2 {
+		t.Errorf("ERROR: Expected 2 validation errors, got %v", task.Errors)
+	}
+}
+
+func TestTaskSandbox(t *testing.T) {
+	task := &Task{Name: "limited"}
+	if task.Sandbox.Enabled() {
+		t.Errorf("ERROR: Expected an empty sandbox to be disabled")
+	}
+	task.Sandbox.PIDNamespace = true
+	if !task.Sandbox.Enabled() || task.Sandbox.Limited() {
+		t.Errorf("ERROR: Expected a namespace only sandbox to be enabled without limits")
+	}
+	task.Sandbox.PidsMax = 64
+	if !task.Sandbox.Limited() {
+		t.Errorf("ERROR: Expected a sandbox with PidsMax to be limited")
+	}
+	task.Sandbox.MemoryMax = -1
+	task.Sandbox.CPUPercent = -50
+	task.Validate()
+	if len(task.Errors) != 2 {
+		t.Errorf("ERROR: Expected 2 validation errors, got %v", task.Errors)
+	}
+}
+
+func TestTaskExitCodeMap(t *testing.T) {
+	task := &Task{
+		Name:  "installer",
+		Retry: RetryPolicy{MaxAttempts: 3},
+		ExitCodeMap: []ExitCodeMapping{
+			{Codes: "3010", Outcomes: []string{"reboot"}},
+			{Codes: "1", Outcomes: []string{"success"}},
+			{Codes: "100-199", Outcomes: []string{"incomplete", "reboot"}},
+			{Codes: "150", Outcomes: []string{"failed"}},
+			{Codes: "200-", Outcomes: []string{"retry"}},
+			{Codes: "75", Outcomes: []string{"retry"}},
+			{Codes: "76", Outcomes: []string{"success", "reboot"}},
+			{Codes: "77", Outcomes: []string{"reboot", "stop"}},
+			{Codes: "78", Outcomes: []string{"explode"}},
+			{Codes: "79"},
+		},
+	}
+	task.Validate()
+	if len(task.Errors) != 6 {
+		t.Errorf("ERROR: Expected 6 validation errors, got %v", task.Errors)
+	}
+	for _, c := range []struct {
+		code     int
+		outcomes string
+		ok       bool
+	}{
+		{1, "success", true},
+		{0, "", false},
+		{100, "incomplete,reboot", true},
+		{150, "incomplete,reboot", true},
+		{75, "retry", true},
+		{2, "", false},
+	} {
+		outcomes, ok := task.ExitOutcomes(c.code)
+		if ok != c.ok || strings.Join(outcomes, ",") != c.outcomes {
+			t.Errorf("ERROR: exit code %d: expected %q %v, got %q %v", c.code, c.outcomes, c.ok, outcomes, ok)
+		}
+	}
+	j := &Job{State: "failed", ExitState: "retry", Attempt: 1, ExitCode: 75}
+	task.Retry.ExitStates = []string{"timeout"}
+	if !task.ShouldRetry(j) {
+		t.Errorf("ERROR: Expected a retry exit state to be retried whatever the RetryPolicy filters say")
+	}
+	j.Attempt = 3
+	if task.ShouldRetry(j) {
+		t.Errorf("ERROR: Expected a retry exit state to stop being retried after MaxAttempts")
+	}
+}
@@ -0,0 +1,124 @@
+package models
+
+import "sort"
+
+// TemplateTestSection is the section of a content bundle that carries
+// its TemplateTests.  It is not loaded into dr-provision along with
+// the rest of the bundle.
+const TemplateTestSection = "tests"
+
+// TemplateTestExpect describes what a single rendered file or job
+// action is expected to look like.
+type TemplateTestExpect struct {
+	// Name is the name of the template that generated the output.
+	// Either Name or Path must be set.
+	Name string
+	// Path is the path the rendered output would be served at or
+	// written to.  Either Name or Path must be set.
+	Path string
+	// Content, if set, must exactly match the rendered output.
+	Content string
+	// Matches is a list of regular expressions that must all match
+	// the rendered output.
+	Matches []string
+	// NotMatches is a list of regular expressions that must not
+	// match the rendered output.
+	NotMatches []string
+}
+
+// TemplateTest is a unit test for the templates in a content bundle.
+// Template tests live in the tests directory of a content bundle
+// source tree alongside the templates, tasks, and stages they test,
+// and are carried in the tests section of the bundle.
+// Each test renders the BootEnv, Stage, and Task it names against a
+// fixture Machine and compares the results with what is expected.
+type TemplateTest struct {
+	// Name is the name of the test.
+	//
+	// required: true
+	Name string
+	// Description is a short description of what is being tested.
+	Description string
+	// Machine is the fixture machine to render against.  If it is
+	// not set, a machine with a random UUID named after the test
+	// will be used.
+	Machine *Machine
+	// Params will be added to the fixture machine's Params.
+	Params map[string]interface{}
+	// Profiles will be created before the test runs and added to
+	// the fixture machine's Profiles.
+	Profiles []*Profile
+	// BootEnv is the BootEnv to render.  Defaults to the one on
+	// the fixture machine.
+	BootEnv string
+	// Stage is the Stage to render.  Defaults to the one on the
+	// fixture machine.
+	Stage string
+	// Task is the Task to render, if any.
+	Task string
+	// Expect is the list of rendered outputs to check.
+	Expect []TemplateTestExpect
+	// ExpectErrors is a list of regular expressions that render
+	// errors must match.  If it is empty, any render error fails
+	// the test.
+	ExpectErrors []string
+}
+
+// TemplateTestRun is a content bundle and the TemplateTests to run
+// against it.
+type TemplateTestRun struct {
+	// Content is the content bundle to test.
+	//
+	// required: true
+	Content *Content
+	// Tests are the TemplateTests to run.  If it is empty, the tests
+	// carried in Content are run instead.
+	Tests []*TemplateTest
+}
+
+// TemplateTestResult is the outcome of a single TemplateTest.
+type TemplateTestResult struct {
+	// Name is the name of the test.
+	Name string
+	// Passed is true if every expectation was satisfied.
+	Passed bool
+	// Failures contains a description of every failed expectation,
+	// including a diff for Content mismatches.
+	Failures []string
+}
+
+// TemplateTestReport summarizes a run of the TemplateTests for a
+// content bundle.
+type TemplateTestReport struct {
+	// Results holds the results of each individual test.
+	Results []*TemplateTestResult
+	// Passed is the number of tests that passed.
+	Passed int
+	// Failed is the number of tests that failed.
+	Failed int
+	// Covered contains the templates in the content bundle that were
+	// rendered by at least one test, either directly or by being
+	// included from another template.
+	Covered []string
+	// Uncovered contains the templates in the content bundle that no
+	// test rendered.
+	Uncovered []string
+	// Coverage is the percentage of templates in the content bundle
+	// that were rendered by the tests.
+	Coverage float64
+}
+
+// TemplateTests returns the TemplateTests carried in the tests
+// section of the content bundle, sorted by name.
+func (c *Content) TemplateTests() ([]*TemplateTest, error) {
+	res := []*TemplateTest{}
+	for _, v := range c.Sections[TemplateTestSection] {
+		test := &TemplateTest{}
+		if err := Remarshal(v, test); err != nil {
+			return nil, err
+		}
+		res = append(res, test)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
@@ -82,6 +82,9 @@ func All() []Model {
 		&User{},
 		&Workflow{},
 		&Tenant{},
+		&Schedule{},
+		&Rollout{},
+		&Inventory{},
 	}
 }
 
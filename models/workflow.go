@@ -1,5 +1,37 @@
 package models
 
+import (
+	"fmt"
+	"reflect"
+)
+
+// WorkflowTransition sends a Machine to a different Stage than the
+// next one in its Workflow when it leaves a Stage.
+//
+// swagger:model
+type WorkflowTransition struct {
+	// From is the Stage the Machine is leaving.
+	//
+	// required: true
+	From string
+	// To is the Stage the Machine goes to.  If To is one of the
+	// Workflow's Stages, the Workflow carries on from there.
+	// Otherwise, the Machine only runs the Tasks in To.
+	//
+	// required: true
+	To string
+	// Result is "success" if the transition should be taken when
+	// all the Tasks in From finished, "failure" if it should be
+	// taken when one of them failed and will not be retried, or
+	// empty if it should be taken either way.
+	Result string
+	// Param, if set, is the name of a Param that the Machine must
+	// have set to Value for the transition to be taken.
+	Param string
+	// Value is what Param must be set to.
+	Value interface{}
+}
+
 // Workflow contains a list of Stages. When it is applied to a Machine,
 // that machine's Tasks list is populated with the contents of the Stages in the Workflow.
 //
@@ -14,6 +46,12 @@ type Workflow struct {
 	Description   string
 	Documentation string
 	Stages        []string
+	// Transitions are checked in order whenever a Machine leaves a
+	// Stage, and the first one that matches picks the next Stage.
+	Transitions []WorkflowTransition
+	// OnFailure is the Stage a Machine goes to when a Task fails and
+	// will not be retried, and no failure Transition matches.
+	OnFailure string
 }
 
 func (w *Workflow) GetMeta() Meta {
@@ -47,6 +85,9 @@ func (w *Workflow) Fill() {
 	if w.Stages == nil {
 		w.Stages = []string{}
 	}
+	if w.Transitions == nil {
+		w.Transitions = []WorkflowTransition{}
+	}
 }
 
 func (w *Workflow) AuthKey() string {
@@ -72,6 +113,41 @@ func (w *Workflow) Validate() {
 	for _, stageName := range w.Stages {
 		w.AddError(ValidName("Invalid Stage Name", stageName))
 	}
+	for i, t := range w.Transitions {
+		prefix := fmt.Sprintf("Transition[%d]: ", i)
+		w.AddError(ValidName(prefix+"Invalid From", t.From))
+		w.AddError(ValidName(prefix+"Invalid To", t.To))
+		switch t.Result {
+		case "", "success", "failure":
+		default:
+			w.Errorf("%sInvalid Result `%s`", prefix, t.Result)
+		}
+		if t.Param == "" && t.Value != nil {
+			w.Errorf("%sValue needs a Param", prefix)
+		} else if t.Param != "" {
+			w.AddError(ValidParamName(prefix+"Invalid Param", t.Param))
+		}
+	}
+	if w.OnFailure != "" {
+		w.AddError(ValidName("Invalid OnFailure", w.OnFailure))
+	}
+}
+
+// Matches returns whether the transition should be taken when
+// leaving from with result, given the value of the transition's
+// Param on the Machine.
+func (t *WorkflowTransition) Matches(from, result string, param interface{}) bool {
+	if t.From != from || (t.Result != "" && t.Result != result) {
+		return false
+	}
+	if t.Param == "" {
+		return true
+	}
+	var want, have interface{}
+	if Remarshal(t.Value, &want) != nil || Remarshal(param, &have) != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, have)
 }
 
 func (w *Workflow) CanHaveActions() bool {
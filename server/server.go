@@ -124,6 +124,25 @@ type ProgOpts struct {
 	PromGwURL      string `long:"prometheus-gateway-url" description:"URL to push metrics to" default:"" env:"RS_PROM_GW_URL"`
 	PromInterval   int    `long:"prometheus-interval" description:"Duration in seconds to push metrics" default:"5" env:"RS_PROM_INTERVAL"`
 	CleanupCorrupt bool   `long:"cleanup" description:"Clean up corrupted writable data.  Only use when directed." env:"RS_CLEANUP_CORRUPT"`
+
+	RenderTimeout  int   `long:"render-timeout" description:"Time in seconds a template may take to render" default:"30" env:"RS_RENDER_TIMEOUT"`
+	RenderMaxSize  int64 `long:"render-max-size" description:"Maximum size in bytes of a rendered template" default:"67108864" env:"RS_RENDER_MAX_SIZE"`
+	RenderMaxDepth int   `long:"render-max-depth" description:"Maximum nesting depth of CallTemplate" default:"32" env:"RS_RENDER_MAX_DEPTH"`
+
+	ArtifactMaxSize  int64 `long:"artifact-max-size" description:"Maximum size in bytes of a job artifact" default:"67108864" env:"RS_ARTIFACT_MAX_SIZE"`
+	ArtifactMaxTotal int64 `long:"artifact-max-total" description:"Maximum size in bytes of all the artifacts of a job" default:"268435456" env:"RS_ARTIFACT_MAX_TOTAL"`
+
+	JobLogCompressAge   int    `long:"job-log-compress-age" description:"Hours after a job is done to compress its log.  0 never compresses logs" default:"0" env:"RS_JOB_LOG_COMPRESS_AGE"`
+	JobLogMaxAge        int    `long:"job-log-max-age" description:"Days after a job is done to remove or archive it.  0 keeps jobs forever" default:"0" env:"RS_JOB_LOG_MAX_AGE"`
+	JobLogMaxPerMachine int    `long:"job-log-max-per-machine" description:"Number of done jobs to keep the logs of for each machine.  0 keeps them all" default:"0" env:"RS_JOB_LOG_MAX_PER_MACHINE"`
+	JobLogMaxTotal      int64  `long:"job-log-max-total" description:"Maximum size in bytes of all job logs and artifacts.  0 has no limit" default:"0" env:"RS_JOB_LOG_MAX_TOTAL"`
+	JobLogArchiveRoot   string `long:"job-log-archive-root" description:"Directory to archive the logs of old jobs in instead of removing the jobs" default:"" env:"RS_JOB_LOG_ARCHIVE_ROOT"`
+
+	HeartbeatStale int `long:"agent-heartbeat-stale" description:"Seconds after its last heartbeat to consider a machine agent unresponsive" default:"90" env:"RS_AGENT_HEARTBEAT_STALE"`
+
+	NetconsolePort int   `long:"netconsole-port" description:"UDP port to receive machine netconsole output on.  0 disables it" default:"0" env:"RS_NETCONSOLE_PORT"`
+	SyslogPort     int   `long:"syslog-port" description:"UDP and TCP port to receive machine syslog messages on.  0 disables it" default:"0" env:"RS_SYSLOG_PORT"`
+	ConsoleMaxSize int64 `long:"console-max-size" description:"Maximum size in bytes of the console output kept for each machine" default:"1048576" env:"RS_CONSOLE_MAX_SIZE"`
 }
 
 func mkdir(d string) error {
@@ -169,6 +188,9 @@ func processArgs(localLogger *log.Logger, cOpts *ProgOpts) error {
 	if strings.IndexRune(cOpts.LogRoot, filepath.Separator) != 0 {
 		cOpts.LogRoot = filepath.Join(cOpts.BaseRoot, cOpts.LogRoot)
 	}
+	if cOpts.JobLogArchiveRoot != "" && strings.IndexRune(cOpts.JobLogArchiveRoot, filepath.Separator) != 0 {
+		cOpts.JobLogArchiveRoot = filepath.Join(cOpts.BaseRoot, cOpts.JobLogArchiveRoot)
+	}
 	if strings.IndexRune(cOpts.SaasContentRoot, filepath.Separator) != 0 {
 		cOpts.SaasContentRoot = filepath.Join(cOpts.BaseRoot, cOpts.SaasContentRoot)
 	}
@@ -469,9 +491,27 @@ func server(localLogger *log.Logger, cOpts *ProgOpts) error {
 	if cOpts.CleanupCorrupt {
 		dt.Cleanup = true
 	}
+	dt.RenderTimeout = time.Duration(cOpts.RenderTimeout) * time.Second
+	dt.RenderMaxSize = cOpts.RenderMaxSize
+	dt.RenderMaxDepth = cOpts.RenderMaxDepth
+	dt.ArtifactMaxSize = cOpts.ArtifactMaxSize
+	dt.ArtifactMaxTotal = cOpts.ArtifactMaxTotal
+	dt.JobLogCompressAge = time.Duration(cOpts.JobLogCompressAge) * time.Hour
+	dt.JobLogMaxAge = time.Duration(cOpts.JobLogMaxAge) * 24 * time.Hour
+	dt.JobLogMaxPerMachine = cOpts.JobLogMaxPerMachine
+	dt.JobLogMaxTotal = cOpts.JobLogMaxTotal
+	dt.JobLogArchiveRoot = cOpts.JobLogArchiveRoot
+	dt.HeartbeatStale = time.Duration(cOpts.HeartbeatStale) * time.Second
+	dt.ConsoleMaxSize = cOpts.ConsoleMaxSize
 	pcLogLvl, _ := logger.ParseLevel(dt.Prefs()["debugPlugins"])
 	pc.SetLevel(pcLogLvl)
 	services = append(services, pc)
+	services = append(services, backend.NewJobReaper(dt, 10*time.Second))
+	services = append(services, backend.NewLogJanitor(dt, 10*time.Minute))
+	services = append(services, backend.NewScheduler(dt, backend.WallClock, 10*time.Second))
+	services = append(services, backend.NewRolloutRunner(dt, backend.WallClock, 10*time.Second))
+	services = append(services, backend.NewLivenessMonitor(dt, 10*time.Second))
+	services = append(services, backend.NewConsoleCapture(dt, 30*time.Second))
 
 	fe := frontend.NewFrontend(dt, buf.Log("frontend"),
 		cOpts.OurAddress,
@@ -495,6 +535,30 @@ func server(localLogger *log.Logger, cOpts *ProgOpts) error {
 		services = append(services, svc)
 	}
 
+	if cOpts.NetconsolePort != 0 {
+		localLogger.Printf("Starting netconsole receiver")
+		svc, err := midlayer.ServeNetconsole(
+			fmt.Sprintf(":%d", cOpts.NetconsolePort),
+			dt,
+			buf.Log("console"))
+		if err != nil {
+			return fmt.Errorf("Error starting netconsole receiver: %v", err)
+		}
+		services = append(services, svc)
+	}
+
+	if cOpts.SyslogPort != 0 {
+		localLogger.Printf("Starting syslog receiver")
+		svc, err := midlayer.ServeSyslog(
+			fmt.Sprintf(":%d", cOpts.SyslogPort),
+			dt,
+			buf.Log("console"))
+		if err != nil {
+			return fmt.Errorf("Error starting syslog receiver: %v", err)
+		}
+		services = append(services, svc)
+	}
+
 	if !cOpts.DisableProvisioner {
 		localLogger.Printf("Starting static file server")
 		svc, err := midlayer.ServeStatic(